@@ -24,6 +24,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/watch"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1beta2"
 	vpa_clientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
@@ -464,12 +465,22 @@ func (feeder *clusterStateFeeder) validateTargetRef(vpa *vpa_types.VerticalPodAu
 	if top == nil {
 		return false, condition{conditionType: vpa_types.ConfigUnsupported, delete: false, message: fmt.Sprintf("Unknown error during checking if target is a top level controller: %s", err)}
 	}
-	if *top != k {
+	// The top level controller may be returned in another version of its group, e.g. the preferred one.
+	if top.ControllerKey != k.ControllerKey || apiGroup(top.ApiVersion) != apiGroup(k.ApiVersion) {
 		return false, condition{conditionType: vpa_types.ConfigUnsupported, delete: false, message: "The targetRef controller has a parent but it should point to a top-level controller"}
 	}
 	return true, condition{}
 }
 
+// apiGroup returns the group of the given API version, or the API version itself if it can't be parsed.
+func apiGroup(apiVersion string) string {
+	groupVersion, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return apiVersion
+	}
+	return groupVersion.Group
+}
+
 func (feeder *clusterStateFeeder) getSelector(vpa *vpa_types.VerticalPodAutoscaler) (labels.Selector, []condition) {
 	legacySelector, fetchLegacyErr := feeder.legacySelectorFetcher.Fetch(vpa)
 	if fetchLegacyErr != nil {
@@ -209,6 +209,48 @@ func TestLegacySelector(t *testing.T) {
 			},
 			expectedConfigUnsupported: nil,
 		},
+		{
+			name:               "top-level target ref of a non-preferred version",
+			legacySelector:     nil,
+			selector:           parseLabelSelector("app = test"),
+			fetchSelectorError: nil,
+			expectedSelector:   parseLabelSelector("app = test"),
+			targetRef: &v1.CrossVersionObjectReference{
+				Kind:       "Deployment",
+				Name:       name1,
+				APIVersion: "apps/v1beta2",
+			},
+			topLevelKey: &controllerfetcher.ControllerKeyWithAPIVersion{
+				ControllerKey: controllerfetcher.ControllerKey{
+					Kind:      "Deployment",
+					Name:      name1,
+					Namespace: namespace,
+				},
+				ApiVersion: "apps/v1",
+			},
+			expectedConfigUnsupported: nil,
+		},
+		{
+			name:               "target ref with a parent of another group",
+			legacySelector:     nil,
+			selector:           parseLabelSelector("app = test"),
+			fetchSelectorError: nil,
+			expectedSelector:   labels.Nothing(),
+			targetRef: &v1.CrossVersionObjectReference{
+				Kind:       "Deployment",
+				Name:       name1,
+				APIVersion: "apps/v1",
+			},
+			topLevelKey: &controllerfetcher.ControllerKeyWithAPIVersion{
+				ControllerKey: controllerfetcher.ControllerKey{
+					Kind:      "Deployment",
+					Name:      name1,
+					Namespace: namespace,
+				},
+				ApiVersion: "example.com/v1",
+			},
+			expectedConfigUnsupported: &unsupportedTargetRefHasParent,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,52 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// argoRolloutsGroup is the API group of Argo Rollouts.
+const argoRolloutsGroup = "argoproj.io"
+
+// argoRolloutsAuxiliaryKinds are the kinds Argo Rollouts creates Pods through besides Rollouts: an Experiment
+// owns ReplicaSets and an AnalysisRun owns Jobs. Both are owned by the Rollout which created them, if any, and
+// an AnalysisRun may be owned by an Experiment instead. Neither has a scale subresource, so they're read with
+// the dynamic client.
+var argoRolloutsAuxiliaryKinds = map[schema.GroupKind]bool{
+	{Group: argoRolloutsGroup, Kind: "Experiment"}:  true,
+	{Group: argoRolloutsGroup, Kind: "AnalysisRun"}: true,
+}
+
+// ArgoRolloutsTerminal is the top level controller of Pods created by Argo Rollouts Experiments and AnalysisRuns.
+type ArgoRolloutsTerminal string
+
+const (
+	// ArgoRolloutsRolloutTerminal resolves Pods of Experiments and AnalysisRuns to the Rollout which created
+	// them, so that they're attributed like the Rollout's own Pods. Experiments and AnalysisRuns created
+	// without a Rollout are top level. This is the default.
+	ArgoRolloutsRolloutTerminal ArgoRolloutsTerminal = "Rollout"
+	// ArgoRolloutsExperimentTerminal makes Experiments and AnalysisRuns top level, so that their Pods get
+	// recommendations of their own.
+	ArgoRolloutsExperimentTerminal ArgoRolloutsTerminal = "Experiment"
+)
+
+// isDynamicPathKind tells whether controllers of the given kind are read with the dynamic client when there's
+// no informer for them, instead of following the resolution policy.
+func isDynamicPathKind(groupKind schema.GroupKind) bool {
+	return knativeServingKinds[groupKind] || argoRolloutsAuxiliaryKinds[groupKind] || groupKind == flaggerCanary
+}
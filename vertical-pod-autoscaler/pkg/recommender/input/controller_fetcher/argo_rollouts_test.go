@@ -0,0 +1,189 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newArgoRolloutsFetcher() *controllerFetcher {
+	rolloutsV1alpha1 := schema.GroupVersion{Group: argoRolloutsGroup, Version: "v1alpha1"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{rolloutsV1alpha1})
+	for _, kind := range []string{"Rollout", "Experiment", "AnalysisRun"} {
+		mapper.Add(rolloutsV1alpha1.WithKind(kind), apimeta.RESTScopeNamespace)
+	}
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: argoRolloutsGroup, Resource: "rollouts"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-rollout", Namespace: "test-namespace"},
+	})
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.terminalKinds = make(map[schema.GroupKind]bool)
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-experiment-canary",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "argoproj.io/v1alpha1", Kind: "Experiment", Name: "test-experiment", Controller: &trueVar},
+			},
+		},
+	})
+	addController(f, &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{Kind: "Job"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-analysis-job",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "argoproj.io/v1alpha1", Kind: "AnalysisRun", Name: "test-analysis", Controller: &trueVar},
+			},
+		},
+	})
+	addController(f, &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{Kind: "Job"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-experiment-analysis-job",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "argoproj.io/v1alpha1", Kind: "AnalysisRun", Name: "test-experiment-analysis", Controller: &trueVar},
+			},
+		},
+	})
+	return f
+}
+
+func argoRolloutsObjects() []*unstructured.Unstructured {
+	rolloutOwner := metav1.OwnerReference{APIVersion: "argoproj.io/v1alpha1", Kind: "Rollout", Name: "test-rollout", Controller: &trueVar}
+	experimentOwner := metav1.OwnerReference{APIVersion: "argoproj.io/v1alpha1", Kind: "Experiment", Name: "standalone-experiment", Controller: &trueVar}
+	return []*unstructured.Unstructured{
+		newUnstructured("argoproj.io/v1alpha1", "Experiment", "test-namespace", "test-experiment", rolloutOwner),
+		newUnstructured("argoproj.io/v1alpha1", "Experiment", "test-namespace", "standalone-experiment"),
+		newUnstructured("argoproj.io/v1alpha1", "AnalysisRun", "test-namespace", "test-analysis", rolloutOwner),
+		newUnstructured("argoproj.io/v1alpha1", "AnalysisRun", "test-namespace", "test-experiment-analysis", experimentOwner),
+	}
+}
+
+func TestFindTopLevelForArgoRolloutsAuxiliaryPods(t *testing.T) {
+	rolloutKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rollout", Kind: "Rollout", Namespace: "test-namespace"}, ApiVersion: "argoproj.io/v1alpha1"}
+	testCases := []struct {
+		name          string
+		controller    ControllerKeyWithAPIVersion
+		terminal      ArgoRolloutsTerminal
+		expected      *ControllerKeyWithAPIVersion
+		expectedPaths []ResolutionPath
+	}{
+		{
+			name: "experiment of a rollout",
+			controller: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-experiment-canary", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"},
+			expected:      rolloutKey,
+			expectedPaths: []ResolutionPath{InformerPath, DynamicPath, ScalePath},
+		},
+		{
+			name: "analysis run of a rollout",
+			controller: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-analysis-job", Kind: "Job", Namespace: "test-namespace"}, ApiVersion: "batch/v1"},
+			expected:      rolloutKey,
+			expectedPaths: []ResolutionPath{InformerPath, DynamicPath, ScalePath},
+		},
+		{
+			name: "analysis run of a standalone experiment",
+			controller: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-experiment-analysis-job", Kind: "Job", Namespace: "test-namespace"}, ApiVersion: "batch/v1"},
+			expected: &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "standalone-experiment", Kind: "Experiment", Namespace: "test-namespace"}, ApiVersion: "argoproj.io/v1alpha1"},
+			expectedPaths: []ResolutionPath{InformerPath, DynamicPath, DynamicPath},
+		},
+		{
+			name: "experiment as terminal",
+			controller: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-experiment-canary", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"},
+			terminal: ArgoRolloutsExperimentTerminal,
+			expected: &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-experiment", Kind: "Experiment", Namespace: "test-namespace"}, ApiVersion: "argoproj.io/v1alpha1"},
+			expectedPaths: []ResolutionPath{InformerPath, TerminalPath},
+		},
+		{
+			name: "analysis run as terminal",
+			controller: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-analysis-job", Kind: "Job", Namespace: "test-namespace"}, ApiVersion: "batch/v1"},
+			terminal: ArgoRolloutsExperimentTerminal,
+			expected: &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-analysis", Kind: "AnalysisRun", Namespace: "test-namespace"}, ApiVersion: "argoproj.io/v1alpha1"},
+			expectedPaths: []ResolutionPath{InformerPath, TerminalPath},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dynamicClient := newFakeDynamicClient()
+			for _, obj := range argoRolloutsObjects() {
+				resource := schema.GroupResource{Group: argoRolloutsGroup, Resource: map[string]string{
+					"Experiment": "experiments", "AnalysisRun": "analysisruns"}[obj.GetKind()]}
+				dynamicClient.add(resource, obj)
+			}
+			f := newArgoRolloutsFetcher()
+			f.dynamicClient = dynamicClient
+			if tc.terminal == ArgoRolloutsExperimentTerminal {
+				for groupKind := range argoRolloutsAuxiliaryKinds {
+					f.terminalKinds[groupKind] = true
+				}
+			}
+			res, err := f.findTopLevel(context.Background(), &tc.controller)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, res.topLevel)
+			assert.Equal(t, tc.expectedPaths, res.paths)
+		})
+	}
+}
+
+func TestFindTopLevelForArgoRolloutsAuxiliaryPodsWithInformers(t *testing.T) {
+	informers := map[schema.GroupKind]cache.SharedIndexInformer{}
+	for groupKind := range argoRolloutsAuxiliaryKinds {
+		informers[groupKind] = newCustomInformer()
+	}
+	for _, obj := range argoRolloutsObjects() {
+		informers[obj.GroupVersionKind().GroupKind()].GetStore().Add(obj)
+	}
+	f := newArgoRolloutsFetcher()
+	f.customInformers = informers
+
+	res, err := f.findTopLevel(context.Background(), &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-analysis-job", Kind: "Job", Namespace: "test-namespace"}, ApiVersion: "batch/v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rollout", Kind: "Rollout", Namespace: "test-namespace"}, ApiVersion: "argoproj.io/v1alpha1"}, res.topLevel)
+	assert.Equal(t, []ResolutionPath{InformerPath, InformerPath, ScalePath}, res.paths)
+
+	// Missing Experiments are reported as such, rather than as kinds without a scale subresource.
+	_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-experiment", Kind: "Experiment", Namespace: "test-namespace"}, ApiVersion: "argoproj.io/v1alpha1"})
+	assert.EqualError(t, err, "Experiment test-namespace/missing-experiment does not exist")
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+)
+
+const (
+	// asyncRetryBaseDelay is the delay before the first retry of a resolution of ResolveAsync, it doubles with
+	// each retry up to asyncRetryMaxDelay.
+	asyncRetryBaseDelay = 500 * time.Millisecond
+	asyncRetryMaxDelay  = time.Minute
+	// maxAsyncRetries is the number of times a resolution of ResolveAsync is retried before its transient error
+	// is taken as permanent.
+	maxAsyncRetries = 8
+)
+
+// asyncResolution is a resolution queued by ResolveAsync. Each call is queued separately: resolutions are
+// compared by address, so the queue doesn't merge them.
+type asyncResolution struct {
+	key      ControllerKeyWithAPIVersion
+	callback func(*ControllerKeyWithAPIVersion, error)
+}
+
+// asyncResolver resolves controllers from a rate limited work queue, requeuing those failing with transient
+// errors.
+type asyncResolver struct {
+	resolve    func(context.Context, *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error)
+	queue      workqueue.RateLimitingInterface
+	maxRetries int
+
+	// mutex guards pending and stopped. pending holds the resolutions whose callback wasn't called yet.
+	mutex   sync.Mutex
+	pending map[*asyncResolution]bool
+	stopped bool
+	stopCh  <-chan struct{}
+}
+
+func newAsyncResolver(resolve func(context.Context, *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error),
+	rateLimiter workqueue.RateLimiter, maxRetries int) *asyncResolver {
+	return &asyncResolver{
+		resolve:    resolve,
+		queue:      workqueue.NewNamedRateLimitingQueue(rateLimiter, "controllerfetcher"),
+		maxRetries: maxRetries,
+		pending:    make(map[*asyncResolution]bool),
+	}
+}
+
+// run starts the given number of workers. When stopCh is closed, the queue is shut down and resolutions which
+// didn't finish are failed with ErrFetcherStopped.
+func (r *asyncResolver) run(workers int, stopCh <-chan struct{}) {
+	r.stopCh = stopCh
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r.processNext() {
+			}
+		}()
+	}
+	go func() {
+		<-stopCh
+		r.queue.ShutDown()
+		wg.Wait()
+		r.mutex.Lock()
+		r.stopped = true
+		pending := r.pending
+		r.pending = nil
+		r.mutex.Unlock()
+		for resolution := range pending {
+			resolution.callback(nil, ErrFetcherStopped)
+		}
+	}()
+}
+
+func (r *asyncResolver) add(resolution *asyncResolution) {
+	r.mutex.Lock()
+	if r.stopped || isClosed(r.stopCh) {
+		r.mutex.Unlock()
+		resolution.callback(nil, ErrFetcherStopped)
+		return
+	}
+	r.pending[resolution] = true
+	r.mutex.Unlock()
+	r.queue.Add(resolution)
+}
+
+// processNext resolves the next queued controller. It returns false when the queue is shut down.
+func (r *asyncResolver) processNext() bool {
+	item, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(item)
+	resolution := item.(*asyncResolution)
+	key := resolution.key
+	topLevel, err := r.resolve(context.Background(), &key)
+	if err != nil && isTransientResolutionError(err) && r.queue.NumRequeues(resolution) < r.maxRetries {
+		klog.V(4).Infof("Retrying resolution of %s %s/%s after transient error: %v", key.Kind, key.Namespace, key.Name, err)
+		r.queue.AddRateLimited(resolution)
+		return true
+	}
+	r.queue.Forget(resolution)
+	r.mutex.Lock()
+	delete(r.pending, resolution)
+	r.mutex.Unlock()
+	resolution.callback(topLevel, err)
+	return true
+}
+
+// isClosed tells whether the given channel is closed. A nil channel is never closed.
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTransientResolutionError tells whether resolution failing with the given error may succeed if retried:
+// the API server throttled or failed a request, or it timed out.
+func isTransientResolutionError(err error) bool {
+	if errors.Is(err, ErrResolutionTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var status k8serrors.APIStatus
+	if errors.As(err, &status) {
+		code := status.Status().Code
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func (f *controllerFetcher) ResolveAsync(key ControllerKeyWithAPIVersion, callback func(*ControllerKeyWithAPIVersion, error)) {
+	f.asyncOnce.Do(func() {
+		if f.async == nil {
+			f.async = newAsyncResolver(f.FindTopLevelWithContext,
+				workqueue.NewItemExponentialFailureRateLimiter(asyncRetryBaseDelay, asyncRetryMaxDelay), maxAsyncRetries)
+		}
+		f.async.run(f.resolutionWorkers(), f.stopCh)
+	})
+	f.async.add(&asyncResolution{key: key, callback: callback})
+}
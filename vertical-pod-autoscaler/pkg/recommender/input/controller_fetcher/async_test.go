@@ -0,0 +1,154 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+)
+
+type asyncResult struct {
+	topLevel *ControllerKeyWithAPIVersion
+	err      error
+}
+
+func resolveAsync(f *controllerFetcher, key ControllerKeyWithAPIVersion) <-chan asyncResult {
+	results := make(chan asyncResult, 1)
+	f.ResolveAsync(key, func(topLevel *ControllerKeyWithAPIVersion, err error) {
+		results <- asyncResult{topLevel, err}
+	})
+	return results
+}
+
+func TestResolveAsync(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	widgets := schema.GroupResource{Group: "example.com", Resource: "widgets"}
+	scales := newFakeScalesGetter()
+	scales.throttled = make(map[scaleKey]int)
+	for _, name := range []string{"flaky-widget", "throttled-widget"} {
+		scales.add(widgets, &autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"}})
+	}
+	// Each resolution reads the scale maxThrottledRetries+1 times before giving up.
+	scales.throttled[scaleKey{widgets, "test-namespace", "flaky-widget"}] = 2 * (maxThrottledRetries + 1)
+	scales.throttled[scaleKey{widgets, "test-namespace", "throttled-widget"}] = -1
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.sleep = func(time.Duration) {}
+	f.stopCh = make(chan struct{})
+	f.async = newAsyncResolver(f.FindTopLevelWithContext,
+		workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond), 3)
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	widgetKey := func(name string) ControllerKeyWithAPIVersion {
+		return ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: name, Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	}
+	deploymentKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	missingKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+
+	testCases := []struct {
+		name     string
+		key      ControllerKeyWithAPIVersion
+		topLevel *ControllerKeyWithAPIVersion
+		check    func(error) bool
+	}{
+		{name: "resolves", key: deploymentKey, topLevel: &deploymentKey},
+		{name: "retries transient errors", key: widgetKey("flaky-widget"), topLevel: &ControllerKeyWithAPIVersion{
+			ControllerKey: widgetKey("flaky-widget").ControllerKey, ApiVersion: "example.com/v1"}},
+		{name: "gives up on transient errors", key: widgetKey("throttled-widget"), check: isTransientResolutionError},
+		{name: "doesn't retry permanent errors", key: missingKey, check: func(err error) bool {
+			return errors.Is(err, ErrControllerNotFound)
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			select {
+			case result := <-resolveAsync(f, tc.key):
+				if tc.check != nil {
+					assert.True(t, tc.check(result.err), "unexpected error: %v", result.err)
+					assert.Nil(t, result.topLevel)
+				} else if assert.NoError(t, result.err) {
+					assert.Equal(t, tc.topLevel, result.topLevel)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("callback wasn't called")
+			}
+		})
+	}
+
+	// Once the fetcher is stopped, resolutions fail right away.
+	f.Stop()
+	select {
+	case result := <-resolveAsync(f, deploymentKey):
+		assert.True(t, errors.Is(result.err, ErrFetcherStopped), "unexpected error: %v", result.err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("callback wasn't called")
+	}
+}
+
+func TestResolveAsyncStopped(t *testing.T) {
+	resolve := func(ctx context.Context, key *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error) {
+		return nil, k8serrors.NewServiceUnavailable("unavailable")
+	}
+	// The retry isn't due before the fetcher is stopped.
+	r := newAsyncResolver(resolve, workqueue.NewItemExponentialFailureRateLimiter(time.Hour, time.Hour), 3)
+	stopCh := make(chan struct{})
+	r.run(1, stopCh)
+	results := make(chan error, 1)
+	r.add(&asyncResolution{callback: func(_ *ControllerKeyWithAPIVersion, err error) { results <- err }})
+	assert.NoError(t, wait.PollImmediate(time.Millisecond, 10*time.Second, func() (bool, error) {
+		return r.queue.NumRequeues(firstPending(r)) == 1, nil
+	}))
+
+	close(stopCh)
+	select {
+	case err := <-results:
+		assert.True(t, errors.Is(err, ErrFetcherStopped), "unexpected error: %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("callback wasn't called")
+	}
+}
+
+func firstPending(r *asyncResolver) *asyncResolution {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for resolution := range r.pending {
+		return resolution
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metrics_recommender "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/recommender"
+	"k8s.io/klog"
+)
+
+const (
+	// droppedAuditRecordsLogInterval is the minimum time between logs of dropped audit records.
+	droppedAuditRecordsLogInterval = time.Minute
+)
+
+// AuditSink records resolutions, e.g. for compliance.
+type AuditSink interface {
+	// Record records a single FindTopLevel call with the given input. result is the zero key if resolution
+	// failed with err. The request ID of the resolution can be read from ctx with RequestIDFromContext.
+	// Returned errors are logged, they don't fail the resolution.
+	Record(ctx context.Context, input, result ControllerKeyWithAPIVersion, err error) error
+}
+
+// NoopAuditSink is an AuditSink which doesn't record anything.
+type NoopAuditSink struct{}
+
+// Record implements AuditSink.
+func (NoopAuditSink) Record(ctx context.Context, input, result ControllerKeyWithAPIVersion, err error) error {
+	return nil
+}
+
+// auditRecord is a line written by the JSON lines sink.
+type auditRecord struct {
+	Time      time.Time                    `json:"time"`
+	RequestID string                       `json:"requestID,omitempty"`
+	Input     ControllerKeyWithAPIVersion  `json:"input"`
+	Result    *ControllerKeyWithAPIVersion `json:"result,omitempty"`
+	Error     string                       `json:"error,omitempty"`
+}
+
+type jsonLinesAuditSink struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+	now     func() time.Time
+}
+
+// NewJSONLinesAuditSink returns an AuditSink writing each resolution as a line of JSON to w.
+func NewJSONLinesAuditSink(w io.Writer) AuditSink {
+	return &jsonLinesAuditSink{encoder: json.NewEncoder(w), now: time.Now}
+}
+
+// FileAuditSink is an AuditSink writing to a file, which must be closed once it's no longer used.
+type FileAuditSink interface {
+	AuditSink
+	io.Closer
+}
+
+type fileAuditSink struct {
+	*jsonLinesAuditSink
+	file *os.File
+}
+
+// NewFileAuditSink returns an AuditSink appending each resolution as a line of JSON to the file at path,
+// which is created if it doesn't exist. Close it after stopping the fetcher using it, records of later
+// resolutions fail.
+func NewFileAuditSink(path string) (FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditSink{jsonLinesAuditSink: &jsonLinesAuditSink{encoder: json.NewEncoder(file), now: time.Now}, file: file}, nil
+}
+
+// Close closes the file, waiting for the record being written.
+func (s *fileAuditSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+func (s *jsonLinesAuditSink) Record(ctx context.Context, input, result ControllerKeyWithAPIVersion, err error) error {
+	record := auditRecord{Time: s.now(), Input: input}
+	record.RequestID, _ = RequestIDFromContext(ctx)
+	if err != nil {
+		record.Error = err.Error()
+	} else {
+		record.Result = &result
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.encoder.Encode(record)
+}
+
+// newAuditEvents returns resolve events delivering resolutions to the sink. The context passed to the sink
+// is cancelled when the fetcher is stopped, records still buffered then are dropped. Dropped records are counted in a metric if recordMetrics is set,
+// and logged at most once per droppedAuditRecordsLogInterval.
+func newAuditEvents(sink AuditSink, bufferSize int, recordMetrics bool, stopCh <-chan struct{}) *resolveEvents {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	record := func(event ResolveEvent) {
+		var result ControllerKeyWithAPIVersion
+		if event.TopLevel != nil {
+			result = *event.TopLevel
+		}
+		if err := sink.Record(WithRequestID(ctx, event.RequestID), event.Controller, result, event.Err); err != nil {
+			klog.Errorf("Could not record resolution of %s %s/%s: %v", event.Controller.Kind,
+				event.Controller.Namespace, event.Controller.Name, err)
+		}
+	}
+	events := newResolveEvents(record, bufferSize, stopCh)
+	var lastLog, loggedDropped int64
+	events.onDrop = func(event ResolveEvent, dropped uint64) {
+		if recordMetrics {
+			metrics_recommender.RecordControllerFetcherDroppedAuditRecord()
+		}
+		now := time.Now().UnixNano()
+		last := atomic.LoadInt64(&lastLog)
+		if now-last < int64(droppedAuditRecordsLogInterval) || !atomic.CompareAndSwapInt64(&lastLog, last, now) {
+			return
+		}
+		since := uint64(atomic.SwapInt64(&loggedDropped, int64(dropped)))
+		klog.Warningf("Audit sink doesn't keep up, dropped %d records since the last report (%d in total), last of %s %s/%s",
+			dropped-since, dropped, event.Controller.Kind, event.Controller.Namespace, event.Controller.Name)
+	}
+	return events
+}
+
+func (f *controllerFetcher) DroppedAuditRecords() uint64 {
+	if f.auditEvents == nil {
+		return 0
+	}
+	return f.auditEvents.droppedCount()
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type auditCall struct {
+	input, result ControllerKeyWithAPIVersion
+	err           error
+}
+
+// fakeAuditSink reports calls on a channel until the fetcher is stopped, and fails every call.
+type fakeAuditSink struct {
+	calls chan auditCall
+}
+
+func (s *fakeAuditSink) Record(ctx context.Context, input, result ControllerKeyWithAPIVersion, err error) error {
+	select {
+	case s.calls <- auditCall{input, result, err}:
+	case <-ctx.Done():
+	}
+	return fmt.Errorf("sink unavailable")
+}
+
+func TestAuditSink(t *testing.T) {
+	f := simpleControllerFetcher()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	sink := &fakeAuditSink{calls: make(chan auditCall)}
+	f.auditEvents = newAuditEvents(sink, 1, false, stopCh)
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	missingKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+
+	// Errors of the sink don't fail resolution.
+	topLevel, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	call := <-sink.calls
+	assert.Equal(t, auditCall{input: *key, result: *topLevel}, call)
+
+	_, err = f.FindTopLevel(missingKey)
+	assert.Error(t, err)
+	call = <-sink.calls
+	assert.Equal(t, *missingKey, call.input)
+	assert.Equal(t, ControllerKeyWithAPIVersion{}, call.result)
+	assert.Error(t, call.err)
+
+	// A blocked sink doesn't stall resolution.
+	for i := 0; i < 3; i++ {
+		_, err = f.FindTopLevel(key)
+		assert.NoError(t, err)
+	}
+	assert.True(t, f.DroppedAuditRecords() > 0)
+}
+
+// blockingAuditSink reports the input of each call on a channel and blocks until the fetcher is stopped.
+type blockingAuditSink struct {
+	started chan ControllerKeyWithAPIVersion
+}
+
+func (s *blockingAuditSink) Record(ctx context.Context, input, result ControllerKeyWithAPIVersion, err error) error {
+	s.started <- input
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestAuditEventsStopped(t *testing.T) {
+	stopCh := make(chan struct{})
+	sink := &blockingAuditSink{started: make(chan ControllerKeyWithAPIVersion, 3)}
+	events := newAuditEvents(sink, 2, false, stopCh)
+	key := func(name string) ControllerKeyWithAPIVersion {
+		return ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{Name: name, Kind: "Deployment", Namespace: "test-namespace"}}
+	}
+	events.send(ResolveEvent{Controller: key("deployment-a")})
+	assert.Equal(t, key("deployment-a"), <-sink.started)
+	events.send(ResolveEvent{Controller: key("deployment-b")})
+	events.send(ResolveEvent{Controller: key("deployment-c")})
+	assert.Equal(t, uint64(0), events.droppedCount())
+
+	// Records buffered when the fetcher is stopped, and records of later resolutions, are counted as dropped
+	// instead of being passed to the sink with a cancelled context.
+	close(stopCh)
+	assert.NoError(t, wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		return events.droppedCount() == 2, nil
+	}))
+	events.send(ResolveEvent{Controller: key("deployment-d")})
+	assert.Equal(t, uint64(3), events.droppedCount())
+	assert.Empty(t, sink.started)
+}
+
+func TestAuditSinkPodsWithoutController(t *testing.T) {
+	f := simpleControllerFetcher()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	sink := &fakeAuditSink{calls: make(chan auditCall)}
+	f.auditEvents = newAuditEvents(sink, 1, false, stopCh)
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Namespace: "test-namespace"}}
+	podKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-pod", Kind: "Pod", Namespace: "test-namespace"}, ApiVersion: "v1"}
+
+	_, err := f.FindTopLevelForPod(context.Background(), pod)
+	assert.True(t, errors.Is(err, ErrNoController), "unexpected error: %v", err)
+	call := <-sink.calls
+	assert.Equal(t, podKey, call.input)
+	assert.Equal(t, ControllerKeyWithAPIVersion{}, call.result)
+	assert.True(t, errors.Is(call.err, ErrNoController), "unexpected error: %v", call.err)
+
+	f.allowStandalonePods = true
+	topLevel, err := f.FindTopLevelForPod(context.Background(), pod)
+	assert.NoError(t, err)
+	assert.Equal(t, &podKey, topLevel)
+	assert.Equal(t, auditCall{input: podKey, result: podKey}, <-sink.calls)
+
+	_, err = f.FindTopLevelForPodName(context.Background(), "test-namespace", "test-pod")
+	assert.True(t, errors.Is(err, ErrPodInformerDisabled), "unexpected error: %v", err)
+	call = <-sink.calls
+	assert.Equal(t, podKey, call.input)
+	assert.True(t, errors.Is(call.err, ErrPodInformerDisabled), "unexpected error: %v", call.err)
+}
+
+func TestJSONLinesAuditSink(t *testing.T) {
+	var buffer bytes.Buffer
+	sink := NewJSONLinesAuditSink(&buffer).(*jsonLinesAuditSink)
+	sink.now = func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) }
+	input := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	result := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+
+	assert.NoError(t, sink.Record(context.Background(), input, result, nil))
+	assert.NoError(t, sink.Record(context.Background(), input, ControllerKeyWithAPIVersion{}, fmt.Errorf("test error")))
+	assert.Equal(t,
+		`{"time":"2020-01-02T03:04:05Z","input":{"Namespace":"test-namespace","Kind":"ReplicaSet","Name":"test-rs","ApiVersion":"apps/v1","ResourceVersion":""},`+
+			`"result":{"Namespace":"test-namespace","Kind":"Deployment","Name":"test-deployment","ApiVersion":"apps/v1","ResourceVersion":""}}`+"\n"+
+			`{"time":"2020-01-02T03:04:05Z","input":{"Namespace":"test-namespace","Kind":"ReplicaSet","Name":"test-rs","ApiVersion":"apps/v1","ResourceVersion":""},`+
+			`"error":"test error"}`+"\n",
+		buffer.String())
+}
+
+func TestFileAuditSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+	key := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+
+	// Records are appended to existing files.
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileAuditSink(path)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, sink.Record(context.Background(), key, key, nil))
+		assert.NoError(t, sink.Close())
+		// Nothing is recorded once the sink is closed.
+		assert.Error(t, sink.Record(context.Background(), key, key, nil))
+	}
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(content), "\n"))
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog"
+)
+
+// unavailableWellKnownControllers returns the well-known controllers whose API version the server doesn't
+// serve according to discovery, e.g. Jobs on a stripped-down API server. Informers of these controllers would
+// never sync. If discovery fails, or returns no groups at all (every server serves at least the core group),
+// all well-known controllers are considered available, so that a flaky discovery doesn't disable informers.
+func unavailableWellKnownControllers(discoveryClient discovery.DiscoveryInterface) map[wellKnownController]bool {
+	groups, err := discoveryClient.ServerGroups()
+	if err != nil {
+		klog.Warningf("Could not discover API versions of well-known controllers, assuming all are served: %v", err)
+		return nil
+	}
+	if len(groups.Groups) == 0 {
+		return nil
+	}
+	served := sets.NewString()
+	for _, group := range groups.Groups {
+		for _, version := range group.Versions {
+			served.Insert(version.GroupVersion)
+		}
+	}
+	unavailable := make(map[wellKnownController]bool)
+	for _, kind := range wellKnownControllers {
+		if !served.Has(wellKnownControllerGroupVersions[kind]) {
+			klog.Warningf("%s of %s isn't served, not watching it", kind, wellKnownControllerGroupVersions[kind])
+			unavailable[kind] = true
+		}
+	}
+	return unavailable
+}
+
+// isUnavailableKind tells whether the given kind is a well-known controller whose API version isn't served.
+// Kinds of other groups, e.g. CRDs reusing the name of a well-known controller, are never unavailable.
+func (f *controllerFetcher) isUnavailableKind(groupKind schema.GroupKind) bool {
+	return f.unavailableKinds[wellKnownController(groupKind.Kind)] && isWellKnownGroupKind(groupKind)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestUnavailableWellKnownControllers(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	discovery := kubeClient.Discovery().(*fakediscovery.FakeDiscovery)
+
+	// Discovery without any groups isn't trusted.
+	assert.Empty(t, unavailableWellKnownControllers(discovery))
+
+	discovery.Resources = []*metav1.APIResourceList{{GroupVersion: "v1"}, {GroupVersion: "apps/v1"}}
+	assert.Equal(t, map[wellKnownController]bool{job: true}, unavailableWellKnownControllers(discovery))
+}
+
+func TestNewControllerFetcherWithUnavailableKinds(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{GroupVersion: "v1"}, {GroupVersion: "apps/v1"},
+	}
+	f := NewControllerFetcherWithClients(kubeClient.Discovery(), kubeClient, informers.NewSharedInformerFactory(kubeClient, 0), Options{})
+	defer f.Stop()
+
+	_, hasJobInformer := f.(*controllerFetcher).informersMap[job]
+	assert.False(t, hasJobInformer)
+
+	deploymentKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	topLevel, err := f.FindTopLevel(deploymentKey)
+	assert.NoError(t, err)
+	assert.Equal(t, deploymentKey, topLevel)
+
+	for _, apiVersion := range []string{"", "batch/v1"} {
+		_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "test-job", Kind: "Job", Namespace: "test-namespace"}, ApiVersion: apiVersion})
+		assert.True(t, errors.Is(err, ErrKindUnavailable), "unexpected error: %v", err)
+	}
+}
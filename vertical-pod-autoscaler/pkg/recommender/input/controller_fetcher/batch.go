@@ -0,0 +1,165 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BatchOptions bound the duration of FindTopLevelBatch.
+type BatchOptions struct {
+	// Timeout is the deadline of the whole batch. Keys which aren't resolved when it passes fail with
+	// context.DeadlineExceeded, without waiting for reads in flight. There's no deadline other than the one of
+	// the context if it's zero.
+	Timeout time.Duration
+	// KeyTimeout is the soft timeout of each key: like Options.ResolutionTimeout it's checked before reading
+	// each controller, so that a slow key gives way to the others. Keys exceeding it fail with
+	// ErrResolutionTimeout. Keys aren't timed out individually if it's zero.
+	KeyTimeout time.Duration
+}
+
+// BatchResult is the resolution of a single key by FindTopLevelBatch or ResolveStream.
+type BatchResult struct {
+	// Controller is the key which was resolved.
+	Controller ControllerKeyWithAPIVersion
+	// TopLevel is the top level controller, nil if resolution failed.
+	TopLevel *ControllerKeyWithAPIVersion
+	// Err is the error resolution failed with.
+	Err error
+}
+
+// batchResults collects results of a batch until it's closed, after which results of resolutions still in flight
+// are dropped.
+type batchResults struct {
+	mutex   sync.Mutex
+	results []BatchResult
+	done    []bool
+	closed  bool
+}
+
+func (r *batchResults) set(i int, topLevel *ControllerKeyWithAPIVersion, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return
+	}
+	r.results[i].TopLevel = topLevel
+	r.results[i].Err = err
+	r.done[i] = true
+}
+
+// close returns the results, with err set for keys which weren't resolved.
+func (r *batchResults) close(err error) []BatchResult {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.closed = true
+	for i := range r.results {
+		if !r.done[i] {
+			r.results[i].Err = err
+		}
+	}
+	return r.results
+}
+
+func (f *controllerFetcher) FindTopLevelBatch(ctx context.Context, keys []ControllerKeyWithAPIVersion, options BatchOptions) []BatchResult {
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+	results := &batchResults{results: make([]BatchResult, len(keys)), done: make([]bool, len(keys))}
+	for i, key := range keys {
+		results.results[i].Controller = key
+	}
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < f.resolutionWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				key := keys[i]
+				keyCtx, cancel := ctx, context.CancelFunc(func() {})
+				if options.KeyTimeout > 0 {
+					keyCtx, cancel = context.WithTimeout(ctx, options.KeyTimeout)
+				}
+				topLevel, err := f.FindTopLevelWithContext(keyCtx, &key)
+				cancel()
+				if ctx.Err() == nil {
+					results.set(i, topLevel, err)
+				}
+			}
+		}()
+	}
+	allDone := make(chan struct{})
+	go func() {
+		defer close(queue)
+		for i := range keys {
+			select {
+			case queue <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(allDone)
+	}()
+	select {
+	case <-allDone:
+		return results.close(ctx.Err())
+	case <-ctx.Done():
+		return results.close(ctx.Err())
+	}
+}
+
+func (f *controllerFetcher) ResolveStream(ctx context.Context, keys <-chan ControllerKeyWithAPIVersion) <-chan BatchResult {
+	results := make(chan BatchResult)
+	var wg sync.WaitGroup
+	for i := 0; i < f.resolutionWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				var key ControllerKeyWithAPIVersion
+				var ok bool
+				select {
+				case key, ok = <-keys:
+					if !ok {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+				topLevel, err := f.FindTopLevelWithContext(ctx, &key)
+				select {
+				case results <- BatchResult{Controller: key, TopLevel: topLevel, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// batchTestFetcher returns a fetcher with a Deployment and a SlowApp owned by a SlowParent, whose scales wait
+// on the returned channel. Keys of the Deployment and the SlowApp are returned.
+func batchTestFetcher() (*controllerFetcher, chan struct{}, *ControllerKeyWithAPIVersion, *ControllerKeyWithAPIVersion) {
+	groupVersion := schema.GroupVersion{Group: "example.com", Version: "v1"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{groupVersion})
+	mapper.Add(groupVersion.WithKind("SlowApp"), apimeta.RESTScopeNamespace)
+	mapper.Add(groupVersion.WithKind("SlowParent"), apimeta.RESTScopeNamespace)
+	slowApps := schema.GroupResource{Group: "example.com", Resource: "slowapps"}
+	scales := newFakeScalesGetter()
+	scales.add(slowApps, &autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{
+		Name: "test-slow", Namespace: "test-namespace",
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: "example.com/v1", Kind: "SlowParent", Name: "test-parent", Controller: &trueVar}},
+	}})
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "slowparents"},
+		&autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{Name: "test-parent", Namespace: "test-namespace"}})
+	unblock := make(chan struct{})
+	scales.blocked = map[schema.GroupResource]chan struct{}{slowApps: unblock}
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	deploymentKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	slowKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-slow", Kind: "SlowApp", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	return f, unblock, deploymentKey, slowKey
+}
+
+func TestFindTopLevelBatchTimeout(t *testing.T) {
+	f, unblock, deploymentKey, slowKey := batchTestFetcher()
+	defer close(unblock)
+	missingKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	keys := []ControllerKeyWithAPIVersion{*slowKey, *deploymentKey, missingKey}
+
+	start := time.Now()
+	results := f.FindTopLevelBatch(context.Background(), keys, BatchOptions{Timeout: 50 * time.Millisecond})
+	// The batch doesn't wait for the blocked read.
+	assert.True(t, time.Since(start) < 5*time.Second)
+	if assert.Len(t, results, 3) {
+		assert.Equal(t, *slowKey, results[0].Controller)
+		assert.Nil(t, results[0].TopLevel)
+		assert.Equal(t, context.DeadlineExceeded, results[0].Err)
+
+		assert.Equal(t, *deploymentKey, results[1].Controller)
+		assert.NoError(t, results[1].Err)
+		assert.Equal(t, deploymentKey, results[1].TopLevel)
+
+		assert.Equal(t, missingKey, results[2].Controller)
+		assert.Error(t, results[2].Err)
+		assert.False(t, errors.Is(results[2].Err, context.DeadlineExceeded))
+	}
+}
+
+func TestFindTopLevelBatchKeyTimeout(t *testing.T) {
+	f, unblock, deploymentKey, slowKey := batchTestFetcher()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(unblock)
+	}()
+	keys := []ControllerKeyWithAPIVersion{*slowKey, *deploymentKey}
+
+	results := f.FindTopLevelBatch(context.Background(), keys, BatchOptions{KeyTimeout: 10 * time.Millisecond})
+	if assert.Len(t, results, 2) {
+		// The slow read finishes, but the key ran out of time before reading the owner.
+		assert.Nil(t, results[0].TopLevel)
+		assert.True(t, errors.Is(results[0].Err, ErrResolutionTimeout), "unexpected error: %v", results[0].Err)
+		assert.NoError(t, results[1].Err)
+		assert.Equal(t, deploymentKey, results[1].TopLevel)
+	}
+
+	// Without timeouts the chain is resolved.
+	results = f.FindTopLevelBatch(context.Background(), keys[:1], BatchOptions{})
+	if assert.Len(t, results, 1) {
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, "SlowParent", results[0].TopLevel.Kind)
+	}
+}
+
+func TestResolveStream(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.readLimiter = newGroupKindLimiter(3)
+	keys := make(chan ControllerKeyWithAPIVersion)
+	expected := make(map[string]bool)
+	go func() {
+		defer close(keys)
+		for i := 0; i < 20; i++ {
+			name := fmt.Sprintf("test-deployment-%d", i)
+			if i%2 == 0 {
+				addController(f, &appsv1.Deployment{
+					TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+				})
+			}
+			expected[name] = i%2 == 0
+			keys <- ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{Name: name, Kind: "Deployment", Namespace: "test-namespace"}}
+		}
+	}()
+
+	resolved := make(map[string]bool)
+	for result := range f.ResolveStream(context.Background(), keys) {
+		if result.Err == nil {
+			assert.Equal(t, result.Controller, *result.TopLevel)
+		} else {
+			assert.True(t, errors.Is(result.Err, ErrControllerNotFound), "unexpected error: %v", result.Err)
+		}
+		resolved[result.Controller.Name] = result.Err == nil
+	}
+	assert.Equal(t, expected, resolved)
+}
+
+func TestResolveStreamCanceled(t *testing.T) {
+	f, unblock, deploymentKey, _ := batchTestFetcher()
+	defer close(unblock)
+	keys := make(chan ControllerKeyWithAPIVersion)
+	ctx, cancel := context.WithCancel(context.Background())
+	results := f.ResolveStream(ctx, keys)
+	keys <- *deploymentKey
+	result := <-results
+	assert.NoError(t, result.Err)
+	cancel()
+	// The stream is closed without waiting for keys to be closed.
+	select {
+	case result, ok := <-results:
+		assert.False(t, ok, "unexpected result %v", result)
+	case <-time.After(10 * time.Second):
+		t.Fatal("stream wasn't closed")
+	}
+}
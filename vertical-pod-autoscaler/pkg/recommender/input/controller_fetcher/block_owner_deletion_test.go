@@ -0,0 +1,126 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBlockOwnerDeletionAsController(t *testing.T) {
+	falseVar := false
+	rsKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	deploymentKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	otherOwner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "other-deployment", BlockOwnerDeletion: &trueVar}
+
+	testCases := []struct {
+		name             string
+		owners           []metav1.OwnerReference
+		enabled          bool
+		expectedTopLevel *ControllerKeyWithAPIVersion
+		expectedInferred bool
+	}{
+		{
+			name: "blocking owner followed",
+			owners: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", BlockOwnerDeletion: &trueVar, Controller: &falseVar},
+			},
+			enabled:          true,
+			expectedTopLevel: deploymentKey,
+			expectedInferred: true,
+		},
+		{
+			name: "disabled",
+			owners: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", BlockOwnerDeletion: &trueVar},
+			},
+			expectedTopLevel: rsKey,
+		},
+		{
+			name: "more than one blocking owner",
+			owners: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", BlockOwnerDeletion: &trueVar},
+				otherOwner,
+			},
+			enabled:          true,
+			expectedTopLevel: rsKey,
+		},
+		{
+			name: "controller preferred",
+			owners: []metav1.OwnerReference{
+				otherOwner,
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", Controller: &trueVar},
+			},
+			enabled:          true,
+			expectedTopLevel: deploymentKey,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := simpleControllerFetcher()
+			f.blockOwnerDeletionAsController = tc.enabled
+			addController(f, &appsv1.ReplicaSet{
+				TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "test-rs",
+					Namespace:       "test-namespace",
+					OwnerReferences: tc.owners,
+				},
+			})
+			addController(f, &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+			})
+			result, err := f.FindTopLevelDetailed(context.Background(), rsKey)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedTopLevel, result.TopLevel)
+			assert.Equal(t, tc.expectedInferred, result.InferredOwner)
+		})
+	}
+}
+
+func TestFindTopLevelForPodBlockOwnerDeletion(t *testing.T) {
+	f := simpleControllerFetcher()
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "test-pod",
+		Namespace: "test-namespace",
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", BlockOwnerDeletion: &trueVar},
+		},
+	}}
+
+	_, err := f.FindTopLevelForPod(context.Background(), pod)
+	assert.Error(t, err)
+
+	f.blockOwnerDeletionAsController = true
+	topLevel, err := f.FindTopLevelForPod(context.Background(), pod)
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}, topLevel)
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// refreshWindowFraction is the part of the TTL before expiry, in which cached entries get refreshed.
+	refreshWindowFraction = 0.1
+)
+
+const (
+	// CacheEvictTTL is the reason of evictions of expired entries.
+	CacheEvictTTL = "ttl"
+	// CacheEvictInvalidated is the reason of evictions of entries whose controller no longer exists.
+	CacheEvictInvalidated = "invalidated"
+	// CacheEvictPurged is the reason of evictions of entries dropped when discovery information is reset.
+	CacheEvictPurged = "purged"
+)
+
+// Results of lookups in the resolution cache, the values of the result label of the cache lookups counter.
+// Lookups collapsed into a concurrent resolution of the same controller are shared.
+const (
+	cacheHit    = "hit"
+	cacheMiss   = "miss"
+	cacheShared = "shared"
+)
+
+// CacheEntry is a cached resolution: the result of a successful one, or the error of a failed one.
+type CacheEntry struct {
+	Result *FindTopLevelResult
+	Err    error
+}
+
+// Cache caches resolutions of top level controllers by the canonical key of the controller they started from,
+// see Options.Cache. It must be safe for concurrent use. Cached results must not be modified.
+type Cache interface {
+	// Get returns the entry cached for the given key, if there's one which hasn't expired.
+	Get(key ControllerKeyWithAPIVersion) (CacheEntry, bool)
+	// Set caches the given entry for the given key.
+	Set(key ControllerKeyWithAPIVersion, entry CacheEntry)
+	// Purge drops all entries. It's called whenever discovery information is reset, since entries may depend
+	// on kinds which changed since.
+	Purge()
+}
+
+type resolutionCacheEntry struct {
+	result    FindTopLevelResult
+	cachedAt  time.Time
+	expiresAt time.Time
+	refreshAt time.Time
+	// accessed is set when the entry is read, so that only entries in use get refreshed.
+	accessed bool
+}
+
+// resolutionCacheShards is the number of shards of the resolution cache. Resolutions of keys in different
+// shards don't contend on the same mutex.
+const resolutionCacheShards = 32
+
+// resolutionCache caches resolutions of top level controllers of the given controllers, and failures to
+// resolve them with a negativeTTL. Entries are sharded by a hash of the namespace and name of their key. It's
+// the default Cache.
+type resolutionCache struct {
+	ttl time.Duration
+	// negativeTTL is the time failures are cached for, failures aren't cached if it's zero.
+	negativeTTL time.Duration
+	shards      []*resolutionCacheShard
+	// onEvict is called with the key and reason of each evicted entry, outside of the mutexes. It may be nil.
+	onEvict func(key ControllerKeyWithAPIVersion, reason string)
+}
+
+type resolutionCacheShard struct {
+	mutex    sync.Mutex
+	entries  map[ControllerKeyWithAPIVersion]*resolutionCacheEntry
+	failures map[ControllerKeyWithAPIVersion]resolutionCacheFailure
+}
+
+type resolutionCacheFailure struct {
+	err       error
+	expiresAt time.Time
+}
+
+func newResolutionCache(ttl time.Duration) *resolutionCache {
+	return newShardedResolutionCache(ttl, resolutionCacheShards)
+}
+
+func newShardedResolutionCache(ttl time.Duration, shards int) *resolutionCache {
+	c := &resolutionCache{ttl: ttl}
+	for i := 0; i < shards; i++ {
+		c.shards = append(c.shards, &resolutionCacheShard{
+			entries:  make(map[ControllerKeyWithAPIVersion]*resolutionCacheEntry),
+			failures: make(map[ControllerKeyWithAPIVersion]resolutionCacheFailure),
+		})
+	}
+	return c
+}
+
+// shard returns the shard holding the entry of the given key.
+func (c *resolutionCache) shard(key ControllerKeyWithAPIVersion) *resolutionCacheShard {
+	hash := fnv.New32a()
+	hash.Write([]byte(key.Namespace))
+	hash.Write([]byte{0})
+	hash.Write([]byte(key.Name))
+	return c.shards[hash.Sum32()%uint32(len(c.shards))]
+}
+
+func (c *resolutionCache) evicted(key ControllerKeyWithAPIVersion, reason string) {
+	if c.onEvict != nil {
+		c.onEvict(key, reason)
+	}
+}
+
+// get returns the cached resolution of the given key if it hasn't expired yet.
+func (c *resolutionCache) get(key ControllerKeyWithAPIVersion, now time.Time) (*FindTopLevelResult, bool) {
+	shard := c.shard(key)
+	shard.mutex.Lock()
+	entry, found := shard.entries[key]
+	if !found {
+		shard.mutex.Unlock()
+		return nil, false
+	}
+	if !now.Before(entry.expiresAt) {
+		delete(shard.entries, key)
+		shard.mutex.Unlock()
+		c.evicted(key, CacheEvictTTL)
+		return nil, false
+	}
+	defer shard.mutex.Unlock()
+	entry.accessed = true
+	result := entry.result
+	result.TopLevel = copyKey(result.TopLevel)
+	return &result, true
+}
+
+// set caches the resolution of the given key, without the resource version of the top level controller which
+// would get stale. The entry becomes due for refresh at a jittered
+// point in the last part of its lifetime, so that refreshes of entries created together are spread out.
+func (c *resolutionCache) set(key ControllerKeyWithAPIVersion, result FindTopLevelResult, now time.Time) {
+	shard := c.shard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	result.TopLevel = copyKey(result.TopLevel)
+	result.TopLevel.ResourceVersion = ""
+	delete(shard.failures, key)
+	expiresAt := now.Add(c.ttl)
+	refreshWindow := time.Duration(float64(c.ttl) * refreshWindowFraction)
+	shard.entries[key] = &resolutionCacheEntry{
+		result:    result,
+		cachedAt:  now,
+		expiresAt: expiresAt,
+		refreshAt: expiresAt.Add(-wait.Jitter(refreshWindow/2, 1.0)),
+	}
+}
+
+// dueForRefresh returns keys of entries which were read since they were set and should be refreshed now.
+// Expired entries are dropped.
+func (c *resolutionCache) dueForRefresh(now time.Time) []ControllerKeyWithAPIVersion {
+	var keys, expired []ControllerKeyWithAPIVersion
+	for _, shard := range c.shards {
+		shard.mutex.Lock()
+		for key, entry := range shard.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(shard.entries, key)
+				expired = append(expired, key)
+				continue
+			}
+			if entry.accessed && !now.Before(entry.refreshAt) {
+				keys = append(keys, key)
+			}
+		}
+		shard.mutex.Unlock()
+	}
+	for _, key := range expired {
+		c.evicted(key, CacheEvictTTL)
+	}
+	return keys
+}
+
+// snapshot returns copies of the entries which haven't expired yet, by key.
+func (c *resolutionCache) snapshot(now time.Time) map[ControllerKeyWithAPIVersion]resolutionCacheEntry {
+	entries := make(map[ControllerKeyWithAPIVersion]resolutionCacheEntry)
+	for _, shard := range c.shards {
+		shard.mutex.Lock()
+		for key, entry := range shard.entries {
+			if now.Before(entry.expiresAt) {
+				entries[key] = *entry
+			}
+		}
+		shard.mutex.Unlock()
+	}
+	return entries
+}
+
+// invalidate drops the entry of the given key, if there's one.
+func (c *resolutionCache) invalidate(key ControllerKeyWithAPIVersion) {
+	shard := c.shard(key)
+	shard.mutex.Lock()
+	_, found := shard.entries[key]
+	delete(shard.entries, key)
+	shard.mutex.Unlock()
+	if found {
+		c.evicted(key, CacheEvictInvalidated)
+	}
+}
+
+// getFailure returns the cached failure to resolve the given key if it hasn't expired yet.
+func (c *resolutionCache) getFailure(key ControllerKeyWithAPIVersion, now time.Time) (error, bool) {
+	shard := c.shard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	failure, found := shard.failures[key]
+	if !found {
+		return nil, false
+	}
+	if !now.Before(failure.expiresAt) {
+		delete(shard.failures, key)
+		return nil, false
+	}
+	return failure.err, true
+}
+
+// setFailure caches the failure to resolve the given key, replacing its cached resolution.
+func (c *resolutionCache) setFailure(key ControllerKeyWithAPIVersion, err error, now time.Time) {
+	shard := c.shard(key)
+	shard.mutex.Lock()
+	_, found := shard.entries[key]
+	delete(shard.entries, key)
+	shard.failures[key] = resolutionCacheFailure{err: err, expiresAt: now.Add(c.negativeTTL)}
+	shard.mutex.Unlock()
+	if found {
+		c.evicted(key, CacheEvictInvalidated)
+	}
+}
+
+// Get implements Cache.
+func (c *resolutionCache) Get(key ControllerKeyWithAPIVersion) (CacheEntry, bool) {
+	now := time.Now()
+	if result, found := c.get(key, now); found {
+		return CacheEntry{Result: result}, true
+	}
+	if err, found := c.getFailure(key, now); found {
+		return CacheEntry{Err: err}, true
+	}
+	return CacheEntry{}, false
+}
+
+// Set implements Cache. Results are only cached with a ttl and failures with a negativeTTL.
+func (c *resolutionCache) Set(key ControllerKeyWithAPIVersion, entry CacheEntry) {
+	switch {
+	case entry.Err != nil && c.negativeTTL > 0:
+		c.setFailure(key, entry.Err, time.Now())
+	case entry.Err == nil && entry.Result != nil && c.ttl > 0:
+		c.set(key, *entry.Result, time.Now())
+	}
+}
+
+// Purge implements Cache.
+func (c *resolutionCache) Purge() {
+	var purged []ControllerKeyWithAPIVersion
+	for _, shard := range c.shards {
+		shard.mutex.Lock()
+		for key := range shard.entries {
+			purged = append(purged, key)
+		}
+		shard.entries = make(map[ControllerKeyWithAPIVersion]*resolutionCacheEntry)
+		shard.failures = make(map[ControllerKeyWithAPIVersion]resolutionCacheFailure)
+		shard.mutex.Unlock()
+	}
+	for _, key := range purged {
+		c.evicted(key, CacheEvictPurged)
+	}
+}
+
+// cacheableFailure tells whether the given error of a resolution may be cached. Errors which say nothing about
+// the controller, like cancellation, stopping of the fetcher and transient errors (timeouts, throttling, server and
+// network errors), aren't.
+func cacheableFailure(err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, ErrFetcherStopped) && !isTransientResolutionError(err)
+}
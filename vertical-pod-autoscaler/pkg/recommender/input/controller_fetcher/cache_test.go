@@ -0,0 +1,340 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestResolutionCacheRefresh(t *testing.T) {
+	ttl := time.Minute
+	rs := &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{Controller: &trueVar, Kind: "Deployment", Name: "deployment-a"},
+			},
+		},
+	}
+	f := simpleControllerFetcher()
+	f.resolutionCache = newResolutionCache(ttl)
+	addController(f, rs)
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "deployment-a", Namespace: "test-namespace"},
+	})
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "deployment-b", Namespace: "test-namespace"},
+	})
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}}
+	keyA := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "deployment-a", Kind: "Deployment", Namespace: "test-namespace"}}
+	keyB := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "deployment-b", Kind: "Deployment", Namespace: "test-namespace"}}
+
+	topLevel, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, keyA, topLevel)
+
+	// The ReplicaSet gets adopted by another Deployment, the cached resolution is still served.
+	adopted := rs.DeepCopy()
+	adopted.OwnerReferences[0].Name = "deployment-b"
+	addController(f, adopted)
+	topLevel, err = f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, keyA, topLevel)
+
+	// Entries aren't due for refresh early in their lifetime.
+	assert.Empty(t, f.resolutionCache.dueForRefresh(time.Now()))
+	// Refresh happens before expiry and picks up the change.
+	assert.Equal(t, []ControllerKeyWithAPIVersion{*key}, f.resolutionCache.dueForRefresh(time.Now().Add(ttl-time.Second)))
+	f.resolutionCache.shard(*key).entries[*key].refreshAt = time.Now()
+	f.refreshResolutionCache()
+	// Entries which weren't read since they were refreshed aren't refreshed again.
+	assert.Empty(t, f.resolutionCache.dueForRefresh(time.Now().Add(ttl-time.Second)))
+	topLevel, err = f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, keyB, topLevel)
+}
+
+func TestResolutionCacheEvictions(t *testing.T) {
+	ttl := time.Minute
+	type eviction struct {
+		key    ControllerKeyWithAPIVersion
+		reason string
+	}
+	var evictions []eviction
+	f := simpleControllerFetcher()
+	f.resolutionCache = newResolutionCache(ttl)
+	f.resolutionCache.onEvict = func(key ControllerKeyWithAPIVersion, reason string) {
+		evictions = append(evictions, eviction{key, reason})
+	}
+	deployment := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	}
+	addController(f, deployment)
+	key := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	_, err := f.FindTopLevel(&key)
+	assert.NoError(t, err)
+
+	// Expired entries are evicted when read.
+	_, found := f.resolutionCache.get(key, time.Now().Add(ttl))
+	assert.False(t, found)
+	assert.Equal(t, []eviction{{key, CacheEvictTTL}}, evictions)
+
+	// And when looking for entries to refresh.
+	_, err = f.FindTopLevel(&key)
+	assert.NoError(t, err)
+	assert.Empty(t, f.resolutionCache.dueForRefresh(time.Now().Add(ttl)))
+	assert.Equal(t, []eviction{{key, CacheEvictTTL}, {key, CacheEvictTTL}}, evictions)
+
+	// Entries of deleted controllers are invalidated on refresh. Until then, they're served.
+	_, err = f.FindTopLevel(&key)
+	assert.NoError(t, err)
+	f.informersMap[wellKnownController(deployment.Kind)].GetStore().Delete(deployment)
+	_, err = f.FindTopLevel(&key)
+	assert.NoError(t, err)
+	f.resolutionCache.shard(key).entries[key].refreshAt = time.Now()
+	f.refreshResolutionCache()
+	assert.Equal(t, []eviction{{key, CacheEvictTTL}, {key, CacheEvictTTL}, {key, CacheEvictInvalidated}}, evictions)
+	_, err = f.FindTopLevel(&key)
+	assert.Error(t, err)
+}
+
+func TestResolutionCacheShards(t *testing.T) {
+	c := newResolutionCache(time.Minute)
+	now := time.Now()
+	var keys []ControllerKeyWithAPIVersion
+	shards := make(map[*resolutionCacheShard]bool)
+	for i := 0; i < 100; i++ {
+		key := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "test-deployment", Kind: "Deployment", Namespace: fmt.Sprintf("test-namespace-%d", i)}}
+		keys = append(keys, key)
+		shards[c.shard(key)] = true
+		c.set(key, FindTopLevelResult{TopLevel: &key}, now)
+	}
+	assert.True(t, len(shards) > 1, "all keys in one shard")
+	for _, key := range keys {
+		result, found := c.get(key, now)
+		if assert.True(t, found) {
+			assert.Equal(t, key, *result.TopLevel)
+		}
+	}
+	assert.Len(t, c.snapshot(now), len(keys))
+	c.invalidate(keys[0])
+	assert.Len(t, c.snapshot(now), len(keys)-1)
+}
+
+// BenchmarkResolutionCacheParallel compares a single mutex with the sharded cache, reading and writing entries
+// of many namespaces from many goroutines.
+func BenchmarkResolutionCacheParallel(b *testing.B) {
+	var keys []ControllerKeyWithAPIVersion
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "test-deployment", Kind: "Deployment", Namespace: fmt.Sprintf("test-namespace-%d", i)}})
+	}
+	for _, shards := range []int{1, resolutionCacheShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			c := newShardedResolutionCache(time.Hour, shards)
+			now := time.Now()
+			for i := range keys {
+				c.set(keys[i], FindTopLevelResult{TopLevel: &keys[i]}, now)
+			}
+			var seed int64
+			b.SetParallelism(64)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				// Each goroutine walks the keys from its own offset, so that they don't share a counter.
+				i := int(atomic.AddInt64(&seed, 97))
+				for pb.Next() {
+					i++
+					key := keys[i%len(keys)]
+					if _, found := c.get(key, now); !found {
+						c.set(key, FindTopLevelResult{TopLevel: &key}, now)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestNegativeResolutionCache(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.resolutionCache = newResolutionCache(time.Minute)
+	f.resolutionCache.negativeTTL = time.Minute
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	_, err := f.FindTopLevel(key)
+	assert.True(t, errors.Is(err, ErrControllerNotFound), "unexpected error: %v", err)
+
+	// The failure is served until it expires, although the Deployment exists now.
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	_, err = f.FindTopLevel(key)
+	assert.True(t, errors.Is(err, ErrControllerNotFound), "unexpected error: %v", err)
+	_, found := f.resolutionCache.getFailure(*key, time.Now().Add(time.Minute))
+	assert.False(t, found)
+
+	// Resetting discovery information purges the cache.
+	f.resetMapper()
+	topLevel, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, topLevel)
+	entry, found := f.resolutionCache.Get(*key)
+	assert.True(t, found)
+	assert.NoError(t, entry.Err)
+
+	// A failure replaces the cached resolution.
+	f.resolutionCache.Set(*key, CacheEntry{Err: ErrControllerNotFound})
+	entry, found = f.resolutionCache.Get(*key)
+	assert.True(t, found)
+	assert.Equal(t, ErrControllerNotFound, entry.Err)
+	assert.Empty(t, f.resolutionCache.snapshot(time.Now()))
+}
+
+func TestCacheableFailure(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		cacheable bool
+	}{
+		{fmt.Errorf("%w: Deployment test-namespace/test-deployment", ErrControllerNotFound), true},
+		{ErrOwnershipCycle, true},
+		{&ResolutionTimeoutError{}, false},
+		{context.Canceled, false},
+		{ErrFetcherStopped, false},
+		{k8serrors.NewTooManyRequests("throttled", 1), false},
+		{k8serrors.NewServiceUnavailable("unavailable"), false},
+		{context.DeadlineExceeded, false},
+	} {
+		assert.Equal(t, tc.cacheable, cacheableFailure(tc.err), "error: %v", tc.err)
+	}
+}
+
+func TestNegativeResolutionCacheSkipsServerErrors(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	widgets := schema.GroupResource{Group: "example.com", Resource: "widgets"}
+	scales := newFakeScalesGetter()
+	scales.add(widgets, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-widget", Namespace: "test-namespace"},
+	})
+	scales.unavailable = map[scaleKey]int{{widgets, "test-namespace", "test-widget"}: 1}
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.resolutionCache = newResolutionCache(time.Minute)
+	f.resolutionCache.negativeTTL = time.Minute
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+
+	_, err := f.FindTopLevel(key)
+	assert.True(t, isTransientResolutionError(err), "unexpected error: %v", err)
+	_, found := f.resolutionCache.getFailure(*key, time.Now())
+	assert.False(t, found)
+
+	// The next resolution reads the scale again instead of serving the 503.
+	topLevel, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, topLevel)
+	assert.Equal(t, 2, scales.gets)
+}
+
+// mapCache is a Cache keeping entries forever.
+type mapCache struct {
+	mutex   sync.Mutex
+	entries map[ControllerKeyWithAPIVersion]CacheEntry
+	purges  int
+}
+
+func (c *mapCache) Get(key ControllerKeyWithAPIVersion) (CacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, found := c.entries[key]
+	return entry, found
+}
+
+func (c *mapCache) Set(key ControllerKeyWithAPIVersion, entry CacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[key] = entry
+}
+
+func (c *mapCache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[ControllerKeyWithAPIVersion]CacheEntry)
+	c.purges++
+}
+
+func TestCustomCache(t *testing.T) {
+	cache := &mapCache{entries: make(map[ControllerKeyWithAPIVersion]CacheEntry)}
+	f := simpleControllerFetcher()
+	f.cache = cache
+	deployment := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	}
+	addController(f, deployment)
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	missingKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	_, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	_, err = f.FindTopLevel(missingKey)
+	assert.Error(t, err)
+	assert.Len(t, cache.entries, 2)
+
+	// Cached resolutions are served after the Deployment is deleted, and can't be modified by callers.
+	f.informersMap[wellKnownController(deployment.Kind)].GetStore().Delete(deployment)
+	topLevel, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, topLevel)
+	topLevel.Name = "modified"
+	topLevel, err = f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, topLevel)
+
+	f.resetMapper()
+	assert.Equal(t, 1, cache.purges)
+	_, err = f.FindTopLevel(key)
+	assert.True(t, errors.Is(err, ErrControllerNotFound), "unexpected error: %v", err)
+}
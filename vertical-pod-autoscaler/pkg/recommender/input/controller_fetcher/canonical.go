@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"strings"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// groupAliases maps alternative spellings of API groups to the groups served by the API server.
+var groupAliases = map[string]string{
+	"core":         "",
+	"apps.k8s.io":  "apps",
+	"batch.k8s.io": "batch",
+}
+
+// KeyCanonicalizer normalizes the kind and API version of each controller entering resolution, so that
+// controllers referred to in different ways are resolved and cached as one.
+type KeyCanonicalizer interface {
+	// Canonicalize returns the canonical form of the given kind. mapper is nil for fetchers without one.
+	Canonicalize(mapper apimeta.RESTMapper, kind schema.GroupVersionKind) schema.GroupVersionKind
+}
+
+// DefaultKeyCanonicalizer resolves aliases of API groups, takes the capitalization of kinds from the RESTMapper
+// and replaces versions the RESTMapper doesn't know with the preferred version of the group. Kinds without
+// a group and version are left alone, since they can't be told apart from kinds of other groups.
+type DefaultKeyCanonicalizer struct{}
+
+// Canonicalize implements KeyCanonicalizer.
+func (DefaultKeyCanonicalizer) Canonicalize(mapper apimeta.RESTMapper, kind schema.GroupVersionKind) schema.GroupVersionKind {
+	if kind.Group == "" && kind.Version == "" {
+		return kind
+	}
+	if group, found := groupAliases[kind.Group]; found {
+		kind.Group = group
+	}
+	if mapper == nil {
+		return kind
+	}
+	resource := schema.GroupVersionResource{Group: kind.Group, Resource: strings.ToLower(kind.Kind)}
+	if mapped, err := mapper.KindFor(resource); err == nil {
+		kind.Kind = mapped.Kind
+	}
+	groupKind := kind.GroupKind()
+	if _, err := mapper.RESTMapping(groupKind, kind.Version); err != nil {
+		if mapping, err := mapper.RESTMapping(groupKind); err == nil {
+			kind.Version = mapping.GroupVersionKind.Version
+		}
+	}
+	return kind
+}
+
+// canonicalKey returns the given key with its kind and API version canonicalized. Keys referring to a scale
+// subresource are replaced with the resource it belongs to first, then kind aliases are replaced. Results are
+// cached until the mapper is reset.
+func (f *controllerFetcher) canonicalKey(key ControllerKeyWithAPIVersion) ControllerKeyWithAPIVersion {
+	key = f.parentOfScaleReference(key)
+	groupVersion, err := schema.ParseGroupVersion(key.ApiVersion)
+	if err != nil {
+		return key
+	}
+	kind := groupVersion.WithKind(key.Kind)
+	f.scaleMappingsMutex.Lock()
+	canonical, found := f.canonicalKinds[kind]
+	f.scaleMappingsMutex.Unlock()
+	if !found {
+		canonicalizer := f.keyCanonicalizer
+		if canonicalizer == nil {
+			canonicalizer = DefaultKeyCanonicalizer{}
+		}
+		canonical = canonicalizer.Canonicalize(f.mapper, f.unaliasedKind(kind))
+		f.scaleMappingsMutex.Lock()
+		if f.canonicalKinds == nil {
+			f.canonicalKinds = make(map[schema.GroupVersionKind]schema.GroupVersionKind)
+		}
+		f.canonicalKinds[kind] = canonical
+		f.scaleMappingsMutex.Unlock()
+	}
+	if canonical != kind {
+		key.Kind = canonical.Kind
+		key.ApiVersion = canonical.GroupVersion().String()
+	}
+	return key
+}
+
+// unaliasedKind returns the given kind with its GroupKind replaced if it's an alias, see Options.KindAliases.
+func (f *controllerFetcher) unaliasedKind(kind schema.GroupVersionKind) schema.GroupVersionKind {
+	if groupKind, found := f.kindAliases[kind.GroupKind()]; found {
+		return groupKind.WithVersion(kind.Version)
+	}
+	return kind
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newAppsRESTMapper() apimeta.RESTMapper {
+	appsV1 := schema.GroupVersion{Group: "apps", Version: "v1"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{appsV1})
+	mapper.Add(appsV1.WithKind("Deployment"), apimeta.RESTScopeNamespace)
+	mapper.Add(appsV1.WithKind("ReplicaSet"), apimeta.RESTScopeNamespace)
+	return mapper
+}
+
+func TestDefaultKeyCanonicalizer(t *testing.T) {
+	mapper := newAppsRESTMapper()
+	deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	testCases := []struct {
+		name     string
+		mapper   apimeta.RESTMapper
+		kind     schema.GroupVersionKind
+		expected schema.GroupVersionKind
+	}{
+		{"canonical", mapper, deployment, deployment},
+		{"lower case kind", mapper, schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "deployment"}, deployment},
+		{"upper case kind", mapper, schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DEPLOYMENT"}, deployment},
+		{"alias group", mapper, schema.GroupVersionKind{Group: "apps.k8s.io", Version: "v1", Kind: "Deployment"}, deployment},
+		{"unknown version", mapper, schema.GroupVersionKind{Group: "apps", Version: "v1beta2", Kind: "Deployment"}, deployment},
+		{"alias group without mapper", nil, schema.GroupVersionKind{Group: "apps.k8s.io", Version: "v1", Kind: "Deployment"},
+			deployment},
+		{"no API version", mapper, schema.GroupVersionKind{Kind: "deployment"}, schema.GroupVersionKind{Kind: "deployment"}},
+		{"unknown kind", mapper, schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "widget"},
+			schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "widget"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, DefaultKeyCanonicalizer{}.Canonicalize(tc.mapper, tc.kind))
+		})
+	}
+}
+
+func TestFindTopLevelCanonicalizesKeys(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.mapper = newAppsRESTMapper()
+	f.resolutionCache = newResolutionCache(time.Minute)
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps.k8s.io/v1", Kind: "deployment", Name: "test-deployment", Controller: &trueVar},
+			},
+		},
+	})
+	expected := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+
+	for _, key := range []*ControllerKeyWithAPIVersion{
+		{ControllerKey: ControllerKey{Name: "test-rs", Kind: "replicaset", Namespace: "test-namespace"}, ApiVersion: "apps/v1"},
+		{ControllerKey: ControllerKey{Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps.k8s.io/v1"},
+	} {
+		topLevel, err := f.FindTopLevel(key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, topLevel)
+	}
+	// Both spellings share the cache entry of the canonical key.
+	_, found := f.resolutionCache.get(ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}, time.Now())
+	assert.True(t, found)
+	assert.Len(t, f.resolutionCache.snapshot(time.Now()), 1)
+}
+
+func TestFindTopLevelKindAliases(t *testing.T) {
+	widgetKind := schema.GroupKind{Group: "example.com", Kind: "Widget"}
+	deprecatedKind := schema.GroupKind{Group: "widgets.legacy.example.com", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{{Group: "example.com", Version: "v1"}})
+	mapper.Add(widgetKind.WithVersion("v1"), apimeta.RESTScopeNamespace)
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.customInformers = map[schema.GroupKind]cache.SharedIndexInformer{widgetKind: newCustomInformer()}
+	f.kindAliases = map[schema.GroupKind]schema.GroupKind{deprecatedKind: widgetKind}
+	f.customInformers[widgetKind].GetStore().Add(newUnstructured("example.com/v1", "Widget", "test-namespace", "test-widget"))
+	// The Deployment was created by the operator before the migration.
+	addController(f, &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-deployment",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "widgets.legacy.example.com/v1alpha1", Kind: "Widget", Name: "test-widget", Controller: &trueVar},
+			},
+		},
+	})
+
+	expected := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	for _, key := range []*ControllerKeyWithAPIVersion{
+		{ControllerKey: ControllerKey{Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"},
+			ApiVersion: "widgets.legacy.example.com/v1alpha1"},
+		{ControllerKey: ControllerKey{Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"},
+			ApiVersion: "apps/v1"},
+	} {
+		topLevel, err := f.FindTopLevel(key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, topLevel)
+	}
+}
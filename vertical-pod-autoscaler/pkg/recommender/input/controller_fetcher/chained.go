@@ -0,0 +1,40 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"errors"
+)
+
+type chainedControllerFetcher struct {
+	primary  ControllerFetcher
+	fallback ControllerFetcher
+}
+
+// NewChainedControllerFetcher returns a ControllerFetcher which resolves controllers with the primary fetcher
+// and, if it returns ErrControllerNotFound, with the fallback one.
+func NewChainedControllerFetcher(primary, fallback ControllerFetcher) ControllerFetcher {
+	return &chainedControllerFetcher{primary: primary, fallback: fallback}
+}
+
+func (f *chainedControllerFetcher) FindTopLevel(key *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error) {
+	topLevel, err := f.primary.FindTopLevel(key)
+	if !errors.Is(err, ErrControllerNotFound) {
+		return topLevel, err
+	}
+	return f.fallback.FindTopLevel(key)
+}
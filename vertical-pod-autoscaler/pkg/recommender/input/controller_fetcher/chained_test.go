@@ -0,0 +1,63 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestChainedControllerFetcher(t *testing.T) {
+	local := simpleControllerFetcher()
+	addController(local, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "local-deployment", Namespace: "test-namespace"},
+	})
+	remote := simpleControllerFetcher()
+	addController(remote, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "remote-deployment", Namespace: "test-namespace"},
+	})
+	server := httptest.NewServer(NewResolutionServer(remote))
+	defer server.Close()
+	f := NewChainedControllerFetcher(local, NewRemoteControllerFetcher(server.URL, server.Client()))
+
+	for _, name := range []string{"local-deployment", "remote-deployment"} {
+		key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: name, Kind: "Deployment", Namespace: "test-namespace"}}
+		topLevel, err := f.FindTopLevel(key)
+		assert.NoError(t, err)
+		assert.Equal(t, key, topLevel)
+	}
+
+	_, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-deployment", Kind: "Deployment", Namespace: "test-namespace"}})
+	assert.True(t, errors.Is(err, ErrControllerNotFound), "unexpected error: %v", err)
+
+	// Other errors of the primary fetcher aren't retried.
+	_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "remote-deployment", Kind: "Deployment"}})
+	assert.True(t, errors.Is(err, ErrMissingNamespace), "unexpected error: %v", err)
+	var resolutionErr *ResolutionError
+	assert.False(t, errors.As(err, &resolutionErr))
+}
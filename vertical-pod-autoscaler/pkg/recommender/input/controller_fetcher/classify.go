@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// TargetClass tells how pods of a target can be updated, for choosing the update mode of its VPA.
+type TargetClass string
+
+const (
+	// TargetScalable targets are resolved to a controller with a scale subresource, which recreates evicted
+	// pods.
+	TargetScalable TargetClass = "Scalable"
+	// TargetDaemonSetLike targets are resolved to a running controller which recreates evicted pods, but has no
+	// (known) scale subresource, e.g. DaemonSets.
+	TargetDaemonSetLike TargetClass = "DaemonSetLike"
+	// TargetJobLike targets are resolved to a controller whose pods run to completion and can't be updated,
+	// e.g. Jobs, CronJobs and custom controllers which have completed.
+	TargetJobLike TargetClass = "JobLike"
+	// TargetStandalone targets are pods which aren't managed by any controller.
+	TargetStandalone TargetClass = "Standalone"
+	// TargetUnsupported targets aren't workloads, e.g. Services.
+	TargetUnsupported TargetClass = "Unsupported"
+)
+
+func (f *controllerFetcher) ClassifyTarget(ctx context.Context, key *ControllerKeyWithAPIVersion) (TargetClass, error) {
+	if key == nil {
+		return "", nil
+	}
+	groupVersion, err := schema.ParseGroupVersion(key.ApiVersion)
+	if err != nil {
+		return "", err
+	}
+	if key.Kind == "Pod" && groupVersion.Group == "" {
+		return TargetStandalone, nil
+	}
+	res, err := f.findTopLevel(ctx, key)
+	if errors.Is(err, ErrNonWorkloadTarget) {
+		return TargetUnsupported, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	topLevel := *res.topLevel
+	groupVersion, err = schema.ParseGroupVersion(topLevel.ApiVersion)
+	if err != nil {
+		return "", err
+	}
+	if groupVersion.Group == "" || groupVersion.Group == batchv1.GroupName {
+		if topLevel.Kind == string(job) || topLevel.Kind == "CronJob" {
+			return TargetJobLike, nil
+		}
+	}
+	if isCompleted(res.controller.object) {
+		return TargetJobLike, nil
+	}
+	if f.isScalable(topLevel, res.controller) {
+		return TargetScalable, nil
+	}
+	return TargetDaemonSetLike, nil
+}
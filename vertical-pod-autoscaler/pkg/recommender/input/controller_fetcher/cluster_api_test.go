@@ -0,0 +1,79 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const clusterAPIVersion = "cluster.x-k8s.io/v1beta1"
+
+func TestFindTopLevelClusterAPI(t *testing.T) {
+	groupVersion := schema.GroupVersion{Group: "cluster.x-k8s.io", Version: "v1beta1"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{groupVersion})
+	for _, kind := range []string{"MachineDeployment", "MachineSet", "Machine"} {
+		mapper.Add(groupVersion.WithKind(kind), apimeta.RESTScopeNamespace)
+	}
+	machineDeployments := schema.GroupResource{Group: "cluster.x-k8s.io", Resource: "machinedeployments"}
+	machineSets := schema.GroupResource{Group: "cluster.x-k8s.io", Resource: "machinesets"}
+	machines := schema.GroupResource{Group: "cluster.x-k8s.io", Resource: "machines"}
+
+	// The scale subresource of the Machine carries its owner, the one of the MachineSet doesn't.
+	scales := newFakeScalesGetter()
+	scales.add(machines, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: clusterAPIVersion, Kind: "MachineSet", Name: "test-ms", Controller: &trueVar},
+			}},
+	})
+	scales.add(machineSets, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ms", Namespace: "test-namespace"},
+	})
+	scales.add(machineDeployments, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-md", Namespace: "test-namespace"},
+	})
+	dynamicClient := newFakeDynamicClient()
+	dynamicClient.add(machineSets, newUnstructured(clusterAPIVersion, "MachineSet", "test-namespace", "test-ms",
+		metav1.OwnerReference{APIVersion: clusterAPIVersion, Kind: "MachineDeployment", Name: "test-md", Controller: &trueVar}))
+	dynamicClient.add(machineDeployments, newUnstructured(clusterAPIVersion, "MachineDeployment", "test-namespace", "test-md"))
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	machineKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-machine", Kind: "Machine", Namespace: "test-namespace"}, ApiVersion: clusterAPIVersion}
+
+	// Without the dynamic client resolution stops at the MachineSet.
+	topLevel, err := f.FindTopLevel(machineKey)
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-ms", Kind: "MachineSet", Namespace: "test-namespace"}, ApiVersion: clusterAPIVersion}, topLevel)
+
+	f.dynamicClient = dynamicClient
+	res, err := f.findTopLevel(context.Background(), machineKey)
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-md", Kind: "MachineDeployment", Namespace: "test-namespace"}, ApiVersion: clusterAPIVersion}, res.topLevel)
+	assert.Equal(t, []ResolutionPath{ScalePath, ScalePath, ScalePath}, res.paths)
+}
@@ -17,25 +17,35 @@ limitations under the License.
 package controllerfetcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
+	metrics_recommender "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/recommender"
 	"k8s.io/client-go/discovery"
-	cacheddiscovery "k8s.io/client-go/discovery/cached"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	kube_client "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/scale"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog"
 )
 
@@ -52,8 +62,46 @@ const (
 
 var wellKnownControllers = []wellKnownController{daemonSet, deployment, replicaSet, statefulSet, replicationController, job}
 
+// legacyWellKnownControllerKinds are well-known controllers in the groups which served them before their
+// current one. targetRefs and owner references still refer to them there, e.g. extensions/v1beta1, and they're
+// read from the same informers. Legacy versions of the current group (apps/v1beta1, apps/v1beta2) need no entry.
+var legacyWellKnownControllerKinds = map[schema.GroupKind]bool{
+	{Group: "extensions", Kind: "DaemonSet"}:  true,
+	{Group: "extensions", Kind: "Deployment"}: true,
+	{Group: "extensions", Kind: "ReplicaSet"}: true,
+}
+
+// nonWorkloadKinds have owners but aren't workloads, so they never are a valid target.
+var nonWorkloadKinds = map[schema.GroupKind]bool{
+	{Group: "", Kind: "Service"}:                            true,
+	{Group: "", Kind: "Endpoints"}:                          true,
+	{Group: "discovery.k8s.io", Kind: "EndpointSlice"}:      true,
+	{Group: "", Kind: "ConfigMap"}:                          true,
+	{Group: "", Kind: "Secret"}:                             true,
+	{Group: "", Kind: "ServiceAccount"}:                     true,
+	{Group: "", Kind: "PersistentVolumeClaim"}:              true,
+	{Group: "networking.k8s.io", Kind: "Ingress"}:           true,
+	{Group: "extensions", Kind: "Ingress"}:                  true,
+	{Group: "policy", Kind: "PodDisruptionBudget"}:          true,
+	{Group: "autoscaling", Kind: "HorizontalPodAutoscaler"}: true,
+	nodeKind: true,
+}
+
+// nonWorkloadOwnerKinds are set as (controller) owners of workloads by deployment tools, but don't manage Pods.
+// They are never followed, the workload they own is the top level controller. The same goes for nonWorkloadKinds.
+var nonWorkloadOwnerKinds = map[schema.GroupKind]bool{
+	{Group: "helm.toolkit.fluxcd.io", Kind: "HelmRelease"}:        true,
+	{Group: "helm.fluxcd.io", Kind: "HelmRelease"}:                true,
+	{Group: "kustomize.toolkit.fluxcd.io", Kind: "Kustomization"}: true,
+	{Group: "argoproj.io", Kind: "Application"}:                   true,
+}
+
 const (
 	discoveryResetPeriod time.Duration = 5 * time.Minute
+	// informersResyncPeriod is the resync period of informers created by the fetcher itself.
+	informersResyncPeriod time.Duration = 10 * time.Minute
+	// minMapperResetInterval limits how often the mapper is reset because of stale mappings.
+	minMapperResetInterval time.Duration = 30 * time.Second
 )
 
 // ControllerKey identifies a controller.
@@ -67,6 +115,10 @@ type ControllerKey struct {
 type ControllerKeyWithAPIVersion struct {
 	ControllerKey
 	ApiVersion string
+	// ResourceVersion of the controller. It's only set on top level controllers returned by the fetcher
+	// which were read from an informer or the API server, so that callers can cheaply detect changes.
+	// It's empty otherwise, e.g. when the result comes from the resolution cache.
+	ResourceVersion string
 }
 
 // ControllerFetcher is responsible for finding the top level controller
@@ -75,191 +127,1773 @@ type ControllerFetcher interface {
 	FindTopLevel(controller *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error)
 }
 
+// ExtendedControllerFetcher is a ControllerFetcher which also supports less common ways of resolving controllers.
+type ExtendedControllerFetcher interface {
+	ControllerFetcher
+	// FindAllTopLevels returns all distinct top level controllers. It differs from FindTopLevel for controllers
+	// with several owners of which none is flagged as the controller: each of the owners is resolved independently.
+	FindAllTopLevels(ctx context.Context, controller *ControllerKeyWithAPIVersion) ([]*ControllerKeyWithAPIVersion, error)
+	// FindTopLevelWithContext is FindTopLevel which stops following owners once the context is done.
+	FindTopLevelWithContext(ctx context.Context, controller *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error)
+	// FindTopLevelDetailed is FindTopLevelWithContext which also reports how the top level controller was
+	// resolved.
+	FindTopLevelDetailed(ctx context.Context, controller *ControllerKeyWithAPIVersion) (*FindTopLevelResult, error)
+	// FindAncestors returns the controllers from the given one up to its top level controller, which is the last
+	// one. It shares the controllers read with FindTopLevel, so calling both for the same controller reads each
+	// controller once if caching is enabled. Options.NameTransformer isn't applied.
+	FindAncestors(ctx context.Context, controller *ControllerKeyWithAPIVersion) ([]ControllerKeyWithAPIVersion, error)
+	// FindScalableAncestor returns the nearest controller with a scale subresource, starting from the given
+	// controller itself, instead of the top level one. ErrNoScalableAncestor is returned if there's none.
+	FindScalableAncestor(ctx context.Context, controller *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error)
+	// FindTopLevelByUID returns the top level controller of the controller with the given UID. The controller
+	// is looked up in the informers of the fetcher, either directly or through the owner references of
+	// controllers it owns. With Options.WatchPods, the UID may also be the one of a Pod. ErrUIDNotFound is
+	// returned if it isn't found.
+	FindTopLevelByUID(ctx context.Context, namespace string, uid types.UID) (*ControllerKeyWithAPIVersion, error)
+	// FindTopLevelForPod returns top level controller of the given Pod. Pods without a controller fail with
+	// ErrNoController, or resolve to themselves if Options.AllowStandalonePods is set.
+	FindTopLevelForPod(ctx context.Context, pod *corev1.Pod) (*ControllerKeyWithAPIVersion, error)
+	// FindTopLevelDetailedForPod is FindTopLevelForPod returning a FindTopLevelResult, which holds the ordinal
+	// of Pods of StatefulSets and the completion index of Pods of Indexed Jobs.
+	FindTopLevelDetailedForPod(ctx context.Context, pod *corev1.Pod) (*FindTopLevelResult, error)
+	// FindTopLevelForPodName is FindTopLevelForPod for a Pod read from the Pod informer. It fails with
+	// ErrPodInformerDisabled unless Options.WatchPods is set.
+	FindTopLevelForPodName(ctx context.Context, namespace, name string) (*ControllerKeyWithAPIVersion, error)
+	// TopLevelSelector returns the label selector of the top level controller. ErrNoSelector is returned
+	// if the top level controller doesn't define one.
+	TopLevelSelector(ctx context.Context, controller *ControllerKeyWithAPIVersion) (labels.Selector, error)
+	// PrimeCache resolves the given controllers once, populating the caches of the fetcher, e.g. with targets
+	// of all VPAs at startup. Errors are only logged.
+	PrimeCache(ctx context.Context, controllers []ControllerKeyWithAPIVersion)
+	// ResolveAsync resolves the given controller in the background and returns immediately. Resolutions failing
+	// with transient errors (throttling, server errors, timeouts) are retried with exponential backoff, so that
+	// an API server hiccup doesn't fail the caller. The callback is called once, from a background goroutine,
+	// with the top level controller or the error resolution permanently failed with. It's called with
+	// ErrFetcherStopped if the fetcher is stopped first.
+	ResolveAsync(key ControllerKeyWithAPIVersion, callback func(*ControllerKeyWithAPIVersion, error))
+	// FindTopLevelBatch resolves the given controllers concurrently within the time budget of options and
+	// returns their results in the same order. Keys not resolved by the deadline of the batch fail with
+	// context.DeadlineExceeded, results of the others are kept.
+	FindTopLevelBatch(ctx context.Context, controllers []ControllerKeyWithAPIVersion, options BatchOptions) []BatchResult
+	// ResolveStream resolves the controllers received from keys concurrently, as many at a time as PrimeCache,
+	// and sends each result as soon as it's resolved, in completion order. It's meant for resolving more
+	// controllers than fit in memory at once. The returned channel is closed once keys is closed and all
+	// controllers are resolved, or once ctx is done and reads in flight return, dropping their results.
+	ResolveStream(ctx context.Context, keys <-chan ControllerKeyWithAPIVersion) <-chan BatchResult
+	// DumpCache serializes the resolutions in the resolution cache as a JSON array, e.g. for support bundles.
+	// Each entry holds the input key, the resolved top level controller, how it was resolved and when the
+	// entry was cached and expires. The array is empty if caching is disabled.
+	DumpCache() ([]byte, error)
+	// DiagnoseKeys resolves each of the given controllers, bypassing the caches, and reports how
+	// resolution went.
+	DiagnoseKeys(ctx context.Context, controllers []ControllerKeyWithAPIVersion) []Diagnosis
+	// IsMutableTopLevel tells whether the given top level controller can have its pods updated. Jobs and
+	// controllers which have completed, as told by their status in the informer, are immutable.
+	IsMutableTopLevel(controller *ControllerKeyWithAPIVersion) (bool, error)
+	// ClassifyTarget resolves the given target and tells how pods of its top level controller can be updated,
+	// see TargetClass. Targets which aren't workloads are TargetUnsupported rather than an error.
+	ClassifyTarget(ctx context.Context, target *ControllerKeyWithAPIVersion) (TargetClass, error)
+	// DroppedResolveEvents returns the number of resolve events dropped because the OnResolve callback
+	// didn't keep up.
+	DroppedResolveEvents() uint64
+	// DroppedAuditRecords returns the number of resolutions not recorded because the AuditSink didn't
+	// keep up.
+	DroppedAuditRecords() uint64
+	// RegisterController adds an informer reading controllers of the given kind, e.g. of a CRD installed
+	// after the fetcher was created, as if it was passed in Options.CustomInformers. The informer is started
+	// and synced before it's used. It's safe to call while controllers are being resolved.
+	RegisterController(groupKind schema.GroupKind, informer cache.SharedIndexInformer) error
+	// FindTopLevelWithHPA returns the top level controller of the given controller together with the
+	// HorizontalPodAutoscaler scaling it, if there's one. Callers use it to warn about VPA and HPA acting on the
+	// same metrics. If several HPAs target the controller, the first by name is returned. It fails with
+	// ErrHPAInformerDisabled unless Options.WatchHPAs is set.
+	FindTopLevelWithHPA(ctx context.Context, key *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, *autoscalingv2beta1.HorizontalPodAutoscaler, error)
+	// HPAsTargeting returns the HorizontalPodAutoscalers whose scaleTargetRef is the given controller, sorted by
+	// name, without resolving it. The versions of the controller and of the references don't need to match.
+	// It fails with ErrHPAInformerDisabled unless Options.WatchHPAs is set.
+	HPAsTargeting(ctx context.Context, key *ControllerKeyWithAPIVersion) ([]*autoscalingv2beta1.HorizontalPodAutoscaler, error)
+	// RecentResolutions returns the ownership depth of the last resolutions, oldest first, for alerting on
+	// chains unexpectedly deep for their kind. Cached resolutions aren't included. The depth of all
+	// resolutions is also recorded in a histogram by the GroupKind of the top level controller.
+	RecentResolutions() []ResolutionDepth
+	// RecentErrors returns the last failed resolutions of top level controllers, oldest first, for triaging
+	// what's currently failing, e.g. through a RecentErrorsHandler. Cached failures aren't included. It holds
+	// Options.RecentErrorsSize errors.
+	RecentErrors() []RecentError
+	// InformerStaleness returns, by kind, the time each informer of well-known controllers has been failing to list
+	// or watch, measured from its last event, zero for informers which don't fail; see
+	// Options.MaxInformerStaleness.
+	InformerStaleness() map[string]time.Duration
+	// SyncStatus returns, by kind, the status of each informer of well-known controllers: whether it's synced,
+	// when it last received an event and its last list or watch error. Informers created by the fetcher report
+	// their errors directly, also when they're registered in the factory. Errors of informers other users of
+	// the factory created first (see Options.InformerTransform) are taken from utilruntime.ErrorHandlers, to
+	// which this package adds a handler when it's loaded; reflectors only name the type of objects there, so
+	// errors of other informers of that type in the process are reported for them too.
+	SyncStatus() map[string]InformerSyncStatus
+	// Healthy returns false with a human-readable reason if nearly all controllers resolved within
+	// Options.HealthWindow failed to resolve, e.g. because the fetcher isn't allowed to read them. Controllers
+	// which don't exist or aren't workloads don't count as failures. It's always true without a HealthWindow.
+	Healthy() (bool, string)
+	// Stop stops all background work of the fetcher.
+	Stop()
+}
+
 type controllerFetcher struct {
 	scaleNamespacer scale.ScalesGetter
 	mapper          apimeta.RESTMapper
 	informersMap    map[wellKnownController]cache.SharedIndexInformer
+	// informersFiltered is set if informers in informersMap only hold controllers matching selectors, so that
+	// controllers missing from them have to be read from the API server.
+	informersFiltered bool
+	// podInformer holds all Pods, it's nil unless Options.WatchPods is set.
+	podInformer cache.SharedIndexInformer
+	// reader reads well-known controllers for fetchers without informers of their own, it may be nil.
+	reader ObjectReader
+	// hpaInformer holds all HorizontalPodAutoscalers, it's nil unless Options.WatchHPAs is set.
+	hpaInformer cache.SharedIndexInformer
+	// kubeClient is used to read well-known controllers which don't have an informer.
+	kubeClient kube_client.Interface
+	// dynamicClient is used to read owners of controllers whose scale subresource doesn't carry them.
+	dynamicClient dynamic.Interface
+	// customInformers are used to read controllers which aren't well-known. RegisterController replaces the
+	// map instead of modifying it, so it's guarded by informersMutex, unlike informersMap which never changes.
+	customInformers map[schema.GroupKind]cache.SharedIndexInformer
+	informersMutex  sync.RWMutex
+	terminalKinds   map[schema.GroupKind]bool
+	// nonWorkloadKinds extends the package level nonWorkloadKinds.
+	nonWorkloadKinds map[schema.GroupKind]bool
+	// nonWorkloadOwnerKinds extends the package level nonWorkloadOwnerKinds.
+	nonWorkloadOwnerKinds map[schema.GroupKind]bool
+	// scaleTargetRefExtractors are used to follow controllers without owners, see
+	// Options.ScaleTargetRefExtractors.
+	scaleTargetRefExtractors map[schema.GroupKind]ScaleTargetRefExtractor
+	// scalePathKinds are always read through the scale subresource.
+	scalePathKinds map[schema.GroupKind]bool
+	// disableScaleResolution makes controllers which would be read through the scale subresource top level.
+	disableScaleResolution bool
+	// resolutionPolicy decides how controllers are read, DefaultResolutionPolicy is used if it's nil.
+	resolutionPolicy ResolutionPolicy
+	// keyCanonicalizer normalizes keys entering resolution, DefaultKeyCanonicalizer is used if it's nil.
+	keyCanonicalizer KeyCanonicalizer
+	// freshScaleReads keeps controllers read through the scale subresource out of the step cache, see
+	// Options.FreshScaleReads.
+	freshScaleReads bool
+	// kindAliases replace GroupKinds before canonicalization, see Options.KindAliases.
+	kindAliases map[schema.GroupKind]schema.GroupKind
+	// resolutionCache is nil if caching of resolved top level controllers is disabled, or if cache is set.
+	resolutionCache *resolutionCache
+	// cache replaces resolutionCache if it's set, see Options.Cache.
+	cache Cache
+	// stepCache is nil if caching of controllers read from the API server during resolution is disabled. It's
+	// enabled together with resolutionCache.
+	stepCache *stepCache
+	// eagerQueue and eagerInformers are set if resolutions of well-known controllers are preloaded, see
+	// Options.EagerCache.
+	eagerQueue     workqueue.Interface
+	eagerInformers map[wellKnownController]cache.SharedIndexInformer
+	// flights collapses concurrent resolutions of the same controller.
+	flights resolutionFlights
+	// resolveEvents is nil if no OnResolve callback was given.
+	resolveEvents *resolveEvents
+	// auditEvents delivers resolutions to the audit sink, it's nil if there's none.
+	auditEvents *resolveEvents
+	// resolutionTimeout bounds the duration of a single resolution if it's positive.
+	resolutionTimeout time.Duration
+	// resolutionLimiter bounds the number of concurrent resolutions, it's nil if they are unbounded.
+	resolutionLimiter limiter
+	// readLimiter bounds the number of concurrent reads of controllers of each GroupKind through the API
+	// server, it's nil if they are unbounded.
+	readLimiter *groupKindLimiter
+	// preserveOwnerAPIVersion disables normalization of API versions of top level controllers, see
+	// Options.PreserveOwnerAPIVersion.
+	preserveOwnerAPIVersion bool
+	// maxInformerStaleness is the time after which informers of well-known controllers failing to list or watch
+	// are bypassed, see Options.MaxInformerStaleness. They're never bypassed if it's zero.
+	maxInformerStaleness time.Duration
+	informerFreshness    map[wellKnownController]*informerFreshness
+	// informerErrors track list and watch errors of informers of well-known controllers.
+	informerErrors map[wellKnownController]*informerErrors
+	// ownerKindValidation decides how owners of unexpected kinds are handled, see Options.OwnerKindValidation.
+	ownerKindValidation OwnerKindValidation
+	// unavailableKinds are the well-known controllers whose API version the server doesn't serve.
+	unavailableKinds map[wellKnownController]bool
+	// blockOwnerDeletionAsController makes resolution follow owners blocking deletion of controllers without
+	// a controller owner, see Options.BlockOwnerDeletionAsController.
+	blockOwnerDeletionAsController bool
+	// inferCronJobFromLabels makes resolution follow CronJobs named in the metadata of Jobs without owners, see
+	// Options.InferCronJobFromLabels.
+	inferCronJobFromLabels bool
+	// recentResolutions holds the last resolutions, see RecentResolutions.
+	recentResolutions recentResolutions
+	// recentErrors holds the last failed resolutions, see RecentErrors.
+	recentErrors recentErrors
+	// notFoundBursts is nil unless Options.NotFoundBurstThreshold is set.
+	notFoundBursts *notFoundBursts
+	// nameTransformer is applied to resolved top level controllers, see Options.NameTransformer. It may be nil.
+	nameTransformer func(ControllerKey) ControllerKey
+	// finalKindRewrite is applied to resolved top level controllers after nameTransformer, see
+	// Options.FinalKindRewrite. It may be nil.
+	finalKindRewrite func(ControllerKeyWithAPIVersion) ControllerKeyWithAPIVersion
+	// allowStandalonePods makes Pods without a controller their own top level controller.
+	allowStandalonePods bool
+	// mirrorPods decides how Pods controlled by a Node are resolved, see Options.MirrorPods.
+	mirrorPods MirrorPodPolicy
+	// health tracks failures of resolutions, it's nil if Options.HealthWindow isn't set.
+	health *healthTracker
+	// inferOwners enables reporting of managers of top level controllers, see Options.InferOwnersFromManagedFields.
+	inferOwners bool
+	// resolutionHints are the kinds of owners of controllers of each kind, see Options.ResolutionHints.
+	resolutionHints map[schema.GroupKind]schema.GroupKind
+	// rejectTerminatingTargets fails resolutions of workloads being deleted, see Options.RejectTerminatingTargets.
+	rejectTerminatingTargets bool
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+
+	// async retries resolutions of ResolveAsync, it's created by the first call.
+	async     *asyncResolver
+	asyncOnce sync.Once
+
+	// scaleMappings caches GroupKinds and REST mappings of controllers resolved through the scale subresource.
+	// It's invalidated whenever the mapper is reset.
+	scaleMappingsMutex sync.Mutex
+	scaleMappings      map[scaleMappingKey]*scaleMapping
+	// canonicalKinds caches results of keyCanonicalizer, it's guarded by scaleMappingsMutex.
+	canonicalKinds map[schema.GroupVersionKind]schema.GroupVersionKind
+	// lastMapperReset is guarded by scaleMappingsMutex.
+	lastMapperReset time.Time
+	// sleep waits before retrying throttled requests, time.Sleep is used if it's nil.
+	sleep func(time.Duration)
+	// recordMetrics is false for fetchers which record no metrics, see NewControllerFetcherLite.
+	recordMetrics bool
+	// defaultKeyedInformers remembers, by informer, whether informers store objects under the default keys, see
+	// usesDefaultKeys.
+	defaultKeyedInformers sync.Map
+}
+
+// scaleMappingKey identifies the type of a controller resolved through the scale subresource.
+type scaleMappingKey struct {
+	apiVersion string
+	kind       string
+}
+
+// scaleMapping holds everything needed to query the scale subresource of a controller type.
+type scaleMapping struct {
+	groupKind schema.GroupKind
+	mappings  []*apimeta.RESTMapping
+}
+
+// controllerObject holds what resolution learns about a controller by reading it.
+type controllerObject struct {
+	owners          []metav1.OwnerReference
+	resourceVersion string
+	// object is the controller as read: a typed or unstructured object, or its scale subresource.
+	// It's nil if the controller wasn't read at all.
+	object interface{}
+	// path is the resolution path the controller was read with.
+	path ResolutionPath
+}
+
+// resolution describes how a top level controller was resolved.
+type resolution struct {
+	topLevel *ControllerKeyWithAPIVersion
+	// controller is what was read about the top level controller.
+	controller *controllerObject
+	// hops is the number of owners followed.
+	hops int
+	// paths holds the resolution path of each controller read, starting from the given one.
+	paths []ResolutionPath
+	// chain holds the controllers read, starting from the given one.
+	chain []ControllerKeyWithAPIVersion
+	// last is the last controller resolution got to: the top level controller, or the one which failed to be
+	// read.
+	last ControllerKeyWithAPIVersion
+	// stopped is set if resolution stopped before the top level controller, see findAncestor.
+	stopped bool
+	// inferredOwner is set if an owner was followed only because it blocks deletion, see
+	// Options.BlockOwnerDeletionAsController, or was inferred from metadata, see Options.InferCronJobFromLabels.
+	inferredOwner bool
+	// live is set if a controller read isn't being deleted.
+	live bool
+	// hintedTopLevel is set if the last owner followed matched Options.ResolutionHints, so its version needn't
+	// be looked up.
+	hintedTopLevel bool
+}
+
+type resettableRESTMapper interface {
+	apimeta.RESTMapper
+	Reset()
 }
 
-// NewControllerFetcher returns a new instance of controllerFetcher
-func NewControllerFetcher(config *rest.Config, kubeClient kube_client.Interface, factory informers.SharedInformerFactory) ControllerFetcher {
+// NewControllerFetcher returns a new instance of controllerFetcher caching resolutions for
+// DefaultResolutionCacheTTL and failures for DefaultNegativeResolutionCacheTTL.
+func NewControllerFetcher(config *rest.Config, kubeClient kube_client.Interface, factory informers.SharedInformerFactory) ExtendedControllerFetcher {
+	return NewControllerFetcherWithOptions(config, kubeClient, factory, Options{
+		ResolutionCacheTTL:         DefaultResolutionCacheTTL,
+		NegativeResolutionCacheTTL: DefaultNegativeResolutionCacheTTL,
+	})
+}
+
+// NewControllerFetcherWithOptions returns a new instance of controllerFetcher configured with the given options.
+// Informers the fetcher takes from the factory (Pods, and well-known controllers other users of the factory
+// created, see Options.InformerTransform) must not have been started yet, otherwise FindTopLevelByUID can't
+// look up their objects.
+func NewControllerFetcherWithOptions(config *rest.Config, kubeClient kube_client.Interface, factory informers.SharedInformerFactory, options Options) ExtendedControllerFetcher {
 	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
 	if err != nil {
 		klog.Fatalf("Could not create discoveryClient: %v", err)
 	}
+	if options.DynamicClient == nil {
+		options.DynamicClient, err = dynamic.NewForConfig(config)
+		if err != nil {
+			klog.Fatalf("Could not create dynamicClient: %v", err)
+		}
+	}
+	return NewControllerFetcherWithClients(discoveryClient, kubeClient, factory, options)
+}
+
+// NewControllerFetcherWithClients returns a new instance of controllerFetcher which talks to the cluster only
+// through the given clients: the scale client and the RESTMapper are built from the discovery client and
+// kubeClient, informers come from the factory. In a multi-cluster setup, pass clients (and a factory built
+// from kubeClient) of the remote cluster to get a fetcher resolving controllers in that cluster. Like with
+// NewControllerFetcherWithOptions, informers of the factory must not have been started yet.
+func NewControllerFetcherWithClients(discoveryClient discovery.DiscoveryInterface, kubeClient kube_client.Interface, factory informers.SharedInformerFactory, options Options) ExtendedControllerFetcher {
+	return newControllerFetcher(discoveryClient, kubeClient, factory, nil, options)
+}
+
+// NewControllerFetcherWithReader returns a new instance of controllerFetcher which reads well-known controllers
+// through the given reader, typically the cache of a controller-runtime manager, instead of starting informers
+// of its own. This avoids caching them twice in operators embedding the fetcher. Options which need informers
+// of the fetcher (WatchPods, WatchHPAs, MaxInformerStaleness and the informer selectors) have no effect;
+// CustomInformers and DynamicInformerResources are still started by the fetcher.
+func NewControllerFetcherWithReader(discoveryClient discovery.DiscoveryInterface, kubeClient kube_client.Interface, reader ObjectReader, options Options) ExtendedControllerFetcher {
+	return newControllerFetcher(discoveryClient, kubeClient, nil, reader, options)
+}
+
+// newControllerFetcher creates a fetcher reading well-known controllers from informers of its own or the
+// factory or, if reader isn't nil, from reader. The factory is only used if reader is nil.
+func newControllerFetcher(discoveryClient discovery.DiscoveryInterface, kubeClient kube_client.Interface, factory informers.SharedInformerFactory, reader ObjectReader, options Options) ExtendedControllerFetcher {
 	resolver := scale.NewDiscoveryScaleKindResolver(discoveryClient)
 	restClient := kubeClient.CoreV1().RESTClient()
-	cachedDiscoveryClient := cacheddiscovery.NewMemCacheClient(discoveryClient)
-	mapper := restmapper.NewDeferredDiscoveryRESTMapper(cachedDiscoveryClient)
-	go wait.Until(func() {
-		mapper.Reset()
-	}, discoveryResetPeriod, make(chan struct{}))
+	mapper := newDiscoveryRESTMapper(discoveryClient, options.DiscoveryMode)
 
-	informersMap := map[wellKnownController]cache.SharedIndexInformer{
-		daemonSet:             factory.Apps().V1().DaemonSets().Informer(),
-		deployment:            factory.Apps().V1().Deployments().Informer(),
-		replicaSet:            factory.Apps().V1().ReplicaSets().Informer(),
-		statefulSet:           factory.Apps().V1().StatefulSets().Informer(),
-		replicationController: factory.Core().V1().ReplicationControllers().Informer(),
-		job:                   factory.Batch().V1().Jobs().Informer(),
+	var podInformer, hpaInformer cache.SharedIndexInformer
+	informersFiltered := false
+	informersMap := make(map[wellKnownController]cache.SharedIndexInformer)
+	// Informers created by the fetcher report their errors to errorTrackers directly, trackers of informers
+	// created by other users of the factory are subscribed to errors reported by all reflectors.
+	errorTrackers := make(map[wellKnownController]*informerErrors)
+	foreignInformers := make(map[wellKnownController]bool)
+	unavailableKinds := unavailableWellKnownControllers(discoveryClient)
+	if reader == nil {
+		if options.WatchPods {
+			podInformer = factory.Core().V1().Pods().Informer()
+		}
+		if options.WatchHPAs {
+			hpaInformer = factory.Autoscaling().V2beta1().HorizontalPodAutoscalers().Informer()
+		}
+		informersFiltered = options.InformerLabelSelector != nil || options.InformerFieldSelector != nil
+		transform := options.InformerTransform
+		if transform == nil && options.InferOwnersFromManagedFields {
+			transform = stripLastAppliedConfiguration
+		} else if transform == nil {
+			transform = StripUnusedFields
+		}
+		for _, kind := range wellKnownControllers {
+			errorTrackers[kind] = newInformerErrors(kind)
+		}
+		newInformers := newTransformingInformers(options.InformerLabelSelector, options.InformerFieldSelector, transform, errorTrackers)
+		// Filtered informers can't be shared, they'd hide controllers from other users of the factory.
+		ownInformers := informersFiltered || options.OwnInformers
+		// Informers are only created for kinds which are served, since the factory starts every informer
+		// created.
+		for kind, newInformer := range newInformers {
+			if unavailableKinds[kind] {
+				continue
+			}
+			if ownInformers {
+				informersMap[kind] = newInformer(kubeClient, informersResyncPeriod)
+				continue
+			}
+			created := false
+			informersMap[kind] = factory.InformerFor(wellKnownControllerObjects[kind], func(client kube_client.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+				created = true
+				return newInformer(client, resyncPeriod)
+			})
+			if !created {
+				klog.V(2).Infof("Informer of %s was created by another user of the factory, its objects aren't transformed", kind)
+				foreignInformers[kind] = true
+			}
+		}
+	} else if options.WatchPods || options.WatchHPAs {
+		klog.Errorf("Pod and HorizontalPodAutoscaler informers aren't available with a reader, not watching them")
 	}
 
-	for kind, informer := range informersMap {
-		stopCh := make(chan struct{})
-		go informer.Run(stopCh)
-		synced := cache.WaitForCacheSync(stopCh, informer.HasSynced)
-		if !synced {
-			klog.Warningf("Could not sync cache for %s: %v", kind, err)
+	customInformers := make(map[schema.GroupKind]cache.SharedIndexInformer)
+	if len(options.DynamicInformerResources) > 0 {
+		if options.DynamicClient == nil {
+			klog.Errorf("Dynamic informers need a dynamic client, reading %v through the scale subresource", options.DynamicInformerResources)
 		} else {
-			klog.Infof("Initial sync of %s completed", kind)
+			customInformers = newDynamicInformers(options.DynamicClient, mapper, options.DynamicInformerResources)
+		}
+	}
+	for groupKind, informer := range options.CustomInformers {
+		customInformers[groupKind] = informer
+	}
+
+	freshness := make(map[wellKnownController]*informerFreshness, len(informersMap))
+
+	// Informers run until the fetcher is stopped.
+	stopCh := make(chan struct{})
+	for kind, informer := range informersMap {
+		if err := addUIDIndexers(string(kind), informer); err != nil {
+			klog.Errorf("%v, FindTopLevelByUID won't find %s controllers", err, kind)
 		}
+		freshness[kind] = newInformerFreshness(informer)
+		if foreignInformers[kind] {
+			subscribeInformerErrors(errorTrackers[kind])
+		}
+		runInformer(string(kind), informer, stopCh)
+	}
+	for groupKind, informer := range customInformers {
+		if err := addUIDIndexers(groupKind.String(), informer); err != nil {
+			klog.Errorf("%v, FindTopLevelByUID won't find %s controllers", err, groupKind)
+		}
+		runInformer(groupKind.String(), informer, stopCh)
+	}
+	if podInformer != nil {
+		if err := addUIDIndexers("Pod", podInformer); err != nil {
+			klog.Errorf("%v, FindTopLevelByUID won't find Pods", err)
+		}
+		runInformer("Pod", podInformer, stopCh)
+	}
+	if hpaInformer != nil {
+		addScaleTargetIndexer(hpaInformer)
+		runInformer("HorizontalPodAutoscaler", hpaInformer, stopCh)
 	}
 
+	scaleNamespacer := scale.New(restClient, mapper, dynamic.LegacyAPIPathResolverFunc, resolver)
+	f := &controllerFetcher{
+		scaleNamespacer:                scaleNamespacer,
+		mapper:                         mapper,
+		informersMap:                   informersMap,
+		podInformer:                    podInformer,
+		reader:                         reader,
+		recordMetrics:                  true,
+		hpaInformer:                    hpaInformer,
+		kubeClient:                     kubeClient,
+		dynamicClient:                  options.DynamicClient,
+		customInformers:                customInformers,
+		terminalKinds:                  make(map[schema.GroupKind]bool),
+		resolutionPolicy:               options.ResolutionPolicy,
+		keyCanonicalizer:               options.KeyCanonicalizer,
+		kindAliases:                    options.KindAliases,
+		resolutionHints:                options.ResolutionHints,
+		freshScaleReads:                options.FreshScaleReads,
+		resolutionTimeout:              options.ResolutionTimeout,
+		informersFiltered:              informersFiltered,
+		inferOwners:                    options.InferOwnersFromManagedFields,
+		rejectTerminatingTargets:       options.RejectTerminatingTargets,
+		scaleTargetRefExtractors:       options.ScaleTargetRefExtractors,
+		disableScaleResolution:         options.DisableScaleResolution,
+		resolutionLimiter:              newLimiter(options.MaxConcurrentResolutions),
+		readLimiter:                    newGroupKindLimiter(options.MaxConcurrentReadsPerGroupKind),
+		preserveOwnerAPIVersion:        options.PreserveOwnerAPIVersion,
+		maxInformerStaleness:           options.MaxInformerStaleness,
+		allowStandalonePods:            options.AllowStandalonePods,
+		mirrorPods:                     options.MirrorPods,
+		nameTransformer:                options.NameTransformer,
+		finalKindRewrite:               options.FinalKindRewrite,
+		blockOwnerDeletionAsController: options.BlockOwnerDeletionAsController,
+		inferCronJobFromLabels:         options.InferCronJobFromLabels,
+		informerFreshness:              freshness,
+		informerErrors:                 errorTrackers,
+		unavailableKinds:               unavailableKinds,
+		ownerKindValidation:            options.OwnerKindValidation,
+		stopCh:                         stopCh,
+	}
+	for _, groupKind := range options.TerminalKinds {
+		f.terminalKinds[groupKind] = true
+	}
+	f.nonWorkloadKinds = make(map[schema.GroupKind]bool)
+	for _, groupKind := range options.NonWorkloadKinds {
+		f.nonWorkloadKinds[groupKind] = true
+	}
+	f.nonWorkloadOwnerKinds = make(map[schema.GroupKind]bool)
+	for _, groupKind := range options.NonWorkloadOwnerKinds {
+		f.nonWorkloadOwnerKinds[groupKind] = true
+	}
+	if options.KnativeTerminal == KnativeDeploymentTerminal {
+		// Not following Revisions makes their Deployments top level.
+		f.nonWorkloadOwnerKinds[schema.GroupKind{Group: knativeServingGroup, Kind: "Revision"}] = true
+	}
+	if options.FlaggerTerminal == FlaggerPrimaryTerminal {
+		// Not following Canaries makes their primaries top level, Canaries themselves refer to their primary.
+		f.nonWorkloadOwnerKinds[flaggerCanary] = true
+		extractors := map[schema.GroupKind]ScaleTargetRefExtractor{flaggerCanary: flaggerPrimaryRef}
+		for groupKind, extract := range options.ScaleTargetRefExtractors {
+			extractors[groupKind] = extract
+		}
+		f.scaleTargetRefExtractors = extractors
+	}
+	if options.ArgoRolloutsTerminal == ArgoRolloutsExperimentTerminal {
+		for groupKind := range argoRolloutsAuxiliaryKinds {
+			f.terminalKinds[groupKind] = true
+		}
+	}
+	f.scalePathKinds = make(map[schema.GroupKind]bool)
+	for _, groupKind := range options.ScalePathKinds {
+		f.scalePathKinds[groupKind] = true
+	}
+	if options.Cache != nil {
+		f.cache = options.Cache
+	} else if options.ResolutionCacheTTL > 0 || options.NegativeResolutionCacheTTL > 0 {
+		f.resolutionCache = newResolutionCache(options.ResolutionCacheTTL)
+		f.resolutionCache.negativeTTL = options.NegativeResolutionCacheTTL
+		f.resolutionCache.onEvict = options.OnCacheEvict
+	}
+	if options.ResolutionCacheTTL > 0 {
+		f.stepCache = newStepCache(options.ResolutionCacheTTL)
+		go wait.Until(func() { f.stepCache.sweep(time.Now()) }, options.ResolutionCacheTTL, f.stopCh)
+		if options.RefreshResolutionCache && f.resolutionCache != nil {
+			period := time.Duration(float64(options.ResolutionCacheTTL) * refreshWindowFraction / 2)
+			go wait.JitterUntil(f.refreshResolutionCache, period, 1.0, true, f.stopCh)
+		}
+	} else if options.EagerCache {
+		klog.Errorf("Eager caching needs a resolution cache TTL, caching nothing")
+	}
+	f.recentErrors.size = options.RecentErrorsSize
+	if options.NotFoundBurstThreshold > 0 {
+		f.notFoundBursts = newNotFoundBursts(options.NotFoundBurstThreshold, options.NotFoundBurstWindow)
+	}
+	if options.HealthWindow > 0 {
+		f.health = newHealthTracker(options.HealthWindow)
+	}
+	if options.OnResolve != nil {
+		f.resolveEvents = newResolveEvents(options.OnResolve, resolveEventsBufferSize, f.stopCh)
+	}
+	if options.AuditSink != nil {
+		f.auditEvents = newAuditEvents(options.AuditSink, resolveEventsBufferSize, f.recordMetrics, f.stopCh)
+	}
+	if options.EagerCache && options.ResolutionCacheTTL > 0 && f.resolutionCache != nil {
+		// Started last, as preloading resolves controllers right away.
+		f.runEagerCache(informersMap)
+	}
+	refreshInterval := options.DiscoveryRefreshInterval
+	if refreshInterval <= 0 {
+		refreshInterval = discoveryResetPeriod
+	}
+	initialReset := true
+	go wait.Until(func() {
+		// The first reset at start fills the discovery information, nothing cached was derived from older one.
+		if initialReset {
+			initialReset = false
+			f.resetDiscovery()
+			return
+		}
+		f.resetMapper()
+	}, refreshInterval, f.stopCh)
+	return f
+}
+
+// NewControllerFetcherLite returns a new instance of controllerFetcher which doesn't do any background work:
+// it starts no informers and never resets its discovery information. Well-known controllers are read from the
+// API server on demand and other kinds through their scale subresource. It's meant for short-lived tools
+// which resolve a few controllers and exit, and can't afford waiting for informers to sync. It records no
+// metrics, so tools don't need to register them.
+func NewControllerFetcherLite(config *rest.Config, kubeClient kube_client.Interface) ExtendedControllerFetcher {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		klog.Fatalf("Could not create discoveryClient: %v", err)
+	}
+	resolver := scale.NewDiscoveryScaleKindResolver(discoveryClient)
+	restClient := kubeClient.CoreV1().RESTClient()
+	mapper := newDiscoveryRESTMapper(discoveryClient, DiscoveryCached)
+
 	scaleNamespacer := scale.New(restClient, mapper, dynamic.LegacyAPIPathResolverFunc, resolver)
 	return &controllerFetcher{
 		scaleNamespacer: scaleNamespacer,
 		mapper:          mapper,
-		informersMap:    informersMap,
+		informersMap:    make(map[wellKnownController]cache.SharedIndexInformer),
+		kubeClient:      kubeClient,
+		stopCh:          make(chan struct{}),
+	}
+}
+
+func runInformer(kind string, informer cache.SharedIndexInformer, stopCh <-chan struct{}) bool {
+	go informer.Run(stopCh)
+	synced := cache.WaitForCacheSync(stopCh, informer.HasSynced)
+	if !synced {
+		klog.Warningf("Could not sync cache for %s", kind)
+	} else {
+		klog.Infof("Initial sync of %s completed", kind)
 	}
+	return synced
 }
 
+func (f *controllerFetcher) isNonWorkload(groupKind schema.GroupKind) bool {
+	return nonWorkloadKinds[groupKind] || f.nonWorkloadKinds[groupKind]
+}
+
+func (f *controllerFetcher) isNonWorkloadOwner(groupKind schema.GroupKind) bool {
+	return nonWorkloadOwnerKinds[groupKind] || f.nonWorkloadOwnerKinds[groupKind] || f.isNonWorkload(groupKind)
+}
+
+// workloadOwners returns the given owners without the ones which aren't workloads.
+func (f *controllerFetcher) workloadOwners(owners []metav1.OwnerReference) []metav1.OwnerReference {
+	var filtered []metav1.OwnerReference
+	for i, owner := range owners {
+		groupVersion, err := schema.ParseGroupVersion(owner.APIVersion)
+		if err != nil || !f.isNonWorkloadOwner(schema.GroupKind{Group: groupVersion.Group, Kind: owner.Kind}) {
+			if filtered != nil {
+				filtered = append(filtered, owner)
+			}
+			continue
+		}
+		if filtered == nil {
+			filtered = append(make([]metav1.OwnerReference, 0, len(owners)), owners[:i]...)
+		}
+	}
+	if filtered == nil {
+		return owners
+	}
+	return filtered
+}
+
+func isWellKnownController(kind wellKnownController) bool {
+	for _, known := range wellKnownControllers {
+		if kind == known {
+			return true
+		}
+	}
+	return false
+}
+
+// getOwnerController returns the owner with controller set. There should be at most one, but if the API server
+// let more through, the one picked mustn't depend on the order of owners, which may change across relists:
+// well-known controllers are preferred, then the lowest UID.
 func getOwnerController(owners []metav1.OwnerReference, namespace string) *ControllerKeyWithAPIVersion {
+	var controller *metav1.OwnerReference
+	for i := range owners {
+		owner := &owners[i]
+		if owner.Controller == nil || !*owner.Controller {
+			continue
+		}
+		if controller == nil || preferredOwnerController(*owner, *controller) {
+			controller = owner
+		}
+	}
+	if controller == nil {
+		return nil
+	}
+	return &ControllerKeyWithAPIVersion{
+		ControllerKey: ControllerKey{
+			Namespace: namespace,
+			Kind:      controller.Kind,
+			Name:      controller.Name,
+		},
+		ApiVersion: controller.APIVersion,
+	}
+}
+
+// preferredOwnerController tells whether a is preferred over b among owners which both claim to be the controller.
+func preferredOwnerController(a, b metav1.OwnerReference) bool {
+	if aWellKnown, bWellKnown := isWellKnownOwner(a), isWellKnownOwner(b); aWellKnown != bWellKnown {
+		return aWellKnown
+	}
+	if a.UID != b.UID {
+		return a.UID < b.UID
+	}
+	if a.Kind != b.Kind {
+		return a.Kind < b.Kind
+	}
+	return a.Name < b.Name
+}
+
+// isWellKnownOwner tells whether the owner is a well-known controller of its usual API group.
+func isWellKnownOwner(owner metav1.OwnerReference) bool {
+	return isWellKnownGroupKind(schema.GroupKind{Group: apiGroup(owner.APIVersion), Kind: owner.Kind})
+}
+
+// isWellKnownGroupKind tells whether the GroupKind is a well-known controller, rather than a custom resource
+// reusing its Kind in another group. Kinds without a group are taken to be well-known, since keys of well-known
+// controllers often come without an API version. Legacy groups of well-known controllers count as theirs.
+func isWellKnownGroupKind(groupKind schema.GroupKind) bool {
+	groupVersion, found := wellKnownControllerGroupVersions[wellKnownController(groupKind.Kind)]
+	if !found {
+		return false
+	}
+	return groupKind.Group == "" || groupKind.Group == apiGroup(groupVersion) || legacyWellKnownControllerKinds[groupKind]
+}
+
+// getBlockingOwner returns the owner which blocks deletion of the object with the given owners, or nil if
+// there's none or more than one.
+func getBlockingOwner(owners []metav1.OwnerReference, namespace string) *ControllerKeyWithAPIVersion {
+	var blocking *ControllerKeyWithAPIVersion
 	for _, owner := range owners {
-		if owner.Controller != nil && *owner.Controller == true {
-			return &ControllerKeyWithAPIVersion{
-				ControllerKey: ControllerKey{
-					Namespace: namespace,
-					Kind:      owner.Kind,
-					Name:      owner.Name,
-				},
-				ApiVersion: owner.APIVersion,
-			}
+		if owner.BlockOwnerDeletion == nil || !*owner.BlockOwnerDeletion {
+			continue
+		}
+		if blocking != nil {
+			return nil
+		}
+		blocking = &ControllerKeyWithAPIVersion{
+			ControllerKey: ControllerKey{
+				Namespace: namespace,
+				Kind:      owner.Kind,
+				Name:      owner.Name,
+			},
+			ApiVersion: owner.APIVersion,
 		}
 	}
-	return nil
+	return blocking
+}
+
+// ownerController returns the controller among the given owners. Without one, the owner blocking deletion
+// is returned if Options.BlockOwnerDeletionAsController is set, in which case inferred is true.
+func (f *controllerFetcher) ownerController(owners []metav1.OwnerReference, namespace string) (owner *ControllerKeyWithAPIVersion, inferred bool) {
+	if owner := getOwnerController(owners, namespace); owner != nil {
+		return owner, false
+	}
+	if !f.blockOwnerDeletionAsController {
+		return nil, false
+	}
+	owner = getBlockingOwner(owners, namespace)
+	return owner, owner != nil
+}
+
+func getWellKnownControllerFromInformer(informer cache.SharedIndexInformer, controllerKey ControllerKeyWithAPIVersion) (*controllerObject, error) {
+	namespace := controllerKey.Namespace
+	name := controllerKey.Name
+	kind := controllerKey.Kind
+
+	obj, exists, err := informer.GetStore().GetByKey(storeKey(namespace, name))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%s %s/%s %w", kind, namespace, name, ErrControllerNotFound)
+	}
+	return newWellKnownControllerObject(obj, controllerKey)
+}
+
+func newWellKnownControllerObject(obj interface{}, controllerKey ControllerKeyWithAPIVersion) (*controllerObject, error) {
+	owners, err := getOwnerReferencesOfWellKnownObject(obj, controllerKey)
+	if err != nil {
+		return nil, err
+	}
+	accessor, err := apimeta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &controllerObject{owners: owners, resourceVersion: accessor.GetResourceVersion(), object: obj}, nil
+}
+
+// storeKey returns the key under which an object is stored in informers, as computed by
+// cache.MetaNamespaceKeyFunc.
+func storeKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// getFromStore returns the object with the given namespace and name from the informer. Objects are looked up
+// under the key cache.MetaNamespaceKeyFunc gives them, which is what informers use by default. Informers
+// built with another key function (e.g. custom informers of callers) are searched by name instead, in the
+// namespace index if they have one.
+func (f *controllerFetcher) getFromStore(informer cache.SharedIndexInformer, namespace, name string) (interface{}, bool, error) {
+	obj, exists, err := informer.GetStore().GetByKey(storeKey(namespace, name))
+	if err != nil || exists || f.usesDefaultKeys(informer) {
+		return obj, exists, err
+	}
+	indexer := informer.GetIndexer()
+	var objs []interface{}
+	if _, found := indexer.GetIndexers()[cache.NamespaceIndex]; found {
+		objs, err = indexer.ByIndex(cache.NamespaceIndex, namespace)
+		if err != nil {
+			return nil, false, err
+		}
+	} else {
+		objs = indexer.List()
+	}
+	for _, obj := range objs {
+		accessor, err := apimeta.Accessor(obj)
+		if err == nil && accessor.GetNamespace() == namespace && accessor.GetName() == name {
+			return obj, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// usesDefaultKeys tells whether the informer stores objects under the keys cache.MetaNamespaceKeyFunc gives
+// them, judging by one of its objects. Informers seen holding an object are remembered; empty ones are assumed
+// to use default keys, there's nothing to find in them anyway.
+func (f *controllerFetcher) usesDefaultKeys(informer cache.SharedIndexInformer) bool {
+	store := informer.GetStore()
+	if defaultKeys, found := f.defaultKeyedInformers.Load(informer); found {
+		return defaultKeys.(bool)
+	}
+	keys := store.ListKeys()
+	if len(keys) == 0 {
+		return true
+	}
+	obj, exists, err := store.GetByKey(keys[0])
+	if err != nil || !exists {
+		return true
+	}
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	defaultKeys := err == nil && key == keys[0]
+	f.defaultKeyedInformers.Store(informer, defaultKeys)
+	return defaultKeys
 }
 
-func getParentOfWellKnownController(informer cache.SharedIndexInformer, controllerKey ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error) {
+func (f *controllerFetcher) getCustomController(informer cache.SharedIndexInformer, controllerKey ControllerKeyWithAPIVersion) (*controllerObject, error) {
 	namespace := controllerKey.Namespace
 	name := controllerKey.Name
 	kind := controllerKey.Kind
 
-	obj, exists, err := informer.GetStore().GetByKey(namespace + "/" + name)
+	obj, exists, err := f.getFromStore(informer, namespace, name)
 	if err != nil {
 		return nil, err
 	}
 	if !exists {
-		return nil, fmt.Errorf("%s %s/%s does not exist", kind, namespace, name)
+		return nil, fmt.Errorf("%s %s/%s %w", kind, namespace, name, ErrControllerNotFound)
 	}
+	accessor, err := apimeta.Accessor(obj)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s %s/%s: %v", kind, namespace, name, err)
+	}
+	return &controllerObject{owners: accessor.GetOwnerReferences(), resourceVersion: accessor.GetResourceVersion(), object: obj}, nil
+}
+
+// getWellKnownControllerFromAPIServer reads a well-known controller directly from the API server.
+func (f *controllerFetcher) getWellKnownControllerFromAPIServer(controllerKey ControllerKeyWithAPIVersion) (runtime.Object, error) {
+	namespace := controllerKey.Namespace
+	name := controllerKey.Name
+	kind := controllerKey.Kind
+
+	var obj runtime.Object
+	var err error
+	switch wellKnownController(kind) {
+	case daemonSet:
+		obj, err = f.kubeClient.AppsV1().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+	case deployment:
+		obj, err = f.kubeClient.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	case statefulSet:
+		obj, err = f.kubeClient.AppsV1().StatefulSets(namespace).Get(name, metav1.GetOptions{})
+	case replicaSet:
+		obj, err = f.kubeClient.AppsV1().ReplicaSets(namespace).Get(name, metav1.GetOptions{})
+	case job:
+		obj, err = f.kubeClient.BatchV1().Jobs(namespace).Get(name, metav1.GetOptions{})
+	case replicationController:
+		obj, err = f.kubeClient.CoreV1().ReplicationControllers(namespace).Get(name, metav1.GetOptions{})
+	default:
+		return nil, fmt.Errorf("%s is not a well-known controller", kind)
+	}
+	if k8serrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%s %s/%s %w", kind, namespace, name, ErrControllerNotFound)
+	}
+	return obj, err
+}
+
+func getOwnerReferencesOfWellKnownObject(obj interface{}, controllerKey ControllerKeyWithAPIVersion) ([]metav1.OwnerReference, error) {
+	namespace := controllerKey.Namespace
+	name := controllerKey.Name
+	kind := controllerKey.Kind
+
 	switch obj.(type) {
 	case (*appsv1.DaemonSet):
 		apiObj, ok := obj.(*appsv1.DaemonSet)
 		if !ok {
 			return nil, fmt.Errorf("Failed to parse %s %s/%s", kind, namespace, name)
 		}
-		return getOwnerController(apiObj.OwnerReferences, namespace), nil
+		return apiObj.OwnerReferences, nil
 	case (*appsv1.Deployment):
 		apiObj, ok := obj.(*appsv1.Deployment)
 		if !ok {
 			return nil, fmt.Errorf("Failed to parse %s %s/%s", kind, namespace, name)
 		}
-		return getOwnerController(apiObj.OwnerReferences, namespace), nil
+		return apiObj.OwnerReferences, nil
 	case (*appsv1.StatefulSet):
 		apiObj, ok := obj.(*appsv1.StatefulSet)
 		if !ok {
 			return nil, fmt.Errorf("Failed to parse %s %s/%s", kind, namespace, name)
 		}
-		return getOwnerController(apiObj.OwnerReferences, namespace), nil
+		return apiObj.OwnerReferences, nil
 	case (*appsv1.ReplicaSet):
 		apiObj, ok := obj.(*appsv1.ReplicaSet)
 		if !ok {
 			return nil, fmt.Errorf("Failed to parse %s %s/%s", kind, namespace, name)
 		}
-		return getOwnerController(apiObj.OwnerReferences, namespace), nil
+		return apiObj.OwnerReferences, nil
 	case (*batchv1.Job):
 		apiObj, ok := obj.(*batchv1.Job)
 		if !ok {
 			return nil, fmt.Errorf("Failed to parse %s %s/%s", kind, namespace, name)
 		}
-		return getOwnerController(apiObj.OwnerReferences, namespace), nil
+		return apiObj.OwnerReferences, nil
 	case (*corev1.ReplicationController):
 		apiObj, ok := obj.(*corev1.ReplicationController)
 		if !ok {
 			return nil, fmt.Errorf("Failed to parse %s %s/%s", kind, namespace, name)
 		}
-		return getOwnerController(apiObj.OwnerReferences, namespace), nil
+		return apiObj.OwnerReferences, nil
+	}
+
+	return nil, fmt.Errorf("%w: don't know how to read owner controller of %s %s/%s from %T", ErrUnreadableOwnerObject, kind, namespace, name, obj)
+}
+
+// getOwnerControllers returns the controller owner or, if no owner is flagged as the controller and there are
+// several owners, all of them.
+func getOwnerControllers(owners []metav1.OwnerReference, namespace string) []ControllerKeyWithAPIVersion {
+	if owner := getOwnerController(owners, namespace); owner != nil {
+		return []ControllerKeyWithAPIVersion{*owner}
+	}
+	if len(owners) < 2 {
+		return nil
+	}
+	result := make([]ControllerKeyWithAPIVersion, 0, len(owners))
+	for _, owner := range owners {
+		result = append(result, ControllerKeyWithAPIVersion{
+			ControllerKey: ControllerKey{
+				Namespace: namespace,
+				Kind:      owner.Kind,
+				Name:      owner.Name,
+			},
+			ApiVersion: owner.APIVersion,
+		})
+	}
+	return result
+}
+
+// checkOwnerNamespace returns ErrCrossNamespaceOwner if the owner of the controller isn't in the namespace of
+// the controller but the informer of the owner has it in another one. Owners missing altogether, e.g. because
+// they're being deleted, are left to be reported when reading them.
+func (f *controllerFetcher) checkOwnerNamespace(controller ControllerKeyWithAPIVersion, owners []metav1.OwnerReference, owner ControllerKeyWithAPIVersion) error {
+	if f.informersFiltered {
+		return nil
+	}
+	groupVersion, err := schema.ParseGroupVersion(owner.ApiVersion)
+	if err != nil {
+		return nil
+	}
+	informer, exists := f.customInformer(schema.GroupKind{Group: groupVersion.Group, Kind: owner.Kind})
+	if !exists {
+		informer, exists = f.informersMap[wellKnownController(owner.Kind)]
+		exists = exists && isWellKnownGroupKind(schema.GroupKind{Group: groupVersion.Group, Kind: owner.Kind})
+	}
+	if !exists {
+		return nil
+	}
+	if _, found, err := f.getFromStore(informer, owner.Namespace, owner.Name); err != nil || found {
+		return nil
+	}
+	for _, ref := range owners {
+		if ref.Kind != owner.Kind || ref.Name != owner.Name || ref.UID == "" {
+			continue
+		}
+		if other := findInIndex(informer, "", ref.UID, owner.Kind, ""); other != nil {
+			return fmt.Errorf("%w: %s %s/%s is owned by %s %s which is in namespace %s", ErrCrossNamespaceOwner,
+				controller.Kind, controller.Namespace, controller.Name, owner.Kind, owner.Name, other.Namespace)
+		}
+	}
+	return nil
+}
+
+// getController reads the given controller from wherever the resolution policy says: an informer (or the
+// API server) or its scale subresource.
+func (f *controllerFetcher) getController(ctx context.Context, controllerKey ControllerKeyWithAPIVersion) (*controllerObject, error) {
+	controller, path, err := f.readController(ctx, controllerKey)
+	if err != nil {
+		return nil, err
+	}
+	controller.path = path
+	if len(controller.owners) == 0 && path != TerminalPath {
+		if controller.owners, err = f.scaleTargetRefOwners(ctx, controllerKey, controller); err != nil {
+			return nil, err
+		}
+	}
+	controller.owners = f.workloadOwners(controller.owners)
+	return controller, nil
+}
+
+// readController reads the given controller and returns the resolution path used to read it.
+func (f *controllerFetcher) readController(ctx context.Context, controllerKey ControllerKeyWithAPIVersion) (*controllerObject, ResolutionPath, error) {
+	groupVersion, err := schema.ParseGroupVersion(controllerKey.ApiVersion)
+	if err != nil {
+		return nil, "", err
+	}
+	groupKind := schema.GroupKind{Group: groupVersion.Group, Kind: controllerKey.Kind}
+	if f.isNonWorkload(groupKind) {
+		return nil, "", fmt.Errorf("%w: %s %s/%s", ErrNonWorkloadTarget, groupKind, controllerKey.Namespace, controllerKey.Name)
+	}
+	if f.isUnavailableKind(groupKind) {
+		return nil, "", fmt.Errorf("%w: %s %s/%s", ErrKindUnavailable, groupKind, controllerKey.Namespace, controllerKey.Name)
+	}
+	informer, exists := f.customInformer(groupKind)
+	if f.terminalKinds[groupKind] {
+		if !exists {
+			return &controllerObject{}, TerminalPath, nil
+		}
+		controller, err := f.getCustomController(informer, controllerKey)
+		if err == nil {
+			controller.owners = nil
+		}
+		return controller, TerminalPath, err
+	}
+
+	if f.scalePathKinds[groupKind] {
+		return f.readControllerFromScale(ctx, groupKind, controllerKey)
+	}
+	if isDynamicPathKind(groupKind) && !exists && f.dynamicClient != nil {
+		controller, err := f.readControllerFromDynamicClient(ctx, groupKind, controllerKey)
+		return controller, DynamicPath, err
+	}
+	hasInformer := exists || (isWellKnownGroupKind(groupKind) && f.canReadWellKnownController(wellKnownController(controllerKey.Kind)))
+	path := f.getResolutionPolicy().ResolutionPath(controllerKey, hasInformer)
+	switch path {
+	case TerminalPath:
+		return &controllerObject{}, path, nil
+	case InformerPath:
+		var controller *controllerObject
+		if exists {
+			controller, err = f.getCustomController(informer, controllerKey)
+		} else {
+			controller, err = f.getWellKnownController(ctx, controllerKey)
+		}
+		return controller, path, err
+	case ScalePath:
+		return f.readControllerFromScale(ctx, groupKind, controllerKey)
+	case DynamicPath:
+		controller, err := f.readControllerFromDynamicClient(ctx, groupKind, controllerKey)
+		return controller, path, err
+	}
+	return nil, "", fmt.Errorf("Unknown resolution path %q for %s %s/%s", path, groupKind, controllerKey.Namespace, controllerKey.Name)
+}
+
+// readControllerFromScale reads the controller through its scale subresource, unless scale resolution is
+// disabled, in which case the controller is treated as a top level controller. Each read holds the read limiter
+// of the GroupKind, see getScale.
+func (f *controllerFetcher) readControllerFromScale(ctx context.Context, groupKind schema.GroupKind, controllerKey ControllerKeyWithAPIVersion) (*controllerObject, ResolutionPath, error) {
+	if f.disableScaleResolution {
+		klog.V(4).Infof("Scale resolution disabled, treating %s %s/%s as top level", controllerKey.Kind, controllerKey.Namespace, controllerKey.Name)
+		return &controllerObject{}, TerminalPath, nil
+	}
+	controller, err := f.getControllerFromScale(ctx, controllerKey)
+	return controller, ScalePath, err
+}
+
+// readControllerFromDynamicClient reads the controller with the dynamic client, holding the read limiter of its
+// GroupKind.
+func (f *controllerFetcher) readControllerFromDynamicClient(ctx context.Context, groupKind schema.GroupKind, controllerKey ControllerKeyWithAPIVersion) (*controllerObject, error) {
+	if err := f.readLimiter.acquire(ctx, groupKind); err != nil {
+		return nil, err
 	}
+	defer f.readLimiter.release(groupKind)
+	return f.getControllerFromDynamicClient(controllerKey)
+}
 
-	return nil, fmt.Errorf("Don't know how to read owner controller")
+func (f *controllerFetcher) getResolutionPolicy() ResolutionPolicy {
+	if f.resolutionPolicy == nil {
+		return DefaultResolutionPolicy{}
+	}
+	return f.resolutionPolicy
 }
 
-func (f *controllerFetcher) getParentOfController(controllerKey ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error) {
+func (f *controllerFetcher) canReadWellKnownController(kind wellKnownController) bool {
+	_, exists := f.informersMap[kind]
+	return exists || (isWellKnownController(kind) && (f.kubeClient != nil || f.reader != nil))
+}
+
+// getWellKnownController reads a well-known controller from its informer or, if there is none, from the reader or
+// the API server.
+func (f *controllerFetcher) getWellKnownController(ctx context.Context, controllerKey ControllerKeyWithAPIVersion) (*controllerObject, error) {
 	kind := wellKnownController(controllerKey.Kind)
+	if !f.canReadWellKnownController(kind) {
+		return nil, fmt.Errorf("No informer for %s %s/%s", controllerKey.Kind, controllerKey.Namespace, controllerKey.Name)
+	}
+	// All well-known controllers are namespaced.
+	if controllerKey.Namespace == "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrMissingNamespace, kind, controllerKey.Name)
+	}
 	informer, exists := f.informersMap[kind]
+	if exists && f.kubeClient != nil && f.isInformerStale(kind) {
+		exists = false
+	}
+	if exists && (!f.informersFiltered || f.kubeClient == nil) {
+		return getWellKnownControllerFromInformer(informer, controllerKey)
+	}
 	if exists {
-		return getParentOfWellKnownController(informer, controllerKey)
+		obj, found, err := informer.GetStore().GetByKey(storeKey(controllerKey.Namespace, controllerKey.Name))
+		if err == nil && found {
+			return newWellKnownControllerObject(obj, controllerKey)
+		}
+		// The controller doesn't match the informer selectors.
 	}
+	if f.reader != nil {
+		return f.getWellKnownControllerFromReader(ctx, controllerKey)
+	}
+	obj, err := f.getWellKnownControllerFromAPIServer(controllerKey)
+	if err != nil {
+		return nil, err
+	}
+	return newWellKnownControllerObject(obj, controllerKey)
+}
+
+// getControllerFromScale reads the controller through its scale subresource. A controller without owners is
+// only returned if its scale was read, which makes it a scalable top level controller; failing reads are errors.
+func (f *controllerFetcher) getControllerFromScale(ctx context.Context, controllerKey ControllerKeyWithAPIVersion) (*controllerObject, error) {
+	var scale *autoscalingv1.Scale
+	var restMapping *apimeta.RESTMapping
+	mapping, err := f.getScaleMapping(controllerKey.ApiVersion, controllerKey.Kind)
+	if err == nil {
+		if f.recordMetrics {
+			metrics_recommender.RecordControllerFetcherScaleLookup(mapping.groupKind.String())
+		}
+		scale, restMapping, err = f.getScaleResource(ctx, mapping, controllerKey.Namespace, controllerKey.Name)
+	}
+	if err != nil {
+		lastErr := err
+		var scaleErr *ScaleResolutionError
+		if errors.As(err, &scaleErr) && len(scaleErr.Attempts) > 0 {
+			lastErr = scaleErr.Attempts[len(scaleErr.Attempts)-1].Err
+		}
+		if isMissingResource(lastErr) {
+			// The resource was likely removed (e.g. its CRD was deleted) but the mapper still knows about it.
+			f.resetStaleMapper(time.Now())
+		} else if k8serrors.IsNotFound(lastErr) {
+			if mapping != nil {
+				f.recordNotFoundRead(mapping.groupKind)
+			}
+			return nil, fmt.Errorf("Unhandled targetRef %s / %s / %s: %w, controller %w",
+				controllerKey.ApiVersion, controllerKey.Kind, controllerKey.Name, err, ErrControllerNotFound)
+		}
+		return nil, fmt.Errorf("Unhandled targetRef %s / %s / %s: %w",
+			controllerKey.ApiVersion, controllerKey.Kind, controllerKey.Name, err)
+	}
+	f.recordFoundRead(mapping.groupKind)
+
+	owners := scale.OwnerReferences
+	if len(owners) == 0 {
+		owners = f.getOwnersFromDynamicClient(restMapping, controllerKey)
+	}
+	return &controllerObject{owners: owners, resourceVersion: scale.ResourceVersion, object: scale}, nil
+}
 
-	// TODO: cache response
+// dynamicResource returns the dynamic client of the resource of the given mapping in the namespace.
+func (f *controllerFetcher) dynamicResource(restMapping *apimeta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	resource := f.dynamicClient.Resource(restMapping.Resource)
+	if restMapping.Scope.Name() == apimeta.RESTScopeNameNamespace {
+		return resource.Namespace(namespace)
+	}
+	return resource
+}
+
+// getControllerFromDynamicClient reads the controller with the dynamic client.
+func (f *controllerFetcher) getControllerFromDynamicClient(controllerKey ControllerKeyWithAPIVersion) (*controllerObject, error) {
+	if f.dynamicClient == nil {
+		return nil, fmt.Errorf("No dynamic client to read %s %s/%s", controllerKey.Kind, controllerKey.Namespace, controllerKey.Name)
+	}
 	groupVersion, err := schema.ParseGroupVersion(controllerKey.ApiVersion)
 	if err != nil {
 		return nil, err
 	}
-	groupKind := schema.GroupKind{
-		Group: groupVersion.Group,
-		Kind:  controllerKey.Kind,
+	restMapping, err := f.mapper.RESTMapping(schema.GroupKind{Group: groupVersion.Group, Kind: controllerKey.Kind}, groupVersion.Version)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := f.dynamicResource(restMapping, controllerKey.Namespace).Get(controllerKey.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		f.recordNotFoundRead(restMapping.GroupVersionKind.GroupKind())
+		return nil, fmt.Errorf("%s %s/%s %w", controllerKey.Kind, controllerKey.Namespace, controllerKey.Name, ErrControllerNotFound)
 	}
-
-	owner, err := f.getOwnerForScaleResource(groupKind, controllerKey.Namespace, controllerKey.Name)
 	if err != nil {
-		return nil, fmt.Errorf("Unhandled targetRef %s / %s / %s, last error %v",
-			controllerKey.ApiVersion, controllerKey.Kind, controllerKey.Name, err)
+		return nil, err
 	}
+	f.recordFoundRead(restMapping.GroupVersionKind.GroupKind())
+	return &controllerObject{owners: obj.GetOwnerReferences(), resourceVersion: obj.GetResourceVersion(), object: obj}, nil
+}
 
-	return owner, nil
+// getOwnersFromDynamicClient reads owners of a controller whose scale subresource doesn't carry them. Many
+// custom resources don't copy owner references to their scale subresource, which would otherwise make
+// resolution stop at them. Failures (typically missing RBAC) are only logged and the controller is treated
+// as having no owners.
+func (f *controllerFetcher) getOwnersFromDynamicClient(restMapping *apimeta.RESTMapping, controllerKey ControllerKeyWithAPIVersion) []metav1.OwnerReference {
+	if f.dynamicClient == nil {
+		return nil
+	}
+	obj, err := f.dynamicResource(restMapping, controllerKey.Namespace).Get(controllerKey.Name, metav1.GetOptions{})
+	if err != nil {
+		klog.V(4).Infof("Failed to read owners of %s %s/%s: %v", controllerKey.Kind, controllerKey.Namespace, controllerKey.Name, err)
+		return nil
+	}
+	return obj.GetOwnerReferences()
 }
 
-func (f *controllerFetcher) getOwnerForScaleResource(groupKind schema.GroupKind, namespace, name string) (*ControllerKeyWithAPIVersion, error) {
+// getScaleMapping returns the GroupKind and REST mappings for the given API version and kind, caching them until
+// the next mapper reset.
+func (f *controllerFetcher) getScaleMapping(apiVersion, kind string) (*scaleMapping, error) {
+	key := scaleMappingKey{apiVersion: apiVersion, kind: kind}
+	f.scaleMappingsMutex.Lock()
+	mapping, found := f.scaleMappings[key]
+	f.scaleMappingsMutex.Unlock()
+	if found {
+		return mapping, nil
+	}
+
+	groupKind, err := scaleGroupKind(apiVersion, kind)
+	if err != nil {
+		return nil, err
+	}
 	mappings, err := f.mapper.RESTMappings(groupKind)
 	if err != nil {
 		return nil, err
 	}
+	preferred, err := f.mapper.RESTMapping(groupKind)
+	if err != nil {
+		preferred = nil
+	}
+	sortMappings(mappings, preferred)
+	mapping = &scaleMapping{groupKind: groupKind, mappings: mappings}
+
+	f.scaleMappingsMutex.Lock()
+	defer f.scaleMappingsMutex.Unlock()
+	if f.scaleMappings == nil {
+		f.scaleMappings = make(map[scaleMappingKey]*scaleMapping)
+	}
+	f.scaleMappings[key] = mapping
+	return mapping, nil
+}
+
+// sortMappings sorts the given mappings so that versions are tried in a stable order whatever the order the
+// mapper returned them in: the preferred mapping first, if known, then by group version.
+func sortMappings(mappings []*apimeta.RESTMapping, preferred *apimeta.RESTMapping) {
+	rank := func(mapping *apimeta.RESTMapping) int {
+		if preferred != nil && mapping.GroupVersionKind == preferred.GroupVersionKind {
+			return 0
+		}
+		return 1
+	}
+	sort.SliceStable(mappings, func(i, j int) bool {
+		if rank(mappings[i]) != rank(mappings[j]) {
+			return rank(mappings[i]) < rank(mappings[j])
+		}
+		return mappings[i].GroupVersionKind.GroupVersion().String() < mappings[j].GroupVersionKind.GroupVersion().String()
+	})
+}
+
+// scaleGroupKind returns the GroupKind of the given kind of the given API version. Core kinds have no group
+// in their API version ("v1"), but custom KeyCanonicalizers may let through "core/v1", which the RESTMapper
+// doesn't know. Both are mapped to the empty group core kinds are served under.
+func scaleGroupKind(apiVersion, kind string) (schema.GroupKind, error) {
+	groupVersion, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return schema.GroupKind{}, err
+	}
+	if groupVersion.Group == "core" {
+		groupVersion.Group = ""
+	}
+	return schema.GroupKind{Group: groupVersion.Group, Kind: kind}, nil
+}
+
+// resetMapper resets the discovery information of the mapper, together with everything derived from it.
+// Purged resolutions of well-known controllers are preloaded again if they're cached eagerly.
+func (f *controllerFetcher) resetMapper() {
+	f.resetDiscovery()
+	if cache := f.resultCache(); cache != nil {
+		cache.Purge()
+	}
+	if f.stepCache != nil {
+		f.stepCache.purge()
+	}
+	f.requeueEagerCache()
+}
+
+// resetDiscovery resets the discovery information of the mapper and the mappings derived from it.
+func (f *controllerFetcher) resetDiscovery() {
+	if mapper, ok := f.mapper.(resettableRESTMapper); ok {
+		mapper.Reset()
+	}
+	f.scaleMappingsMutex.Lock()
+	defer f.scaleMappingsMutex.Unlock()
+	f.scaleMappings = nil
+	f.canonicalKinds = nil
+	// resetStaleMapper may have claimed the reset at a later time already.
+	if now := time.Now(); now.After(f.lastMapperReset) {
+		f.lastMapperReset = now
+	}
+}
+
+// resultCache returns the cache of resolutions, nil if they aren't cached.
+func (f *controllerFetcher) resultCache() Cache {
+	if f.cache != nil {
+		return f.cache
+	}
+	if f.resolutionCache != nil {
+		return f.resolutionCache
+	}
+	return nil
+}
+
+// resetStaleMapper resets the mapper unless it was reset less than minMapperResetInterval ago. Of concurrent
+// callers, only the first resets it.
+func (f *controllerFetcher) resetStaleMapper(now time.Time) {
+	f.scaleMappingsMutex.Lock()
+	recentlyReset := now.Sub(f.lastMapperReset) < minMapperResetInterval
+	if !recentlyReset {
+		f.lastMapperReset = now
+	}
+	f.scaleMappingsMutex.Unlock()
+	if !recentlyReset {
+		klog.V(4).Infof("Resetting RESTMapper because of a stale mapping")
+		f.resetMapper()
+	}
+}
 
-	var lastError error
-	for _, mapping := range mappings {
+// isMissingResource tells whether the error means the requested resource type isn't served, as opposed to the
+// requested object not existing. The API server responds to requests for unknown resources without a Status,
+// which clients report as an unexpected response.
+func isMissingResource(err error) bool {
+	if !k8serrors.IsNotFound(err) {
+		return false
+	}
+	status, ok := err.(k8serrors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return false
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type == metav1.CauseTypeUnexpectedServerResponse {
+			return true
+		}
+	}
+	return false
+}
+
+// getScaleResource returns the scale subresource of the given controller together with the REST mapping it
+// was found with. It returns either both or an error, so that a scale without owners is never confused with
+// all reads failing. If none of the mappings works, the error is a *ScaleResolutionError; a kind without
+// mappings fails with ErrNoScaleMapping.
+func (f *controllerFetcher) getScaleResource(ctx context.Context, scaleMapping *scaleMapping, namespace, name string) (*autoscalingv1.Scale, *apimeta.RESTMapping, error) {
+	if len(scaleMapping.mappings) == 0 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrNoScaleMapping, scaleMapping.groupKind)
+	}
+	scaleErr := &ScaleResolutionError{GroupKind: scaleMapping.groupKind}
+	for _, mapping := range scaleMapping.mappings {
 		groupResource := mapping.Resource.GroupResource()
-		scale, err := f.scaleNamespacer.Scales(namespace).Get(groupResource, name)
+		if namespace == "" && mapping.Scope.Name() == apimeta.RESTScopeNameNamespace {
+			scaleErr.Attempts = append(scaleErr.Attempts, ScaleAttempt{
+				GroupResource: groupResource,
+				Err:           fmt.Errorf("%w: %s %s", ErrMissingNamespace, groupResource, name),
+			})
+			continue
+		}
+		scale, err := f.getScale(ctx, scaleMapping.groupKind, namespace, groupResource, name)
+		if err == nil && scale == nil {
+			err = fmt.Errorf("%w: %s %s/%s", ErrEmptyScale, groupResource, namespace, name)
+		}
 		if err == nil {
-			return getOwnerController(scale.OwnerReferences, namespace), nil
+			return scale, mapping, nil
 		}
-		lastError = err
+		scaleErr.Attempts = append(scaleErr.Attempts, ScaleAttempt{GroupResource: groupResource, Err: err})
 	}
 
 	// nothing found, apparently the resource doesn't support scale (or we lack RBAC)
-	return nil, lastError
+	return nil, nil, scaleErr
+}
+
+func (f *controllerFetcher) Stop() {
+	f.stopOnce.Do(func() {
+		if f.stopCh != nil {
+			close(f.stopCh)
+		}
+		unsubscribeInformerErrors(f.informerErrors)
+	})
 }
 
 func (f *controllerFetcher) FindTopLevel(key *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error) {
+	return f.FindTopLevelWithContext(context.Background(), key)
+}
+
+func (f *controllerFetcher) FindTopLevelWithContext(ctx context.Context, key *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error) {
+	result, err := f.FindTopLevelDetailed(ctx, key)
+	if result == nil {
+		return nil, err
+	}
+	return result.TopLevel, err
+}
+
+func (f *controllerFetcher) FindTopLevelDetailed(ctx context.Context, key *ControllerKeyWithAPIVersion) (*FindTopLevelResult, error) {
+	result, err := f.findTopLevelDetailed(ctx, key)
+	return f.transformResult(result), err
+}
+
+// findTopLevelDetailed is FindTopLevelDetailed without Options.NameTransformer applied, for lookups which need
+// the real name of the top level controller.
+func (f *controllerFetcher) findTopLevelDetailed(ctx context.Context, key *ControllerKeyWithAPIVersion) (*FindTopLevelResult, error) {
 	if key == nil {
 		return nil, nil
 	}
-	visited := make(map[ControllerKeyWithAPIVersion]bool)
-	visited[*key] = true
-	for {
-		owner, err := f.getParentOfController(*key)
+	ctx, requestID := ensureRequestID(ctx)
+	start := f.canonicalKey(*key)
+	start.ResourceVersion = ""
+	cache := f.resultCache()
+	if cache != nil {
+		if entry, found := cache.Get(start); found {
+			if f.recordMetrics {
+				metrics_recommender.RecordControllerFetcherCacheLookup(cacheHit)
+				metrics_recommender.RecordControllerFetcherResolution(resolutionOutcome(entry.Err))
+			}
+			if entry.Err != nil {
+				f.notifyResolve(ResolveEvent{Controller: start, Err: entry.Err, Cached: true, RequestID: requestID})
+				return nil, entry.Err
+			}
+			f.notifyResolve(ResolveEvent{Controller: start, TopLevel: copyKey(entry.Result.TopLevel), Cached: true,
+				RequestID: requestID})
+			return copyResult(entry.Result), nil
+		}
+	}
+	var res *resolution
+	result, shared, err := f.flights.do(ctx, start, func() (*FindTopLevelResult, error) {
+		var result *FindTopLevelResult
+		var err error
+		res, result, err = f.resolveUncached(ctx, start, cache)
+		return result, err
+	})
+	if f.recordMetrics {
+		lookup := cacheMiss
+		if shared {
+			lookup = cacheShared
+		}
+		metrics_recommender.RecordControllerFetcherCacheLookup(lookup)
+	}
+	f.recordResolution(start, requestID, res, result, shared, err)
+	return result, err
+}
+
+// resolveUncached resolves the top level controller of the given canonical key and caches the result, or the
+// failure, in the given cache if it isn't nil.
+func (f *controllerFetcher) resolveUncached(ctx context.Context, start ControllerKeyWithAPIVersion, cache Cache) (*resolution, *FindTopLevelResult, error) {
+	res, err := f.findTopLevel(ctx, &start)
+	if err != nil {
+		if cache != nil && cacheableFailure(err) {
+			cache.Set(start, CacheEntry{Err: err})
+		}
+		return res, nil, err
+	}
+	result := f.newFindTopLevelResult(res)
+	if cache != nil {
+		cache.Set(start, CacheEntry{Result: copyResult(result)})
+	}
+	return res, result, nil
+}
+
+// recordResolution records the outcome of a FindTopLevel call which wasn't served from the cache, for every
+// caller, including those whose resolution was collapsed into a concurrent one (shared). res is the resolution
+// of the caller which read the controllers, nil for callers which shared it.
+func (f *controllerFetcher) recordResolution(start ControllerKeyWithAPIVersion, requestID string, res *resolution,
+	result *FindTopLevelResult, shared bool, err error) {
+	if f.recordMetrics {
+		metrics_recommender.RecordControllerFetcherResolution(resolutionOutcome(err))
+	}
+	if f.health != nil {
+		f.health.record(time.Now(), err)
+	}
+	event := ResolveEvent{Controller: start, Err: err, Shared: shared, RequestID: requestID}
+	if res != nil {
+		event.TopLevel, event.Hops, event.Paths = copyKey(res.topLevel), res.hops, res.paths
+	} else if result != nil {
+		event.TopLevel, event.Hops = copyKey(result.TopLevel), result.HopCount
+	}
+	f.notifyResolve(event)
+	if err != nil {
+		klog.V(4).Infof("Request %s: failed to resolve top level controller of %s %s/%s: %v", requestID, start.Kind,
+			start.Namespace, start.Name, err)
+		f.recentErrors.add(RecentError{Controller: start, Err: err, Time: time.Now()})
+		return
+	}
+	klog.V(4).Infof("Request %s: resolved top level controller of %s %s/%s to %s %s/%s", requestID, start.Kind,
+		start.Namespace, start.Name, result.TopLevel.Kind, result.TopLevel.Namespace, result.TopLevel.Name)
+	f.recordDepth(start, result)
+}
+
+// refreshResolutionCache re-resolves cached controllers whose entries are about to expire. Entries of
+// controllers which no longer exist are invalidated, entries of controllers which fail to resolve otherwise are
+// left to expire.
+func (f *controllerFetcher) refreshResolutionCache() {
+	for _, key := range f.resolutionCache.dueForRefresh(time.Now()) {
+		res, err := f.findTopLevel(withFreshReads(context.Background()), &key)
+		if errors.Is(err, ErrControllerNotFound) {
+			f.resolutionCache.invalidate(key)
+		}
+		if err != nil {
+			klog.V(4).Infof("Failed to refresh top level controller of %s %s/%s: %v", key.Kind, key.Namespace, key.Name, err)
+			continue
+		}
+		f.resolutionCache.set(key, *f.newFindTopLevelResult(res), time.Now())
+	}
+}
+
+// findTopLevel resolves the top level controller of the given controller. The returned resolution is never
+// nil, on error it describes how far resolution got. The context and the resolution timeout are checked before
+// reading each controller, reads themselves aren't interrupted.
+func (f *controllerFetcher) findTopLevel(ctx context.Context, key *ControllerKeyWithAPIVersion) (*resolution, error) {
+	return f.findAncestor(ctx, key, nil)
+}
+
+// findAncestor is findTopLevel which stops at the first controller for which stop returns true, if stop isn't
+// nil. The resolution is marked as stopped then.
+func (f *controllerFetcher) findAncestor(ctx context.Context, key *ControllerKeyWithAPIVersion,
+	stop func(ControllerKeyWithAPIVersion, *controllerObject) bool) (*resolution, error) {
+	if f.resolutionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.resolutionTimeout)
+		defer cancel()
+	}
+	start := f.canonicalKey(*key)
+	res := &resolution{last: start}
+	if err := f.resolutionLimiter.acquire(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return res, &ResolutionTimeoutError{}
+		}
+		return res, err
+	}
+	defer f.resolutionLimiter.release()
+	step := func(ctx context.Context, key ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error) {
+		controller, err := f.resolveStep(ctx, key)
 		if err != nil {
 			return nil, err
 		}
+		res.paths = append(res.paths, controller.path)
+		res.chain = append(res.chain, key)
+		res.controller = controller
+		if !isTerminating(controller) {
+			res.live = true
+		}
+		if stop != nil && stop(key, controller) {
+			res.stopped = true
+			return nil, nil
+		}
+		owner, inferred := f.ownerController(controller.owners, key.Namespace)
+		if inferred {
+			klog.V(4).Infof("No controller of %s %s/%s, following %s %s blocking its deletion", key.Kind, key.Namespace,
+				key.Name, owner.Kind, owner.Name)
+			res.inferredOwner = true
+		}
 		if owner == nil {
-			return key, nil
+			if owner = f.cronJobFromMetadata(key, controller); owner != nil {
+				klog.V(4).Infof("Job %s/%s has no owner, following CronJob %s named in its metadata", key.Namespace,
+					key.Name, owner.Name)
+				res.inferredOwner = true
+			}
 		}
-		_, alreadyVisited := visited[*owner]
-		if alreadyVisited {
-			return nil, fmt.Errorf("Cycle detected in ownership chain")
+		if owner != nil {
+			var hinted bool
+			if *owner, hinted = f.hintedOwner(key, *owner); !hinted {
+				*owner = f.canonicalKey(*owner)
+			}
+			res.hintedTopLevel = hinted
+			if err := checkSelfOwnership(key, *owner); err != nil {
+				return nil, err
+			}
+			if err := f.checkOwnerKind(key, *owner); err != nil {
+				return nil, err
+			}
+			if err := f.checkDeploymentOwners(key, controller.owners); err != nil {
+				return nil, err
+			}
+			if err := f.checkOwnerNamespace(key, controller.owners, *owner); err != nil {
+				return nil, err
+			}
+			res.hops++
 		}
-		visited[*key] = true
-		key = owner
+		return owner, nil
+	}
+	chain, err := WalkOwners(ctx, start, step)
+	if len(chain) > 0 {
+		res.last = chain[len(chain)-1]
+	}
+	if err != nil {
+		res.controller = nil
+		if errors.Is(err, context.DeadlineExceeded) {
+			return res, &ResolutionTimeoutError{Chain: res.chain}
+		}
+		return res, err
+	}
+	topLevel := chain[len(chain)-1]
+	topLevel.ResourceVersion = res.controller.resourceVersion
+	if f.inferOwners && !res.stopped && res.controller.path != TerminalPath {
+		if manager := inferManager(res.controller.object); manager != "" {
+			return res, &InferredOwnerError{TopLevel: topLevel, Manager: manager}
+		}
+	}
+	if f.rejectTerminatingTargets && !res.stopped && !res.live {
+		return res, fmt.Errorf("%w: %s %s/%s", ErrTargetTerminating, topLevel.Kind, topLevel.Namespace, topLevel.Name)
+	}
+	res.topLevel = &topLevel
+	return res, nil
+}
+
+func (f *controllerFetcher) FindTopLevelForPod(ctx context.Context, pod *corev1.Pod) (*ControllerKeyWithAPIVersion, error) {
+	result, err := f.FindTopLevelDetailedForPod(ctx, pod)
+	if result == nil {
+		return nil, err
+	}
+	return result.TopLevel, err
+}
+
+func (f *controllerFetcher) FindTopLevelDetailedForPod(ctx context.Context, pod *corev1.Pod) (*FindTopLevelResult, error) {
+	if pod == nil {
+		return nil, nil
+	}
+	podKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{Namespace: pod.Namespace, Kind: "Pod", Name: pod.Name}, ApiVersion: "v1"}
+	// Resolution of the owner notifies by itself, Pods answered without it are notified about here.
+	answer := func(result *FindTopLevelResult, err error) (*FindTopLevelResult, error) {
+		var topLevel *ControllerKeyWithAPIVersion
+		if result != nil {
+			topLevel = result.TopLevel
+		}
+		f.notifyAnswered(ctx, podKey, topLevel, err)
+		return result, err
+	}
+	owner, _ := f.ownerController(pod.OwnerReferences, pod.Namespace)
+	if owner == nil {
+		if !f.allowStandalonePods {
+			return answer(nil, fmt.Errorf("%w: Pod %s/%s", ErrNoController, pod.Namespace, pod.Name))
+		}
+		return answer(f.podAsTopLevel(pod), nil)
+	}
+	canonicalOwner := f.canonicalKey(*owner)
+	if isNodeOwner(canonicalOwner) {
+		return answer(f.resolveMirrorPod(pod, canonicalOwner))
+	}
+	if err := f.checkOwnerKind(podKey, canonicalOwner); err != nil {
+		return answer(nil, err)
+	}
+	result, err := f.FindTopLevelDetailed(ctx, owner)
+	if result != nil {
+		result.StatefulSetOrdinal = statefulSetOrdinal(pod.Name, canonicalOwner)
+		result.CompletionIndex = jobCompletionIndex(pod, canonicalOwner)
+	}
+	return result, err
+}
+
+func (f *controllerFetcher) FindAllTopLevels(ctx context.Context, key *ControllerKeyWithAPIVersion) ([]*ControllerKeyWithAPIVersion, error) {
+	if key == nil {
+		return nil, nil
+	}
+	// The goroutine calling FindAllTopLevels resolves branches too.
+	branches := make(chan struct{}, f.resolutionWorkers()-1)
+	found, err := f.findAllTopLevels(ctx, *key, nil, branches)
+	if err != nil {
+		return nil, err
+	}
+	var topLevels []*ControllerKeyWithAPIVersion
+	seen := make(map[ControllerKeyWithAPIVersion]bool)
+	for i := range found {
+		if !seen[found[i]] {
+			seen[found[i]] = true
+			topLevels = append(topLevels, f.transformKey(&found[i]))
+		}
+	}
+	return topLevels, nil
+}
+
+// checkSelfOwnership returns ErrSelfOwnership if the owner is the controller itself. Both keys must be canonical.
+func checkSelfOwnership(controller, owner ControllerKeyWithAPIVersion) error {
+	if owner.ControllerKey != controller.ControllerKey || apiGroup(owner.ApiVersion) != apiGroup(controller.ApiVersion) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s/%s, %w", ErrSelfOwnership, controller.Kind, controller.Namespace, controller.Name, ErrOwnershipCycle)
+}
+
+// apiGroup returns the group of the given API version, or the API version itself if it can't be parsed.
+func apiGroup(apiVersion string) string {
+	groupVersion, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return apiVersion
+	}
+	return groupVersion.Group
+}
+
+// findAllTopLevels walks the ownership graph depth first and returns the top level controllers of the given
+// controller in the order of its owners, with duplicates. path holds the controllers on the way to it. Owners
+// but the last are resolved in goroutines of their own while a token of branches is available, so that the
+// branches of ownership graphs are walked at the same time. Cycles are detected per branch: a branch leading
+// back to one of its controllers is dropped, unless all branches are, in which case the cycle is returned.
+// Other errors fail the whole resolution.
+func (f *controllerFetcher) findAllTopLevels(ctx context.Context, key ControllerKeyWithAPIVersion,
+	path map[ControllerKeyWithAPIVersion]bool, branches chan struct{}) ([]ControllerKeyWithAPIVersion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key = f.canonicalKey(key)
+	if path[key] {
+		return nil, ErrOwnershipCycle
+	}
+
+	controller, err := f.resolveStep(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	owners := getOwnerControllers(controller.owners, key.Namespace)
+	if len(owners) == 0 {
+		key.ResourceVersion = controller.resourceVersion
+		return []ControllerKeyWithAPIVersion{key}, nil
+	}
+	// Branches share the path, so it's copied rather than modified.
+	ownerPath := make(map[ControllerKeyWithAPIVersion]bool, len(path)+1)
+	for ancestor := range path {
+		ownerPath[ancestor] = true
+	}
+	ownerPath[key] = true
+
+	results := make([][]ControllerKeyWithAPIVersion, len(owners))
+	errs := make([]error, len(owners))
+	var wg sync.WaitGroup
+	for i := range owners {
+		i := i
+		resolve := func() {
+			if errs[i] = checkSelfOwnership(key, f.canonicalKey(owners[i])); errs[i] == nil {
+				results[i], errs[i] = f.findAllTopLevels(ctx, owners[i], ownerPath, branches)
+			}
+		}
+		if i < len(owners)-1 {
+			select {
+			case branches <- struct{}{}:
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-branches }()
+					resolve()
+				}()
+				continue
+			default:
+			}
+		}
+		resolve()
+	}
+	wg.Wait()
+
+	var topLevels []ControllerKeyWithAPIVersion
+	var cycle error
+	for i, err := range errs {
+		if errors.Is(err, ErrOwnershipCycle) {
+			klog.V(4).Infof("Dropping owner %s %s/%s of %s %s/%s: %v", owners[i].Kind, key.Namespace, owners[i].Name,
+				key.Kind, key.Namespace, key.Name, err)
+			cycle = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		topLevels = append(topLevels, results[i]...)
+	}
+	if len(topLevels) == 0 && cycle != nil {
+		return nil, cycle
 	}
+	return topLevels, nil
 }
 
 type identityControllerFetcher struct {
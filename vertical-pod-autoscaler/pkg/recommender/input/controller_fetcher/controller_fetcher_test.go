@@ -17,15 +17,33 @@ limitations under the License.
 package controllerfetcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	goruntime "runtime"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/scale"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -50,6 +68,154 @@ func addController(controller *controllerFetcher, obj runtime.Object) {
 	controller.informersMap[kind].GetStore().Add(obj)
 }
 
+func newCustomInformer() cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{},
+		&unstructured.Unstructured{},
+		time.Duration(-1),
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+func newUnstructured(apiVersion, kind, namespace, name string, owners ...metav1.OwnerReference) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetOwnerReferences(owners)
+	return obj
+}
+
+type scaleKey struct {
+	groupResource schema.GroupResource
+	namespace     string
+	name          string
+}
+
+// fakeScalesGetter serves scale subresources from memory.
+type fakeScalesGetter struct {
+	scales map[scaleKey]*autoscalingv1.Scale
+	// delay is added to each Get.
+	delay time.Duration
+	// missingResources aren't served anymore, as if their CRD was deleted.
+	missingResources map[schema.GroupResource]bool
+	// throttled holds the number of Gets of a scale which are throttled (answered with a 429) before it's
+	// served, negative to throttle forever.
+	throttled  map[scaleKey]int
+	retryAfter int
+	// unavailable holds the number of Gets of a scale which are answered with a 503 before it's served.
+	unavailable map[scaleKey]int
+	// blocked holds channels Gets of scales of the resources wait on until they're closed.
+	blocked map[schema.GroupResource]chan struct{}
+	// mutex guards gets, throttled and unavailable, scales are only added before Gets.
+	mutex sync.Mutex
+	gets  int
+}
+
+func newFakeScalesGetter() *fakeScalesGetter {
+	return &fakeScalesGetter{scales: make(map[scaleKey]*autoscalingv1.Scale)}
+}
+
+func (f *fakeScalesGetter) add(groupResource schema.GroupResource, s *autoscalingv1.Scale) {
+	f.scales[scaleKey{groupResource, s.Namespace, s.Name}] = s
+}
+
+func (f *fakeScalesGetter) Scales(namespace string) scale.ScaleInterface {
+	return &fakeScaleInterface{getter: f, namespace: namespace}
+}
+
+type fakeScaleInterface struct {
+	getter    *fakeScalesGetter
+	namespace string
+}
+
+func (f *fakeScaleInterface) Get(groupResource schema.GroupResource, name string) (*autoscalingv1.Scale, error) {
+	time.Sleep(f.getter.delay)
+	f.getter.mutex.Lock()
+	f.getter.gets++
+	key := scaleKey{groupResource, f.namespace, name}
+	throttled := f.getter.throttled[key]
+	if throttled != 0 {
+		f.getter.throttled[key] = throttled - 1
+	}
+	unavailable := f.getter.unavailable[key]
+	if unavailable > 0 {
+		f.getter.unavailable[key] = unavailable - 1
+	}
+	f.getter.mutex.Unlock()
+	if blocked, found := f.getter.blocked[groupResource]; found {
+		<-blocked
+	}
+	if throttled != 0 {
+		return nil, k8serrors.NewTooManyRequests("throttled", f.getter.retryAfter)
+	}
+	if unavailable > 0 {
+		return nil, k8serrors.NewServiceUnavailable("unavailable")
+	}
+	if f.getter.missingResources[groupResource] {
+		return nil, k8serrors.NewGenericServerResponse(404, "GET", groupResource, name, "404 page not found", 0, true)
+	}
+	s, found := f.getter.scales[scaleKey{groupResource, f.namespace, name}]
+	if !found {
+		return nil, k8serrors.NewNotFound(groupResource, name)
+	}
+	return s, nil
+}
+
+func (f *fakeScaleInterface) Update(groupResource schema.GroupResource, s *autoscalingv1.Scale) (*autoscalingv1.Scale, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+// fakeDynamicClient serves unstructured objects from memory. Only Get is implemented.
+type fakeDynamicClient struct {
+	objects map[scaleKey]*unstructured.Unstructured
+}
+
+func newFakeDynamicClient() *fakeDynamicClient {
+	return &fakeDynamicClient{objects: make(map[scaleKey]*unstructured.Unstructured)}
+}
+
+func (f *fakeDynamicClient) add(groupResource schema.GroupResource, obj *unstructured.Unstructured) {
+	f.objects[scaleKey{groupResource, obj.GetNamespace(), obj.GetName()}] = obj
+}
+
+func (f *fakeDynamicClient) Resource(resource schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &fakeDynamicResource{client: f, groupResource: resource.GroupResource()}
+}
+
+type fakeDynamicResource struct {
+	dynamic.NamespaceableResourceInterface
+	client        *fakeDynamicClient
+	groupResource schema.GroupResource
+	namespace     string
+}
+
+func (f *fakeDynamicResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return &fakeDynamicResource{client: f.client, groupResource: f.groupResource, namespace: namespace}
+}
+
+func (f *fakeDynamicResource) List(opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	list := &unstructured.UnstructuredList{}
+	for key, obj := range f.client.objects {
+		if key.groupResource == f.groupResource && (f.namespace == "" || key.namespace == f.namespace) {
+			list.Items = append(list.Items, *obj)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeDynamicResource) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	return watch.NewFake(), nil
+}
+
+func (f *fakeDynamicResource) Get(name string, options metav1.GetOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	obj, found := f.client.objects[scaleKey{f.groupResource, f.namespace, name}]
+	if !found {
+		return nil, k8serrors.NewNotFound(f.groupResource, name)
+	}
+	return obj, nil
+}
+
 func TestControllerFetcher(t *testing.T) {
 	type testCase struct {
 		apiVersion    string
@@ -138,7 +304,7 @@ func TestControllerFetcher(t *testing.T) {
 				},
 			}},
 			expectedKey:   nil,
-			expectedError: fmt.Errorf("Cycle detected in ownership chain"),
+			expectedError: fmt.Errorf("controller is its own owner: Deployment test-namesapce/test-deployment, Cycle detected in ownership chain"),
 		},
 	} {
 		t.Run(fmt.Sprintf("test case %d", i), func(t *testing.T) {
@@ -155,8 +321,1225 @@ func TestControllerFetcher(t *testing.T) {
 			if tc.expectedError == nil {
 				assert.Nil(t, err)
 			} else {
-				assert.Equal(t, tc.expectedError, err)
+				assert.EqualError(t, err, tc.expectedError.Error())
+			}
+		})
+	}
+}
+
+func TestControllerFetcherLite(t *testing.T) {
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					Controller: &trueVar,
+					Kind:       "Deployment",
+					Name:       "test-deployment",
+				},
+			},
+		},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-deployment",
+			Namespace: "test-namespace",
+		},
+	}
+	f := &controllerFetcher{
+		informersMap: make(map[wellKnownController]cache.SharedIndexInformer),
+		kubeClient:   fake.NewSimpleClientset(rs, deployment),
+	}
+
+	topLevelController, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}, topLevelController)
+
+	_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.EqualError(t, err, "ReplicaSet test-namespace/missing-rs does not exist")
+	assert.True(t, errors.Is(err, ErrControllerNotFound))
+}
+
+func TestControllerFetcherMissingNamespace(t *testing.T) {
+	namespacedKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	clusterKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "ClusterWidget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{namespacedKind.GroupVersion()})
+	mapper.Add(namespacedKind, apimeta.RESTScopeNamespace)
+	mapper.Add(clusterKind, apimeta.RESTScopeRoot)
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "clusterwidgets"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster-widget"},
+	})
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+
+	_, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment"}})
+	assert.True(t, errors.Is(err, ErrMissingNamespace), "unexpected error: %v", err)
+
+	_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget"}, ApiVersion: "example.com/v1"})
+	assert.True(t, errors.Is(err, ErrMissingNamespace), "unexpected error: %v", err)
+
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-cluster-widget", Kind: "ClusterWidget"}, ApiVersion: "example.com/v1"}
+	topLevelController, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, topLevelController)
+}
+
+func TestFindAllTopLevels(t *testing.T) {
+	sharedRS := &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Deployment", Name: "deployment-a"},
+				{Kind: "Deployment", Name: "deployment-b"},
+			},
+		},
+	}
+	deploymentA := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "deployment-a", Namespace: "test-namespace"},
+	}
+	deploymentB := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "deployment-b", Namespace: "test-namespace"},
+	}
+	deploymentBOwnedByA := deploymentB.DeepCopy()
+	deploymentBOwnedByA.OwnerReferences = []metav1.OwnerReference{
+		{Controller: &trueVar, Kind: "Deployment", Name: "deployment-a"},
+	}
+	// deployment-a and deployment-b are both controlled by deployment-c, so that the graph is a diamond.
+	deploymentAOwnedByC := deploymentA.DeepCopy()
+	deploymentAOwnedByC.OwnerReferences = []metav1.OwnerReference{
+		{Controller: &trueVar, Kind: "Deployment", Name: "deployment-c"},
+	}
+	deploymentBOwnedByC := deploymentB.DeepCopy()
+	deploymentBOwnedByC.OwnerReferences = deploymentAOwnedByC.OwnerReferences
+	deploymentC := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "deployment-c", Namespace: "test-namespace"},
+	}
+	// deployment-a leading back to the ReplicaSet closes a cycle in its branch only.
+	deploymentAOwnedByRS := deploymentA.DeepCopy()
+	deploymentAOwnedByRS.OwnerReferences = []metav1.OwnerReference{
+		{Controller: &trueVar, Kind: "ReplicaSet", Name: "test-rs"},
+	}
+	deploymentBOwnedByRS := deploymentB.DeepCopy()
+	deploymentBOwnedByRS.OwnerReferences = deploymentAOwnedByRS.OwnerReferences
+	keyA := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "deployment-a", Kind: "Deployment", Namespace: "test-namespace"}}
+	keyB := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "deployment-b", Kind: "Deployment", Namespace: "test-namespace"}}
+	keyC := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "deployment-c", Kind: "Deployment", Namespace: "test-namespace"}}
+
+	for _, tc := range []struct {
+		name         string
+		objects      []runtime.Object
+		expectedKeys []*ControllerKeyWithAPIVersion
+		expectedErr  error
+	}{
+		{
+			name:         "distinct owners",
+			objects:      []runtime.Object{sharedRS, deploymentA, deploymentB},
+			expectedKeys: []*ControllerKeyWithAPIVersion{keyA, keyB},
+		},
+		{
+			name:         "owners with common top level",
+			objects:      []runtime.Object{sharedRS, deploymentA, deploymentBOwnedByA},
+			expectedKeys: []*ControllerKeyWithAPIVersion{keyA},
+		},
+		{
+			name:         "diamond",
+			objects:      []runtime.Object{sharedRS, deploymentAOwnedByC, deploymentBOwnedByC, deploymentC},
+			expectedKeys: []*ControllerKeyWithAPIVersion{keyC},
+		},
+		{
+			name:         "cycle in one branch",
+			objects:      []runtime.Object{sharedRS, deploymentAOwnedByRS, deploymentB},
+			expectedKeys: []*ControllerKeyWithAPIVersion{keyB},
+		},
+		{
+			name:        "cycle in all branches",
+			objects:     []runtime.Object{sharedRS, deploymentAOwnedByRS, deploymentBOwnedByRS},
+			expectedErr: ErrOwnershipCycle,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := simpleControllerFetcher()
+			for _, obj := range tc.objects {
+				addController(f, obj)
+			}
+			topLevels, err := f.FindAllTopLevels(context.Background(), &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+			if tc.expectedErr != nil {
+				assert.True(t, errors.Is(err, tc.expectedErr), "unexpected error: %v", err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedKeys, topLevels)
+		})
+	}
+}
+
+func TestFindAllTopLevelsConcurrentBranches(t *testing.T) {
+	groupVersion := schema.GroupVersion{Group: "example.com", Version: "v1"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{groupVersion})
+	mapper.Add(groupVersion.WithKind("SlowApp"), apimeta.RESTScopeNamespace)
+	mapper.Add(groupVersion.WithKind("FastApp"), apimeta.RESTScopeNamespace)
+	slowApps := schema.GroupResource{Group: "example.com", Resource: "slowapps"}
+	fastApps := schema.GroupResource{Group: "example.com", Resource: "fastapps"}
+	scales := newFakeScalesGetter()
+	scales.add(slowApps, &autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{Name: "test-slow", Namespace: "test-namespace"}})
+	scales.add(fastApps, &autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{Name: "test-fast", Namespace: "test-namespace"}})
+	unblock := make(chan struct{})
+	scales.blocked = map[schema.GroupResource]chan struct{}{slowApps: unblock}
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "example.com/v1", Kind: "SlowApp", Name: "test-slow"},
+				{APIVersion: "example.com/v1", Kind: "FastApp", Name: "test-fast"},
+			},
+		},
+	})
+
+	type result struct {
+		topLevels []*ControllerKeyWithAPIVersion
+		err       error
+	}
+	done := make(chan result, 1)
+	go func() {
+		topLevels, err := f.FindAllTopLevels(context.Background(), &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+		done <- result{topLevels, err}
+	}()
+	// The FastApp is read while the read of the SlowApp is blocked.
+	err := wait.PollImmediate(time.Millisecond, 5*time.Second, func() (bool, error) {
+		scales.mutex.Lock()
+		defer scales.mutex.Unlock()
+		return scales.gets >= 2, nil
+	})
+	close(unblock)
+	assert.NoError(t, err)
+	res := <-done
+	assert.NoError(t, res.err)
+	assert.Equal(t, []*ControllerKeyWithAPIVersion{
+		{ControllerKey: ControllerKey{Name: "test-slow", Kind: "SlowApp", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"},
+		{ControllerKey: ControllerKey{Name: "test-fast", Kind: "FastApp", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"},
+	}, res.topLevels)
+}
+
+// countingRESTMapper counts RESTMappings calls of the underlying mapper.
+type countingRESTMapper struct {
+	apimeta.RESTMapper
+	restMappingsCalls int
+	// mutex guards resets, which may be concurrent.
+	mutex  sync.Mutex
+	resets int
+}
+
+func (m *countingRESTMapper) RESTMappings(gk schema.GroupKind, versions ...string) ([]*apimeta.RESTMapping, error) {
+	m.restMappingsCalls++
+	return m.RESTMapper.RESTMappings(gk, versions...)
+}
+
+func (m *countingRESTMapper) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.resets++
+}
+
+func TestScaleMappingsCache(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	defaultMapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	defaultMapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	mapper := &countingRESTMapper{RESTMapper: defaultMapper}
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "widgets"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-widget", Namespace: "test-namespace"},
+	})
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+
+	for i := 0; i < 3; i++ {
+		_, err := f.FindTopLevel(key)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, mapper.restMappingsCalls)
+
+	f.resetMapper()
+	assert.Equal(t, 1, mapper.resets)
+	_, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, mapper.restMappingsCalls)
+}
+
+// reversingRESTMapper returns RESTMappings of the underlying mapper in reverse order.
+type reversingRESTMapper struct {
+	apimeta.RESTMapper
+}
+
+func (m *reversingRESTMapper) RESTMappings(gk schema.GroupKind, versions ...string) ([]*apimeta.RESTMapping, error) {
+	mappings, err := m.RESTMapper.RESTMappings(gk, versions...)
+	for i, j := 0, len(mappings)-1; i < j; i, j = i+1, j-1 {
+		mappings[i], mappings[j] = mappings[j], mappings[i]
+	}
+	return mappings, err
+}
+
+func TestScaleMappingsOrder(t *testing.T) {
+	// v2 is the preferred version.
+	versions := []schema.GroupVersion{
+		{Group: "example.com", Version: "v2"},
+		{Group: "example.com", Version: "v1"},
+		{Group: "example.com", Version: "v1beta1"},
+	}
+	defaultMapper := apimeta.NewDefaultRESTMapper(versions)
+	for _, version := range versions {
+		defaultMapper.Add(version.WithKind("Widget"), apimeta.RESTScopeNamespace)
+	}
+
+	for _, mapper := range []apimeta.RESTMapper{defaultMapper, &reversingRESTMapper{defaultMapper}} {
+		f := simpleControllerFetcher()
+		f.mapper = mapper
+		mapping, err := f.getScaleMapping("example.com/v1", "Widget")
+		if assert.NoError(t, err) {
+			var tried []string
+			for _, m := range mapping.mappings {
+				tried = append(tried, m.GroupVersionKind.Version)
+			}
+			assert.Equal(t, []string{"v2", "v1", "v1beta1"}, tried)
+		}
+	}
+}
+
+func TestFindTopLevelForVolcanoJobPod(t *testing.T) {
+	volcanoJob := schema.GroupKind{Group: "batch.volcano.sh", Kind: "Job"}
+	podGroup := schema.GroupKind{Group: "scheduling.volcano.sh", Kind: "PodGroup"}
+	// Volcano Jobs own both their Pods and their PodGroup.
+	jobOwner := metav1.OwnerReference{
+		APIVersion: "batch.volcano.sh/v1alpha1",
+		Kind:       "Job",
+		Name:       "test-job",
+		Controller: &trueVar,
+	}
+	jobInformer := newCustomInformer()
+	jobInformer.GetStore().Add(newUnstructured("batch.volcano.sh/v1alpha1", "Job", "test-namespace", "test-job"))
+	podGroupInformer := newCustomInformer()
+	podGroupInformer.GetStore().Add(newUnstructured("scheduling.volcano.sh/v1beta1", "PodGroup", "test-namespace", "test-job", jobOwner))
+
+	f := simpleControllerFetcher()
+	f.customInformers = map[schema.GroupKind]cache.SharedIndexInformer{
+		volcanoJob: jobInformer,
+		podGroup:   podGroupInformer,
+	}
+	f.terminalKinds = map[schema.GroupKind]bool{volcanoJob: true}
+
+	expectedKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-job", Kind: "Job", Namespace: "test-namespace"}, ApiVersion: "batch.volcano.sh/v1alpha1"}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-job-worker-0",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{jobOwner},
+		},
+	}
+	topLevelController, err := f.FindTopLevelForPod(context.Background(), pod)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedKey, topLevelController)
+
+	topLevelController, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-job", Kind: "PodGroup", Namespace: "test-namespace"}, ApiVersion: "scheduling.volcano.sh/v1beta1"})
+	assert.NoError(t, err)
+	assert.Equal(t, expectedKey, topLevelController)
+
+	pod.OwnerReferences[0].Name = "missing-job"
+	_, err = f.FindTopLevelForPod(context.Background(), pod)
+	assert.EqualError(t, err, "Job test-namespace/missing-job does not exist")
+	assert.True(t, errors.Is(err, ErrControllerNotFound))
+}
+
+func TestFindTopLevelResourceVersion(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "widgets"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-widget", Namespace: "test-namespace", ResourceVersion: "42"},
+	})
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-rs",
+			Namespace:       "test-namespace",
+			ResourceVersion: "7",
+			OwnerReferences: []metav1.OwnerReference{
+				{Controller: &trueVar, Kind: "Deployment", Name: "test-deployment"},
+			},
+		},
+	})
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace", ResourceVersion: "13"},
+	})
+
+	topLevel, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "13", topLevel.ResourceVersion)
+
+	widgetKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	topLevel, err = f.FindTopLevel(widgetKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", topLevel.ResourceVersion)
+
+	f.resolutionCache = newResolutionCache(time.Minute)
+	_, err = f.FindTopLevel(widgetKey)
+	assert.NoError(t, err)
+	topLevel, err = f.FindTopLevel(widgetKey)
+	assert.NoError(t, err)
+	assert.Equal(t, *widgetKey, *topLevel)
+	assert.Empty(t, topLevel.ResourceVersion)
+}
+
+func TestFindTopLevelNonWorkloadTarget(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.nonWorkloadKinds = map[schema.GroupKind]bool{{Group: "example.com", Kind: "Gateway"}: true}
+	for _, key := range []*ControllerKeyWithAPIVersion{
+		{ControllerKey: ControllerKey{Name: "test-service", Kind: "Service", Namespace: "test-namespace"}, ApiVersion: "v1"},
+		{ControllerKey: ControllerKey{Name: "test-slice", Kind: "EndpointSlice", Namespace: "test-namespace"}, ApiVersion: "discovery.k8s.io/v1beta1"},
+		{ControllerKey: ControllerKey{Name: "test-gateway", Kind: "Gateway", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"},
+	} {
+		_, err := f.FindTopLevel(key)
+		assert.True(t, errors.Is(err, ErrNonWorkloadTarget), "unexpected error for %s: %v", key.Kind, err)
+	}
+}
+
+func TestNewControllerFetcherWithClients(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{Controller: &trueVar, Kind: "Deployment", Name: "test-deployment"},
+			},
+		},
+	}, &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	factory := informers.NewSharedInformerFactory(kubeClient, 0)
+	f := NewControllerFetcherWithClients(kubeClient.Discovery(), kubeClient, factory, Options{})
+	defer f.Stop()
+
+	topLevel, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}, topLevel)
+}
+
+func TestFindTopLevelThroughScalableCustomResources(t *testing.T) {
+	customDeploymentKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "CustomDeployment"}
+	customAppKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "CustomApp"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{customDeploymentKind.GroupVersion()})
+	mapper.Add(customDeploymentKind, apimeta.RESTScopeNamespace)
+	mapper.Add(customAppKind, apimeta.RESTScopeNamespace)
+	customDeployments := schema.GroupResource{Group: "example.com", Resource: "customdeployments"}
+	customApps := schema.GroupResource{Group: "example.com", Resource: "customapps"}
+
+	// Neither scale subresource carries owner references.
+	scales := newFakeScalesGetter()
+	scales.add(customDeployments, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cd", Namespace: "test-namespace"},
+	})
+	scales.add(customApps, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-app", Namespace: "test-namespace"},
+	})
+	dynamicClient := newFakeDynamicClient()
+	dynamicClient.add(customDeployments, newUnstructured("example.com/v1", "CustomDeployment", "test-namespace", "test-cd",
+		metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "CustomApp", Name: "test-app", Controller: &trueVar}))
+	dynamicClient.add(customApps, newUnstructured("example.com/v1", "CustomApp", "test-namespace", "test-app"))
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "example.com/v1", Kind: "CustomDeployment", Name: "test-cd", Controller: &trueVar},
+			},
+		},
+	})
+	rsKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}}
+
+	// Without the dynamic client resolution stops at the first custom resource.
+	topLevel, err := f.FindTopLevel(rsKey)
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-cd", Kind: "CustomDeployment", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}, topLevel)
+
+	f.dynamicClient = dynamicClient
+	topLevel, err = f.FindTopLevel(rsKey)
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-app", Kind: "CustomApp", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}, topLevel)
+}
+
+func TestFindTopLevelResolutionTimeout(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	widgets := schema.GroupResource{Group: "example.com", Resource: "widgets"}
+	scales := newFakeScalesGetter()
+	scales.delay = 50 * time.Millisecond
+	scales.add(widgets, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "child", Namespace: "test-namespace", OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "example.com/v1", Kind: "Widget", Name: "parent", Controller: &trueVar},
+		}},
+	})
+	scales.add(widgets, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "test-namespace"},
+	})
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	childKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "child", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	parentKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "parent", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+
+	topLevel, err := f.FindTopLevel(childKey)
+	assert.NoError(t, err)
+	assert.Equal(t, parentKey, topLevel)
+
+	f.resolutionTimeout = 10 * time.Millisecond
+	_, err = f.FindTopLevel(childKey)
+	assert.True(t, errors.Is(err, ErrResolutionTimeout), "unexpected error: %v", err)
+	var timeoutErr *ResolutionTimeoutError
+	if assert.True(t, errors.As(err, &timeoutErr)) {
+		assert.Equal(t, []ControllerKeyWithAPIVersion{*childKey}, timeoutErr.Chain)
+	}
+
+	// The deadline of the context applies as well.
+	f.resolutionTimeout = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = f.FindTopLevelWithContext(ctx, childKey)
+	assert.True(t, errors.Is(err, ErrResolutionTimeout), "unexpected error: %v", err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = f.FindTopLevelWithContext(ctx, childKey)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestControllerFetcherInformerSelector(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			Labels:    map[string]string{"vpa": "enabled"},
+			OwnerReferences: []metav1.OwnerReference{
+				{Controller: &trueVar, Kind: "Deployment", Name: "test-deployment"},
+			},
+		},
+	}, &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	factory := informers.NewSharedInformerFactory(kubeClient, 0)
+	f := NewControllerFetcherWithClients(kubeClient.Discovery(), kubeClient, factory, Options{
+		InformerLabelSelector: labels.SelectorFromSet(labels.Set{"vpa": "enabled"}),
+	})
+	defer f.Stop()
+
+	informersMap := f.(*controllerFetcher).informersMap
+	assert.Len(t, informersMap[replicaSet].GetStore().List(), 1)
+	assert.Empty(t, informersMap[deployment].GetStore().List())
+
+	// The Deployment doesn't match the selector, so it's read from the API server.
+	topLevel, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}, topLevel)
+
+	_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.EqualError(t, err, "ReplicaSet test-namespace/missing-rs does not exist")
+	assert.True(t, errors.Is(err, ErrControllerNotFound))
+}
+
+func TestFindTopLevelForDeploymentConfigPod(t *testing.T) {
+	deploymentConfigKind := schema.GroupVersionKind{Group: "apps.openshift.io", Version: "v1", Kind: "DeploymentConfig"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{deploymentConfigKind.GroupVersion()})
+	mapper.Add(deploymentConfigKind, apimeta.RESTScopeNamespace)
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "apps.openshift.io", Resource: "deploymentconfigs"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-dc", Namespace: "test-namespace"},
+	})
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	addController(f, &corev1.ReplicationController{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicationController"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-dc-1",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps.openshift.io/v1", Kind: "DeploymentConfig", Name: "test-dc", Controller: &trueVar},
+			},
+		},
+	})
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-dc-1-abcde",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "v1", Kind: "ReplicationController", Name: "test-dc-1", Controller: &trueVar},
+			},
+		},
+	}
+	expectedKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-dc", Kind: "DeploymentConfig", Namespace: "test-namespace"}, ApiVersion: "apps.openshift.io/v1"}
+
+	topLevel, err := f.FindTopLevelForPod(context.Background(), pod)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedKey, topLevel)
+
+	// The ReplicationController is read from its informer, the DeploymentConfig through its scale subresource.
+	res, err := f.findTopLevel(context.Background(), getOwnerController(pod.OwnerReferences, pod.Namespace))
+	assert.NoError(t, err)
+	assert.Equal(t, []ResolutionPath{InformerPath, ScalePath}, res.paths)
+
+	_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-dc", Kind: "DeploymentConfig", Namespace: "test-namespace"}, ApiVersion: "apps.openshift.io/v1"})
+	assert.Error(t, err)
+}
+
+func TestResetStaleMapper(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	defaultMapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	defaultMapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	mapper := &countingRESTMapper{RESTMapper: defaultMapper}
+	widgets := schema.GroupResource{Group: "example.com", Resource: "widgets"}
+	scales := newFakeScalesGetter()
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+
+	// A missing object doesn't reset the mapper.
+	_, err := f.FindTopLevel(key)
+	assert.Error(t, err)
+	assert.Equal(t, 0, mapper.resets)
+
+	// Once the CRD is deleted, the mapper is reset, but not more often than minMapperResetInterval.
+	scales.missingResources = map[schema.GroupResource]bool{widgets: true}
+	for i := 0; i < 3; i++ {
+		_, err = f.FindTopLevel(key)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 1, mapper.resets)
+	assert.Equal(t, 2, mapper.restMappingsCalls)
+
+	f.resetStaleMapper(time.Now().Add(minMapperResetInterval))
+	assert.Equal(t, 2, mapper.resets)
+
+	// Concurrent resets of a stale mapper reset it once.
+	now := time.Now().Add(2 * minMapperResetInterval)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.resetStaleMapper(now)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, mapper.resets)
+}
+
+func TestScalePathKinds(t *testing.T) {
+	customDeploymentKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Deployment"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{customDeploymentKind.GroupVersion(), appsv1.SchemeGroupVersion})
+	mapper.Add(customDeploymentKind, apimeta.RESTScopeNamespace)
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), apimeta.RESTScopeNamespace)
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "deployments"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace", ResourceVersion: "2"},
+	})
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace", ResourceVersion: "1"},
+	})
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+
+	// The Deployment informer isn't used for Deployments of other groups.
+	topLevel, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", topLevel.ResourceVersion)
+
+	// Listing a well-known kind bypasses its informer.
+	appsKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	topLevel, err = f.FindTopLevel(appsKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", topLevel.ResourceVersion)
+	scales.add(schema.GroupResource{Group: "apps", Resource: "deployments"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace", ResourceVersion: "3"},
+	})
+	f.scalePathKinds = map[schema.GroupKind]bool{{Group: "apps", Kind: "Deployment"}: true}
+	topLevel, err = f.FindTopLevel(appsKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "3", topLevel.ResourceVersion)
+}
+
+func TestFindTopLevelUnreadableOwnerObject(t *testing.T) {
+	f := simpleControllerFetcher()
+	// An informer holding objects of the wrong type.
+	f.informersMap[deployment].GetStore().Add(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	_, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}})
+	assert.True(t, errors.Is(err, ErrUnreadableOwnerObject), "unexpected error: %v", err)
+	assert.Contains(t, err.Error(), "Deployment test-namespace/test-deployment")
+	assert.Contains(t, err.Error(), "*v1.Pod")
+}
+
+func TestDisableScaleResolution(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.scaleNamespacer = newFakeScalesGetter()
+	f.disableScaleResolution = true
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "example.com/v1", Kind: "Widget", Name: "test-widget", Controller: &trueVar},
+			},
+		},
+	})
+	// The mapper isn't used at all.
+	f.mapper = nil
+
+	res, err := f.findTopLevel(context.Background(), &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}, res.topLevel)
+	assert.Equal(t, []ResolutionPath{InformerPath, TerminalPath}, res.paths)
+}
+
+func TestFindTopLevelIgnoresNonWorkloadOwners(t *testing.T) {
+	f := simpleControllerFetcher()
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", Controller: &trueVar},
+			},
+		},
+	})
+	addController(f, &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-deployment",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "helm.toolkit.fluxcd.io/v2beta1", Kind: "HelmRelease", Name: "test-release", Controller: &trueVar},
+			},
+		},
+	})
+	addController(f, &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{Kind: "StatefulSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-sts",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "example.com/v1", Kind: "Bundle", Name: "test-bundle", Controller: &trueVar},
+			},
+		},
+	})
+	deploymentKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+
+	topLevel, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.NoError(t, err)
+	assert.Equal(t, deploymentKey, topLevel)
+
+	topLevels, err := f.FindAllTopLevels(context.Background(), deploymentKey)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ControllerKeyWithAPIVersion{deploymentKey}, topLevels)
+
+	// Owners can be added to the list.
+	f.nonWorkloadOwnerKinds = map[schema.GroupKind]bool{{Group: "example.com", Kind: "Bundle"}: true}
+	stsKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-sts", Kind: "StatefulSet", Namespace: "test-namespace"}}
+	topLevel, err = f.FindTopLevel(stsKey)
+	assert.NoError(t, err)
+	assert.Equal(t, stsKey, topLevel)
+}
+
+func TestStopTerminatesInformers(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	newFetcher := func() {
+		factory := informers.NewSharedInformerFactory(kubeClient, 0)
+		f := NewControllerFetcherWithClients(kubeClient.Discovery(), kubeClient, factory, Options{})
+		f.Stop()
+	}
+	// Let goroutines started once per process start before counting.
+	newFetcher()
+	baseline := goruntime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		newFetcher()
+	}
+	err := wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		return goruntime.NumGoroutine() <= baseline, nil
+	})
+	assert.NoError(t, err, "goroutines leaked: %d, expected at most %d", goruntime.NumGoroutine(), baseline)
+}
+
+func TestFindTopLevelForWorkflowJob(t *testing.T) {
+	workflowKind := schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Workflow"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{workflowKind.GroupVersion()})
+	mapper.Add(workflowKind, apimeta.RESTScopeNamespace)
+	workflowOwner := metav1.OwnerReference{APIVersion: "argoproj.io/v1alpha1", Kind: "Workflow", Name: "test-workflow", Controller: &trueVar}
+	expectedKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-workflow", Kind: "Workflow", Namespace: "test-namespace"}, ApiVersion: "argoproj.io/v1alpha1"}
+	jobKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-job", Kind: "Job", Namespace: "test-namespace"}, ApiVersion: "batch/v1"}
+
+	newFetcher := func() *controllerFetcher {
+		f := simpleControllerFetcher()
+		f.mapper = mapper
+		f.scaleNamespacer = newFakeScalesGetter()
+		addController(f, &batchv1.Job{
+			TypeMeta: metav1.TypeMeta{Kind: "Job"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "test-job",
+				Namespace:       "test-namespace",
+				OwnerReferences: []metav1.OwnerReference{workflowOwner},
+			},
+		})
+		return f
+	}
+
+	// Through an informer of Workflows, e.g. a dynamic informer.
+	f := newFetcher()
+	workflowInformer := newCustomInformer()
+	workflowInformer.GetStore().Add(newUnstructured("argoproj.io/v1alpha1", "Workflow", "test-namespace", "test-workflow"))
+	f.customInformers = map[schema.GroupKind]cache.SharedIndexInformer{workflowKind.GroupKind(): workflowInformer}
+	topLevel, err := f.FindTopLevel(jobKey)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedKey, topLevel)
+
+	// Through the scale subresource.
+	f = newFetcher()
+	f.scaleNamespacer.(*fakeScalesGetter).add(schema.GroupResource{Group: "argoproj.io", Resource: "workflows"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-workflow", Namespace: "test-namespace"},
+	})
+	topLevel, err = f.FindTopLevel(jobKey)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedKey, topLevel)
+}
+
+func TestFindTopLevelCrossNamespaceOwner(t *testing.T) {
+	f := simpleControllerFetcher()
+	for kind, informer := range f.informersMap {
+		assert.NoError(t, addUIDIndexers(string(kind), informer))
+	}
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", UID: "deployment-uid", Controller: &trueVar},
+			},
+		},
+	})
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "other-namespace", UID: "deployment-uid"},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "orphaned-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "deleted-deployment", UID: "deleted-uid", Controller: &trueVar},
+			},
+		},
+	})
+
+	_, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.True(t, errors.Is(err, ErrCrossNamespaceOwner), "unexpected error: %v", err)
+
+	// Owners which don't exist anywhere aren't reported as cross-namespace.
+	_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "orphaned-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrCrossNamespaceOwner), "unexpected error: %v", err)
+}
+
+func TestFindTopLevelScaleResolutionError(t *testing.T) {
+	widgetsV1 := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	widgetsV2 := schema.GroupVersionKind{Group: "example.com", Version: "v2", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetsV2.GroupVersion(), widgetsV1.GroupVersion()})
+	mapper.Add(widgetsV1, apimeta.RESTScopeNamespace)
+	mapper.Add(widgetsV2, apimeta.RESTScopeNamespace)
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = newFakeScalesGetter()
+
+	_, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"})
+	var scaleErr *ScaleResolutionError
+	if !assert.True(t, errors.As(err, &scaleErr), "unexpected error: %v", err) {
+		return
+	}
+	assert.Equal(t, schema.GroupKind{Group: "example.com", Kind: "Widget"}, scaleErr.GroupKind)
+	widgets := schema.GroupResource{Group: "example.com", Resource: "widgets"}
+	if assert.Len(t, scaleErr.Attempts, 2) {
+		for _, attempt := range scaleErr.Attempts {
+			assert.Equal(t, widgets, attempt.GroupResource)
+			assert.True(t, k8serrors.IsNotFound(attempt.Err), "unexpected error: %v", attempt.Err)
+		}
+	}
+	assert.True(t, errors.Is(err, ErrControllerNotFound), "unexpected error: %v", err)
+
+	// Attempts without a namespace are recorded too.
+	_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget"}, ApiVersion: "example.com/v1"})
+	assert.True(t, errors.As(err, &scaleErr), "unexpected error: %v", err)
+	assert.True(t, errors.Is(err, ErrMissingNamespace), "unexpected error: %v", err)
+}
+
+type identityCanonicalizer struct{}
+
+func (identityCanonicalizer) Canonicalize(_ apimeta.RESTMapper, kind schema.GroupVersionKind) schema.GroupVersionKind {
+	return kind
+}
+
+func TestFindTopLevelCoreGroupScale(t *testing.T) {
+	gizmoKind := schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Gizmo"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{gizmoKind.GroupVersion()})
+	mapper.Add(gizmoKind, apimeta.RESTScopeNamespace)
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "", Resource: "gizmos"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-gizmo", Namespace: "test-namespace"},
+	})
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.keyCanonicalizer = identityCanonicalizer{}
+
+	for _, apiVersion := range []string{"v1", "core/v1"} {
+		t.Run(apiVersion, func(t *testing.T) {
+			key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-gizmo", Kind: "Gizmo", Namespace: "test-namespace"}, ApiVersion: apiVersion}
+			res, err := f.findTopLevel(context.Background(), key)
+			assert.NoError(t, err)
+			assert.Equal(t, key, res.topLevel)
+			assert.Equal(t, []ResolutionPath{ScalePath}, res.paths)
+
+			_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "missing-gizmo", Kind: "Gizmo", Namespace: "test-namespace"}, ApiVersion: apiVersion})
+			var scaleErr *ScaleResolutionError
+			if assert.True(t, errors.As(err, &scaleErr), "unexpected error: %v", err) {
+				assert.Equal(t, schema.GroupKind{Kind: "Gizmo"}, scaleErr.GroupKind)
 			}
+			assert.True(t, errors.Is(err, ErrControllerNotFound), "unexpected error: %v", err)
 		})
 	}
 }
+
+func TestFindTopLevelSelfOwnership(t *testing.T) {
+	f := simpleControllerFetcher()
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "test-rs", Controller: &trueVar},
+			},
+		},
+	})
+	// A controller owned by a controller of another kind with the same name doesn't own itself.
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-app",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-app", Controller: &trueVar},
+			},
+		},
+	})
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-app", Namespace: "test-namespace"},
+	})
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+
+	res, err := f.findTopLevel(context.Background(), key)
+	assert.True(t, errors.Is(err, ErrSelfOwnership), "unexpected error: %v", err)
+	assert.True(t, errors.Is(err, ErrOwnershipCycle), "unexpected error: %v", err)
+	assert.Equal(t, []ResolutionPath{InformerPath}, res.paths)
+
+	_, err = f.FindAllTopLevels(context.Background(), key)
+	assert.True(t, errors.Is(err, ErrSelfOwnership), "unexpected error: %v", err)
+
+	topLevel, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-app", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Deployment", topLevel.Kind)
+}
+
+// customKeyInformer is an informer storing objects under keys of a custom key function.
+type customKeyInformer struct {
+	cache.SharedIndexInformer
+	indexer cache.Indexer
+}
+
+func newCustomKeyInformer(keyFunc cache.KeyFunc, indexers cache.Indexers) *customKeyInformer {
+	return &customKeyInformer{SharedIndexInformer: newCustomInformer(), indexer: cache.NewIndexer(keyFunc, indexers)}
+}
+
+func (i *customKeyInformer) GetStore() cache.Store {
+	return i.indexer
+}
+
+func (i *customKeyInformer) GetIndexer() cache.Indexer {
+	return i.indexer
+}
+
+func TestFindTopLevelCustomKeyFunction(t *testing.T) {
+	dottedKey := func(obj interface{}) (string, error) {
+		accessor, err := apimeta.Accessor(obj)
+		if err != nil {
+			return "", err
+		}
+		return accessor.GetNamespace() + "." + accessor.GetName(), nil
+	}
+	appKind := schema.GroupKind{Group: "example.com", Kind: "App"}
+	partKind := schema.GroupKind{Group: "example.com", Kind: "AppPart"}
+	for name, indexers := range map[string]cache.Indexers{
+		"with namespace index":    {cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		"without namespace index": {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			apps := newCustomKeyInformer(dottedKey, indexers)
+			parts := newCustomKeyInformer(dottedKey, indexers)
+			assert.NoError(t, apps.GetStore().Add(newUnstructured("example.com/v1", "App", "test-namespace", "test-app")))
+			assert.NoError(t, parts.GetStore().Add(newUnstructured("example.com/v1", "AppPart", "test-namespace", "test-part",
+				metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "App", Name: "test-app", Controller: &trueVar})))
+			f := simpleControllerFetcher()
+			f.customInformers = map[schema.GroupKind]cache.SharedIndexInformer{appKind: apps, partKind: parts}
+
+			topLevel, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-part", Kind: "AppPart", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"})
+			assert.NoError(t, err)
+			assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-app", Kind: "App", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}, topLevel)
+
+			_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-part", Kind: "AppPart", Namespace: "other-namespace"}, ApiVersion: "example.com/v1"})
+			assert.True(t, errors.Is(err, ErrControllerNotFound), "unexpected error: %v", err)
+		})
+	}
+}
+
+// scanCountingIndexer counts the full and namespace scans of an indexer.
+type scanCountingIndexer struct {
+	cache.Indexer
+	scans int
+}
+
+func (i *scanCountingIndexer) List() []interface{} {
+	i.scans++
+	return i.Indexer.List()
+}
+
+func (i *scanCountingIndexer) ByIndex(indexName, indexedValue string) ([]interface{}, error) {
+	i.scans++
+	return i.Indexer.ByIndex(indexName, indexedValue)
+}
+
+func TestFindTopLevelDefaultKeyFunctionMiss(t *testing.T) {
+	appKind := schema.GroupKind{Group: "example.com", Kind: "App"}
+	indexer := &scanCountingIndexer{Indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})}
+	apps := &customKeyInformer{SharedIndexInformer: newCustomInformer(), indexer: indexer}
+	assert.NoError(t, apps.GetStore().Add(newUnstructured("example.com/v1", "App", "test-namespace", "test-app")))
+	f := simpleControllerFetcher()
+	f.customInformers = map[schema.GroupKind]cache.SharedIndexInformer{appKind: apps}
+
+	// Informers storing objects under default keys aren't scanned for missing ones.
+	for i := 0; i < 2; i++ {
+		_, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "missing-app", Kind: "App", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"})
+		assert.True(t, errors.Is(err, ErrControllerNotFound), "unexpected error: %v", err)
+	}
+	assert.Equal(t, 0, indexer.scans)
+}
+
+func TestGetOwnerControllerTiebreak(t *testing.T) {
+	wellKnown := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", UID: "b", Controller: &trueVar}
+	customA := metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "App", Name: "test-app-a", UID: "a", Controller: &trueVar}
+	customC := metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "App", Name: "test-app-c", UID: "c", Controller: &trueVar}
+	lookalike := metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "Deployment", Name: "test-lookalike", UID: "0", Controller: &trueVar}
+	owner := metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "App", Name: "test-owner", UID: "0"}
+
+	testCases := []struct {
+		name     string
+		owners   []metav1.OwnerReference
+		expected metav1.OwnerReference
+	}{
+		{name: "well-known controller", owners: []metav1.OwnerReference{customA, wellKnown}, expected: wellKnown},
+		{name: "well-known kind of another group", owners: []metav1.OwnerReference{lookalike, wellKnown}, expected: wellKnown},
+		{name: "lowest UID", owners: []metav1.OwnerReference{customC, customA}, expected: customA},
+		{name: "owners which aren't controllers", owners: []metav1.OwnerReference{owner, customC}, expected: customC},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Namespace: "test-namespace", Kind: tc.expected.Kind, Name: tc.expected.Name}, ApiVersion: tc.expected.APIVersion}
+			// The same controller is picked whatever the order of owners.
+			reversed := make([]metav1.OwnerReference, 0, len(tc.owners))
+			for i := len(tc.owners) - 1; i >= 0; i-- {
+				reversed = append(reversed, tc.owners[i])
+			}
+			assert.Equal(t, expected, getOwnerController(tc.owners, "test-namespace"))
+			assert.Equal(t, expected, getOwnerController(reversed, "test-namespace"))
+		})
+	}
+}
+
+func TestFindTopLevelCustomResourceWithWellKnownKind(t *testing.T) {
+	groupVersion := schema.GroupVersion{Group: "custom.io", Version: "v1"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{groupVersion})
+	mapper.Add(groupVersion.WithKind("Deployment"), apimeta.RESTScopeNamespace)
+	mapper.Add(groupVersion.WithKind("App"), apimeta.RESTScopeNamespace)
+	customDeployments := schema.GroupResource{Group: "custom.io", Resource: "deployments"}
+	scales := newFakeScalesGetter()
+	scales.add(customDeployments, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	dynamicClient := newFakeDynamicClient()
+	dynamicClient.add(customDeployments, newUnstructured("custom.io/v1", "Deployment", "test-namespace", "test-deployment",
+		metav1.OwnerReference{APIVersion: "custom.io/v1", Kind: "App", Name: "test-app", Controller: &trueVar}))
+	scales.add(schema.GroupResource{Group: "custom.io", Resource: "apps"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-app", Namespace: "test-namespace"},
+	})
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.dynamicClient = dynamicClient
+	// An apps Deployment of the same name, which the custom one must not be mistaken for.
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+
+	res, err := f.findTopLevel(context.Background(), &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "custom.io/v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-app", Kind: "App", Namespace: "test-namespace"}, ApiVersion: "custom.io/v1"}, res.topLevel)
+	assert.Equal(t, []ResolutionPath{ScalePath, ScalePath}, res.paths)
+
+	// Deployments of the apps group, or without a group, still come from the informer.
+	for _, apiVersion := range []string{"apps/v1", ""} {
+		res, err = f.findTopLevel(context.Background(), &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: apiVersion})
+		assert.NoError(t, err)
+		assert.Equal(t, []ResolutionPath{InformerPath}, res.paths)
+	}
+}
+
+func TestFindTopLevelLegacyGroup(t *testing.T) {
+	// The cluster doesn't serve the extensions group anymore.
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{appsv1.SchemeGroupVersion})
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), apimeta.RESTScopeNamespace)
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("DaemonSet"), apimeta.RESTScopeNamespace)
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("ReplicaSet"), apimeta.RESTScopeNamespace)
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = newFakeScalesGetter()
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	addController(f, &appsv1.DaemonSet{
+		TypeMeta:   metav1.TypeMeta{Kind: "DaemonSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-daemonset", Namespace: "test-namespace"},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-rs", Namespace: "test-namespace", OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "extensions/v1beta1", Kind: "Deployment", Name: "test-deployment", Controller: &trueVar}}},
+	})
+
+	// Well-known controllers of their legacy group are read from their informers.
+	for kind, name := range map[string]string{"Deployment": "test-deployment", "DaemonSet": "test-daemonset"} {
+		key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: name, Kind: kind, Namespace: "test-namespace"}, ApiVersion: "extensions/v1beta1"}
+		res, err := f.findTopLevel(context.Background(), key)
+		if assert.NoError(t, err, kind) {
+			assert.Equal(t, []ResolutionPath{InformerPath}, res.paths, kind)
+			assert.Equal(t, key.Name, res.topLevel.Name, kind)
+		}
+	}
+	rsKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "extensions/v1beta1"}
+	topLevel, err := f.FindTopLevel(rsKey)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Deployment", topLevel.Kind)
+		assert.Equal(t, "test-deployment", topLevel.Name)
+	}
+}
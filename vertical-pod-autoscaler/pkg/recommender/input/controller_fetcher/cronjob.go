@@ -0,0 +1,58 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// CronJobNameKey is the label, or failing that annotation, which tools creating Jobs on behalf of a CronJob
+	// without making it their owner (e.g. wrappers of `kubectl create job --from=cronjob/...`) set to the name of
+	// the CronJob. Options.InferCronJobFromLabels follows it.
+	CronJobNameKey = "batch.kubernetes.io/cronjob-name"
+	// cronJobAPIVersion is the version of CronJobs inferred from Job metadata. It's replaced with the one the
+	// server prefers unless Options.PreserveOwnerAPIVersion is set.
+	cronJobAPIVersion = "batch/v1beta1"
+)
+
+// cronJobFromMetadata returns the CronJob named by the labels or annotations of the given Job, if it has no
+// owners and Options.InferCronJobFromLabels is set.
+func (f *controllerFetcher) cronJobFromMetadata(key ControllerKeyWithAPIVersion, controller *controllerObject) *ControllerKeyWithAPIVersion {
+	if !f.inferCronJobFromLabels || key.Kind != string(job) || len(controller.owners) > 0 || controller.object == nil {
+		return nil
+	}
+	if groupVersion, err := schema.ParseGroupVersion(key.ApiVersion); err != nil || (groupVersion.Group != "" && groupVersion.Group != "batch") {
+		return nil
+	}
+	accessor, err := apimeta.Accessor(controller.object)
+	if err != nil {
+		return nil
+	}
+	name := accessor.GetLabels()[CronJobNameKey]
+	if name == "" {
+		name = accessor.GetAnnotations()[CronJobNameKey]
+	}
+	if name == "" {
+		return nil
+	}
+	return &ControllerKeyWithAPIVersion{
+		ControllerKey: ControllerKey{Namespace: key.Namespace, Kind: "CronJob", Name: name},
+		ApiVersion:    cronJobAPIVersion,
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestInferCronJobFromLabels(t *testing.T) {
+	jobKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-job", Kind: "Job", Namespace: "test-namespace"}, ApiVersion: "batch/v1"}
+	cronJobKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-cronjob", Kind: "CronJob", Namespace: "test-namespace"}, ApiVersion: cronJobAPIVersion}
+
+	testCases := []struct {
+		name             string
+		labels           map[string]string
+		annotations      map[string]string
+		owners           []metav1.OwnerReference
+		enabled          bool
+		expectedTopLevel *ControllerKeyWithAPIVersion
+		expectedInferred bool
+	}{
+		{
+			name:             "label followed",
+			labels:           map[string]string{CronJobNameKey: "test-cronjob"},
+			enabled:          true,
+			expectedTopLevel: cronJobKey,
+			expectedInferred: true,
+		},
+		{
+			name:             "annotation followed",
+			annotations:      map[string]string{CronJobNameKey: "test-cronjob"},
+			enabled:          true,
+			expectedTopLevel: cronJobKey,
+			expectedInferred: true,
+		},
+		{
+			name:             "label preferred",
+			labels:           map[string]string{CronJobNameKey: "test-cronjob"},
+			annotations:      map[string]string{CronJobNameKey: "other-cronjob"},
+			enabled:          true,
+			expectedTopLevel: cronJobKey,
+			expectedInferred: true,
+		},
+		{
+			name:             "disabled",
+			labels:           map[string]string{CronJobNameKey: "test-cronjob"},
+			expectedTopLevel: jobKey,
+		},
+		{
+			name:             "no metadata",
+			enabled:          true,
+			expectedTopLevel: jobKey,
+		},
+		{
+			name:   "owner preferred",
+			labels: map[string]string{CronJobNameKey: "other-cronjob"},
+			owners: []metav1.OwnerReference{
+				{APIVersion: cronJobAPIVersion, Kind: "CronJob", Name: "test-cronjob", Controller: &trueVar},
+			},
+			enabled:          true,
+			expectedTopLevel: cronJobKey,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := simpleControllerFetcher()
+			f.terminalKinds = map[schema.GroupKind]bool{{Group: "batch", Kind: "CronJob"}: true}
+			f.inferCronJobFromLabels = tc.enabled
+			addController(f, &batchv1.Job{
+				TypeMeta: metav1.TypeMeta{Kind: "Job"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "test-job",
+					Namespace:       "test-namespace",
+					Labels:          tc.labels,
+					Annotations:     tc.annotations,
+					OwnerReferences: tc.owners,
+				},
+			})
+			result, err := f.FindTopLevelDetailed(context.Background(), jobKey)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedTopLevel, result.TopLevel)
+			assert.Equal(t, tc.expectedInferred, result.InferredOwner)
+		})
+	}
+}
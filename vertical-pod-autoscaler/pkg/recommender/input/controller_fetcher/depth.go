@@ -0,0 +1,88 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	metrics_recommender "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/recommender"
+)
+
+// recentResolutionsSize is the number of resolutions RecentResolutions returns.
+const recentResolutionsSize = 100
+
+// ResolutionDepth describes the ownership depth of a resolved controller.
+type ResolutionDepth struct {
+	// Controller is the controller which was resolved.
+	Controller ControllerKeyWithAPIVersion
+	// TopLevel is its top level controller.
+	TopLevel ControllerKeyWithAPIVersion
+	// HopCount is the number of owners followed from Controller to TopLevel.
+	HopCount int
+	// Time is when the resolution finished.
+	Time time.Time
+}
+
+// recentResolutions is a ring buffer of the last resolutions. Its zero value is ready to use.
+type recentResolutions struct {
+	mutex       sync.Mutex
+	resolutions [recentResolutionsSize]ResolutionDepth
+	next        int
+	full        bool
+}
+
+func (r *recentResolutions) add(resolution ResolutionDepth) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.resolutions[r.next] = resolution
+	r.next = (r.next + 1) % recentResolutionsSize
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the resolutions, oldest first.
+func (r *recentResolutions) list() []ResolutionDepth {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.full {
+		return append([]ResolutionDepth(nil), r.resolutions[:r.next]...)
+	}
+	return append(append(make([]ResolutionDepth, 0, recentResolutionsSize), r.resolutions[r.next:]...), r.resolutions[:r.next]...)
+}
+
+// recordDepth records the ownership depth of a resolution in the recent resolutions and, unless the fetcher
+// records no metrics, in the depth histogram of the GroupKind of the top level controller.
+func (f *controllerFetcher) recordDepth(controller ControllerKeyWithAPIVersion, result *FindTopLevelResult) {
+	groupVersion, err := schema.ParseGroupVersion(result.TopLevel.ApiVersion)
+	if err == nil && f.recordMetrics {
+		groupKind := schema.GroupKind{Group: groupVersion.Group, Kind: result.TopLevel.Kind}
+		metrics_recommender.RecordControllerFetcherOwnershipDepth(groupKind.String(), result.HopCount)
+	}
+	f.recentResolutions.add(ResolutionDepth{
+		Controller: controller,
+		TopLevel:   *result.TopLevel,
+		HopCount:   result.HopCount,
+		Time:       time.Now(),
+	})
+}
+
+func (f *controllerFetcher) RecentResolutions() []ResolutionDepth {
+	return f.recentResolutions.list()
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecentResolutions(t *testing.T) {
+	var r recentResolutions
+	assert.Empty(t, r.list())
+	for i := 0; i < recentResolutionsSize+5; i++ {
+		r.add(ResolutionDepth{HopCount: i})
+	}
+	resolutions := r.list()
+	if assert.Len(t, resolutions, recentResolutionsSize) {
+		assert.Equal(t, 5, resolutions[0].HopCount)
+		assert.Equal(t, recentResolutionsSize+4, resolutions[recentResolutionsSize-1].HopCount)
+	}
+}
+
+func TestFindTopLevelRecordsDepth(t *testing.T) {
+	f := simpleControllerFetcher()
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	for i := 0; i < 2; i++ {
+		addController(f, &appsv1.ReplicaSet{
+			TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("test-rs-%d", i),
+				Namespace: "test-namespace",
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", Controller: &trueVar},
+				},
+			},
+		})
+	}
+	deploymentKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+
+	for _, name := range []string{"test-rs-0", "test-rs-1"} {
+		_, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: name, Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"})
+		assert.NoError(t, err)
+	}
+	_, err := f.FindTopLevel(&deploymentKey)
+	assert.NoError(t, err)
+
+	resolutions := f.RecentResolutions()
+	if assert.Len(t, resolutions, 3) {
+		assert.Equal(t, "test-rs-0", resolutions[0].Controller.Name)
+		assert.Equal(t, deploymentKey, resolutions[0].TopLevel)
+		assert.Equal(t, 1, resolutions[0].HopCount)
+		assert.Equal(t, "test-rs-1", resolutions[1].Controller.Name)
+		assert.Equal(t, deploymentKey, resolutions[2].Controller)
+		assert.Equal(t, 0, resolutions[2].HopCount)
+		assert.False(t, resolutions[2].Time.IsZero())
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+)
+
+// Diagnosis describes the resolution of a single controller.
+type Diagnosis struct {
+	// Controller is the diagnosed controller.
+	Controller ControllerKeyWithAPIVersion
+	// Resolved is true if the top level controller was found.
+	Resolved bool
+	// TopLevel is the top level controller, nil unless Resolved.
+	TopLevel *ControllerKeyWithAPIVersion
+	// TerminalKind is the kind of the controller resolution ended at: the top level controller, or the
+	// controller which couldn't be read.
+	TerminalKind string
+	// Err is the error resolution failed with. Sentinel errors of this package can be checked with errors.Is.
+	Err error
+}
+
+func (f *controllerFetcher) DiagnoseKeys(ctx context.Context, keys []ControllerKeyWithAPIVersion) []Diagnosis {
+	diagnoses := make([]Diagnosis, 0, len(keys))
+	for _, key := range keys {
+		start := key
+		start.ResourceVersion = ""
+		res, err := f.findTopLevel(withFreshReads(ctx), &start)
+		diagnoses = append(diagnoses, Diagnosis{
+			Controller:   key,
+			Resolved:     err == nil,
+			TopLevel:     res.topLevel,
+			TerminalKind: res.last.Kind,
+			Err:          err,
+		})
+	}
+	return diagnoses
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDiagnoseKeys(t *testing.T) {
+	f := simpleControllerFetcher()
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{Controller: &trueVar, Kind: "Deployment", Name: "test-deployment"},
+			},
+		},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "orphaned-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{Controller: &trueVar, Kind: "Deployment", Name: "missing-deployment"},
+			},
+		},
+	})
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	rsKey := func(name string) ControllerKeyWithAPIVersion {
+		return ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{Name: name, Kind: "ReplicaSet", Namespace: "test-namespace"}}
+	}
+	serviceKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-service", Kind: "Service", Namespace: "test-namespace"}, ApiVersion: "v1"}
+
+	diagnoses := f.DiagnoseKeys(context.Background(), []ControllerKeyWithAPIVersion{rsKey("test-rs"), rsKey("orphaned-rs"), serviceKey})
+	if !assert.Len(t, diagnoses, 3) {
+		return
+	}
+
+	assert.Equal(t, rsKey("test-rs"), diagnoses[0].Controller)
+	assert.True(t, diagnoses[0].Resolved)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}, diagnoses[0].TopLevel)
+	assert.Equal(t, "Deployment", diagnoses[0].TerminalKind)
+	assert.NoError(t, diagnoses[0].Err)
+
+	assert.False(t, diagnoses[1].Resolved)
+	assert.Nil(t, diagnoses[1].TopLevel)
+	assert.Equal(t, "Deployment", diagnoses[1].TerminalKind)
+	assert.Error(t, diagnoses[1].Err)
+
+	assert.False(t, diagnoses[2].Resolved)
+	assert.Equal(t, "Service", diagnoses[2].TerminalKind)
+	assert.True(t, errors.Is(diagnoses[2].Err, ErrNonWorkloadTarget))
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"sync/atomic"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	cacheddiscovery "k8s.io/client-go/discovery/cached"
+	"k8s.io/client-go/restmapper"
+)
+
+// DiscoveryMode decides when the RESTMapper of the fetcher reads discovery information from the API server.
+type DiscoveryMode string
+
+const (
+	// DiscoveryCached keeps discovery information in memory until it's refreshed, every
+	// Options.DiscoveryRefreshInterval and when reads show it's stale, so kinds installed in between aren't
+	// known until then. This is the default.
+	DiscoveryCached DiscoveryMode = "Cached"
+	// DiscoveryUncached re-reads discovery information whenever a kind or resource isn't found in it, so that
+	// controllers of CRDs are resolvable as soon as the CRDs are installed. Lookups of known kinds are still
+	// served from memory, but each lookup of a kind the API server doesn't serve reads the discovery
+	// information of all API groups and versions, one request each, and resolving a controller of such a kind
+	// takes several lookups. Kinds which aren't served, e.g. owner references left behind by uninstalled
+	// operators, then load the API server on every resolution, which caching of resolutions and failures
+	// (Options.ResolutionCacheTTL and Options.NegativeResolutionCacheTTL) mitigates.
+	DiscoveryUncached DiscoveryMode = "Uncached"
+)
+
+// uncachedDiscoveryClient is a CachedDiscoveryInterface which is only fresh if discovery information was read
+// during the current lookup of uncachedRESTMapper. This makes the deferred RESTMapper using it reset itself,
+// re-reading discovery information, on a lookup missing information read earlier, but not again after that
+// re-read.
+type uncachedDiscoveryClient struct {
+	discovery.DiscoveryInterface
+	// read is set (to 1) when discovery information is read and cleared when a lookup starts. Concurrent lookups
+	// share it, so one may skip its re-read if another just re-read discovery information.
+	read int32
+}
+
+// ServerGroups implements discovery.DiscoveryInterface. The RESTMapper starts reading discovery information
+// with it.
+func (c *uncachedDiscoveryClient) ServerGroups() (*metav1.APIGroupList, error) {
+	atomic.StoreInt32(&c.read, 1)
+	return c.DiscoveryInterface.ServerGroups()
+}
+
+// Fresh implements discovery.CachedDiscoveryInterface.
+func (c *uncachedDiscoveryClient) Fresh() bool {
+	return atomic.LoadInt32(&c.read) == 1
+}
+
+// Invalidate implements discovery.CachedDiscoveryInterface. There's nothing to invalidate.
+func (c *uncachedDiscoveryClient) Invalidate() {}
+
+// uncachedRESTMapper is the deferred RESTMapper of an uncachedDiscoveryClient, which starts each lookup with
+// discovery information that isn't fresh.
+type uncachedRESTMapper struct {
+	*restmapper.DeferredDiscoveryRESTMapper
+	client *uncachedDiscoveryClient
+}
+
+func (m *uncachedRESTMapper) startLookup() {
+	atomic.StoreInt32(&m.client.read, 0)
+}
+
+func (m *uncachedRESTMapper) KindFor(resource schema.GroupVersionResource) (schema.GroupVersionKind, error) {
+	m.startLookup()
+	return m.DeferredDiscoveryRESTMapper.KindFor(resource)
+}
+
+func (m *uncachedRESTMapper) KindsFor(resource schema.GroupVersionResource) ([]schema.GroupVersionKind, error) {
+	m.startLookup()
+	return m.DeferredDiscoveryRESTMapper.KindsFor(resource)
+}
+
+func (m *uncachedRESTMapper) ResourceFor(input schema.GroupVersionResource) (schema.GroupVersionResource, error) {
+	m.startLookup()
+	return m.DeferredDiscoveryRESTMapper.ResourceFor(input)
+}
+
+func (m *uncachedRESTMapper) ResourcesFor(input schema.GroupVersionResource) ([]schema.GroupVersionResource, error) {
+	m.startLookup()
+	return m.DeferredDiscoveryRESTMapper.ResourcesFor(input)
+}
+
+func (m *uncachedRESTMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*apimeta.RESTMapping, error) {
+	m.startLookup()
+	return m.DeferredDiscoveryRESTMapper.RESTMapping(gk, versions...)
+}
+
+func (m *uncachedRESTMapper) RESTMappings(gk schema.GroupKind, versions ...string) ([]*apimeta.RESTMapping, error) {
+	m.startLookup()
+	return m.DeferredDiscoveryRESTMapper.RESTMappings(gk, versions...)
+}
+
+// newDiscoveryRESTMapper returns a RESTMapper reading discovery information with the given client in the
+// given mode.
+func newDiscoveryRESTMapper(discoveryClient discovery.DiscoveryInterface, mode DiscoveryMode) resettableRESTMapper {
+	if mode == DiscoveryUncached {
+		client := &uncachedDiscoveryClient{DiscoveryInterface: discoveryClient}
+		return &uncachedRESTMapper{DeferredDiscoveryRESTMapper: restmapper.NewDeferredDiscoveryRESTMapper(client), client: client}
+	}
+	return restmapper.NewDeferredDiscoveryRESTMapper(cacheddiscovery.NewMemCacheClient(discoveryClient))
+}
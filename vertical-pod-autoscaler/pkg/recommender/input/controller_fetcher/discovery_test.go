@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiscoveryModes(t *testing.T) {
+	widgets := schema.GroupKind{Group: "example.com", Kind: "Widget"}
+	for _, tc := range []struct {
+		mode DiscoveryMode
+		// installedKindFound tells whether a kind installed after the mapper was used is found right away.
+		installedKindFound bool
+	}{
+		{mode: "", installedKindFound: false},
+		{mode: DiscoveryCached, installedKindFound: false},
+		{mode: DiscoveryUncached, installedKindFound: true},
+	} {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			discovery := fake.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+			discovery.Resources = []*metav1.APIResourceList{{
+				GroupVersion: "apps/v1",
+				APIResources: []metav1.APIResource{{Name: "deployments", Namespaced: true, Kind: "Deployment"}},
+			}}
+			mapper := newDiscoveryRESTMapper(discovery, tc.mode)
+			// The fetcher resets the mapper when it starts, which fills the cache of cached discovery.
+			mapper.Reset()
+			_, err := mapper.RESTMapping(schema.GroupKind{Group: "apps", Kind: "Deployment"})
+			assert.NoError(t, err)
+
+			// The CRD of Widgets is installed, and Widgets are looked up for the first time since discovery
+			// information was read.
+			discovery.Resources = append(discovery.Resources, &metav1.APIResourceList{
+				GroupVersion: "example.com/v1",
+				APIResources: []metav1.APIResource{{Name: "widgets", Namespaced: true, Kind: "Widget"}},
+			})
+			reads := len(discovery.Actions())
+			_, err = mapper.RESTMapping(schema.GroupKind{Group: "apps", Kind: "Deployment"})
+			assert.NoError(t, err)
+			// Known kinds are mapped without reading discovery information in all modes.
+			assert.Equal(t, reads, len(discovery.Actions()))
+			_, err = mapper.RESTMapping(widgets)
+			assert.Equal(t, tc.installedKindFound, err == nil, "unexpected error: %v", err)
+
+			// A reset makes it known in all modes.
+			mapper.Reset()
+			_, err = mapper.RESTMapping(widgets)
+			assert.NoError(t, err)
+
+			// Kinds installed after a reset are found in the same way as those installed after start.
+			discovery.Resources = append(discovery.Resources, &metav1.APIResourceList{
+				GroupVersion: "example.com/v1alpha1",
+				APIResources: []metav1.APIResource{{Name: "gadgets", Namespaced: true, Kind: "Gadget"}},
+			})
+			_, err = mapper.RESTMapping(schema.GroupKind{Group: "example.com", Kind: "Gadget"})
+			assert.Equal(t, tc.installedKindFound, err == nil, "unexpected error: %v", err)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// cacheDumpEntry is a cached resolution as dumped by DumpCache.
+type cacheDumpEntry struct {
+	Input       ControllerKeyWithAPIVersion  `json:"input"`
+	TopLevel    *ControllerKeyWithAPIVersion `json:"topLevel"`
+	ResolvedVia string                       `json:"resolvedVia"`
+	HopCount    int                          `json:"hopCount"`
+	CachedAt    time.Time                    `json:"cachedAt"`
+	ExpiresAt   time.Time                    `json:"expiresAt"`
+}
+
+func (f *controllerFetcher) DumpCache() ([]byte, error) {
+	entries := []cacheDumpEntry{}
+	if f.resolutionCache != nil {
+		for key, entry := range f.resolutionCache.snapshot(time.Now()) {
+			entries = append(entries, cacheDumpEntry{
+				Input:       key,
+				TopLevel:    entry.result.TopLevel,
+				ResolvedVia: entry.result.ResolvedVia,
+				HopCount:    entry.result.HopCount,
+				CachedAt:    entry.cachedAt,
+				ExpiresAt:   entry.expiresAt,
+			})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].Input, entries[j].Input
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ApiVersion < b.ApiVersion
+	})
+	return json.MarshalIndent(entries, "", "  ")
+}
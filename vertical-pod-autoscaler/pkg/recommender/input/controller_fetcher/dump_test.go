@@ -0,0 +1,79 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDumpCache(t *testing.T) {
+	f := simpleControllerFetcher()
+	dump, err := f.DumpCache()
+	assert.NoError(t, err)
+	assert.Equal(t, "[]", string(dump))
+
+	f.resolutionCache = newResolutionCache(time.Minute)
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{Controller: &trueVar, Kind: "Deployment", Name: "test-deployment"},
+			},
+		},
+	})
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace", ResourceVersion: "7"},
+	})
+	rsKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}}
+	deploymentKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	for _, key := range []ControllerKeyWithAPIVersion{rsKey, deploymentKey} {
+		_, err = f.FindTopLevel(&key)
+		assert.NoError(t, err)
+	}
+	// Failed resolutions aren't cached.
+	_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.Error(t, err)
+
+	dump, err = f.DumpCache()
+	assert.NoError(t, err)
+	var entries []cacheDumpEntry
+	assert.NoError(t, json.Unmarshal(dump, &entries))
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, deploymentKey, entries[0].Input)
+		assert.Equal(t, rsKey, entries[1].Input)
+		for _, entry := range entries {
+			assert.Equal(t, &deploymentKey, entry.TopLevel)
+			assert.Equal(t, string(InformerPath), entry.ResolvedVia)
+			assert.Equal(t, time.Minute, entry.ExpiresAt.Sub(entry.CachedAt))
+		}
+		assert.Equal(t, 0, entries[0].HopCount)
+		assert.Equal(t, 1, entries[1].HopCount)
+	}
+}
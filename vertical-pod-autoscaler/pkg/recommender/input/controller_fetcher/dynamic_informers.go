@@ -0,0 +1,61 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// newDynamicInformers returns informers of the given resources, keyed by their GroupKind. Resources unknown to
+// the mapper are skipped.
+func newDynamicInformers(client dynamic.Interface, mapper apimeta.RESTMapper, resources []schema.GroupVersionResource) map[schema.GroupKind]cache.SharedIndexInformer {
+	informers := make(map[schema.GroupKind]cache.SharedIndexInformer)
+	for _, resource := range resources {
+		kind, err := mapper.KindFor(resource)
+		if err != nil {
+			klog.Errorf("Skipping dynamic informer for %s: %v", resource, err)
+			continue
+		}
+		informers[kind.GroupKind()] = newDynamicInformer(client, resource)
+	}
+	return informers
+}
+
+// newDynamicInformer returns an informer of unstructured objects of the given resource in all namespaces.
+func newDynamicInformer(client dynamic.Interface, resource schema.GroupVersionResource) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.Resource(resource).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.Resource(resource).Watch(options)
+			},
+		},
+		&unstructured.Unstructured{},
+		informersResyncPeriod,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+	)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestDynamicInformers(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	gadgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Gadget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	mapper.Add(gadgetKind, apimeta.RESTScopeNamespace)
+	widgets := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	unknown := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "unknowns"}
+
+	// The scale subresource of the Widget doesn't carry its owner, the informer does.
+	scales := newFakeScalesGetter()
+	scales.add(widgets.GroupResource(), &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-widget", Namespace: "test-namespace"},
+	})
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "gadgets"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-gadget", Namespace: "test-namespace"},
+	})
+	dynamicClient := newFakeDynamicClient()
+	dynamicClient.add(widgets.GroupResource(), newUnstructured("example.com/v1", "Widget", "test-namespace", "test-widget",
+		metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "Gadget", Name: "test-gadget", Controller: &trueVar}))
+
+	informers := newDynamicInformers(dynamicClient, mapper, []schema.GroupVersionResource{widgets, unknown})
+	assert.Len(t, informers, 1)
+	informer, found := informers[widgetKind.GroupKind()]
+	if !assert.True(t, found) {
+		return
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go informer.Run(stopCh)
+	assert.True(t, cache.WaitForCacheSync(stopCh, informer.HasSynced))
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.customInformers = informers
+	res, err := f.findTopLevel(context.Background(), &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-gadget", Kind: "Gadget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}, res.topLevel)
+	assert.Equal(t, []ResolutionPath{InformerPath, ScalePath}, res.paths)
+}
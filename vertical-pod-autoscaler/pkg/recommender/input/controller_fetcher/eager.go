@@ -0,0 +1,143 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+)
+
+// runEagerCache registers event handlers on the given informers which resolve each added or updated
+// controller in the background and cache the result, and invalidate the entries of deleted ones, see
+// Options.EagerCache. Handlers registered on running informers are sent an add of every object they hold, so
+// the cache gets preloaded with all known controllers. Workers stop with the fetcher.
+func (f *controllerFetcher) runEagerCache(informers map[wellKnownController]cache.SharedIndexInformer) {
+	queue := workqueue.NewNamed("controllerfetcher-eager-cache")
+	f.eagerQueue, f.eagerInformers = queue, informers
+	for kind, informer := range informers {
+		informer.AddEventHandler(f.eagerCacheHandler(kind, queue))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < f.resolutionWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f.preloadNext(queue) {
+			}
+		}()
+	}
+	go func() {
+		<-f.stopCh
+		queue.ShutDown()
+		wg.Wait()
+	}()
+}
+
+// eagerCacheHandler returns the event handler queueing controllers of the given kind for preloading. Resyncs,
+// which don't change controllers, aren't queued.
+func (f *controllerFetcher) eagerCacheHandler(kind wellKnownController, queue workqueue.Interface) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if key, ok := f.eagerCacheKey(kind, obj); ok {
+				queue.Add(key)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldAccessor, oldErr := apimeta.Accessor(oldObj)
+			newAccessor, newErr := apimeta.Accessor(newObj)
+			if oldErr == nil && newErr == nil && oldAccessor.GetResourceVersion() == newAccessor.GetResourceVersion() {
+				return
+			}
+			if key, ok := f.eagerCacheKey(kind, newObj); ok {
+				queue.Add(key)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if key, ok := f.eagerCacheKey(kind, obj); ok {
+				f.resolutionCache.invalidate(key)
+			}
+		},
+	}
+}
+
+// requeueEagerCache queues all controllers known to the informers for preloading, e.g. after the resolution
+// cache was purged. It does nothing unless resolutions are cached eagerly.
+func (f *controllerFetcher) requeueEagerCache() {
+	if f.eagerQueue == nil {
+		return
+	}
+	for kind, informer := range f.eagerInformers {
+		for _, obj := range informer.GetStore().List() {
+			if key, ok := f.eagerCacheKey(kind, obj); ok {
+				f.eagerQueue.Add(key)
+			}
+		}
+	}
+}
+
+// eagerCacheKey returns the key under which the resolution of the given controller is cached.
+func (f *controllerFetcher) eagerCacheKey(kind wellKnownController, obj interface{}) (ControllerKeyWithAPIVersion, bool) {
+	var namespace, name string
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		var err error
+		if namespace, name, err = cache.SplitMetaNamespaceKey(tombstone.Key); err != nil {
+			klog.Errorf("Failed to parse key of deleted %s %q: %v", kind, tombstone.Key, err)
+			return ControllerKeyWithAPIVersion{}, false
+		}
+	} else {
+		accessor, err := apimeta.Accessor(obj)
+		if err != nil {
+			klog.Errorf("Failed to read metadata of %s: %v", kind, err)
+			return ControllerKeyWithAPIVersion{}, false
+		}
+		namespace, name = accessor.GetNamespace(), accessor.GetName()
+	}
+	key := f.canonicalKey(ControllerKeyWithAPIVersion{
+		ControllerKey: ControllerKey{Namespace: namespace, Kind: string(kind), Name: name},
+		ApiVersion:    wellKnownControllerGroupVersions[kind],
+	})
+	key.ResourceVersion = ""
+	return key, true
+}
+
+// preloadNext resolves the next queued controller and caches the result. It returns false when the queue is
+// shut down. Controllers failing to resolve aren't retried, they're resolved again on their next change.
+func (f *controllerFetcher) preloadNext(queue workqueue.Interface) bool {
+	item, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(item)
+	key := item.(ControllerKeyWithAPIVersion)
+	res, err := f.findTopLevel(withFreshReads(context.Background()), &key)
+	if errors.Is(err, ErrControllerNotFound) {
+		f.resolutionCache.invalidate(key)
+	}
+	if err != nil {
+		klog.V(4).Infof("Failed to preload top level controller of %s %s/%s: %v", key.Kind, key.Namespace, key.Name, err)
+		return true
+	}
+	f.resolutionCache.set(key, *f.newFindTopLevelResult(res), time.Now())
+	return true
+}
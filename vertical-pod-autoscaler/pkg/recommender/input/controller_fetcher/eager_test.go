@@ -0,0 +1,117 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestEagerCache(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.resolutionCache = newResolutionCache(time.Minute)
+	rs := &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-rs",
+			Namespace:       "test-namespace",
+			ResourceVersion: "1",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Controller: &trueVar, Kind: "Deployment", Name: "deployment-a"},
+			},
+		},
+	}
+	addController(f, rs)
+	for _, name := range []string{"deployment-a", "deployment-b"} {
+		addController(f, &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+		})
+	}
+	key := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	queue := workqueue.New()
+	defer queue.ShutDown()
+	handler := f.eagerCacheHandler(replicaSet, queue)
+	cachedTopLevel := func() string {
+		result, found := f.resolutionCache.get(key, time.Now())
+		if !found {
+			return ""
+		}
+		return result.TopLevel.Name
+	}
+
+	// Added controllers are resolved before they're looked up.
+	handler.OnAdd(rs)
+	assert.True(t, f.preloadNext(queue))
+	assert.Equal(t, "deployment-a", cachedTopLevel())
+
+	// Resyncs aren't resolved again.
+	handler.OnUpdate(rs, rs)
+	assert.Equal(t, 0, queue.Len())
+
+	// Updates replace the cached resolution.
+	adopted := rs.DeepCopy()
+	adopted.ResourceVersion = "2"
+	adopted.OwnerReferences[0].Name = "deployment-b"
+	addController(f, adopted)
+	handler.OnUpdate(rs, adopted)
+	assert.True(t, f.preloadNext(queue))
+	assert.Equal(t, "deployment-b", cachedTopLevel())
+
+	// Deletes, even missed ones, invalidate it.
+	f.informersMap[replicaSet].GetStore().Delete(adopted)
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "test-namespace/test-rs", Obj: adopted})
+	assert.Equal(t, "", cachedTopLevel())
+
+	// Workers stop once the queue is shut down.
+	queue.ShutDown()
+	assert.False(t, f.preloadNext(queue))
+}
+
+func TestEagerCacheRequeuedAfterPurge(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.resolutionCache = newResolutionCache(time.Minute)
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	key := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	queue := workqueue.New()
+	defer queue.ShutDown()
+	f.eagerQueue = queue
+	f.eagerInformers = map[wellKnownController]cache.SharedIndexInformer{deployment: f.informersMap[deployment]}
+
+	f.resolutionCache.set(key, FindTopLevelResult{TopLevel: &key}, time.Now())
+	f.resetMapper()
+	_, found := f.resolutionCache.get(key, time.Now())
+	assert.False(t, found)
+
+	// Known controllers are preloaded again after the cache is purged.
+	assert.Equal(t, 1, queue.Len())
+	assert.True(t, f.preloadNext(queue))
+	_, found = f.resolutionCache.get(key, time.Now())
+	assert.True(t, found)
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	// ErrControllerNotFound is returned when a controller, or one of its owners, doesn't exist.
+	ErrControllerNotFound = errors.New("does not exist")
+	// ErrMissingNamespace is returned when a namespaced controller is looked up without a namespace.
+	ErrMissingNamespace = errors.New("namespace is required for namespaced controllers")
+	// ErrNonWorkloadTarget is returned when asked to resolve an object which isn't a workload, e.g. a Service.
+	ErrNonWorkloadTarget = errors.New("target is not a workload")
+	// ErrNoSelector is returned when the top level controller doesn't define a label selector, e.g. because
+	// the scale subresource of an older CRD doesn't populate status.selector.
+	ErrNoSelector = errors.New("top level controller has no selector")
+	// ErrResolutionTimeout is returned when resolution doesn't finish within the resolution timeout, or the
+	// deadline of its context. The error is a *ResolutionTimeoutError holding the partial chain.
+	ErrResolutionTimeout = errors.New("resolution timed out")
+	// ErrInferredOwner is returned when InferOwnersFromManagedFields is enabled and the top level controller
+	// looks managed by another controller. The error is an *InferredOwnerError.
+	ErrInferredOwner = errors.New("top level controller is likely managed by another controller")
+	// ErrUnreadableOwnerObject is returned when a well-known controller is stored as an object of an unexpected
+	// type, which means an informer doesn't hold the type the fetcher expects.
+	ErrUnreadableOwnerObject = errors.New("unreadable owner object")
+	// ErrUIDNotFound is returned when no controller known to the fetcher has the given UID.
+	ErrUIDNotFound = errors.New("no controller with the given UID")
+	// ErrCrossNamespaceOwner is returned when the owner a controller refers to isn't in the namespace of the
+	// controller but in another one. Owner references are namespace-local, so such a reference is broken.
+	ErrCrossNamespaceOwner = errors.New("owner is not in the namespace of the owned controller")
+	// ErrPodInformerDisabled is returned when resolving from a Pod which would have to be read from the
+	// Pod informer, but Options.WatchPods isn't set.
+	ErrPodInformerDisabled = errors.New("pod informer is disabled")
+	// ErrNoController is returned when resolving a Pod without a controller, unless Options.AllowStandalonePods
+	// is set.
+	ErrNoController = errors.New("pod has no controller")
+	// ErrMirrorPod is returned when resolving a mirror Pod of a static Pod, which is controlled by a Node, unless
+	// Options.MirrorPods is MirrorPodStandalone.
+	ErrMirrorPod = errors.New("pod is a mirror pod of a static pod")
+	// ErrHPAInformerDisabled is returned by FindTopLevelWithHPA if Options.WatchHPAs isn't set.
+	ErrHPAInformerDisabled = errors.New("HorizontalPodAutoscaler informer is disabled")
+	// ErrNoScalableAncestor is returned when neither a controller nor any of its owners is known to have a
+	// scale subresource.
+	ErrNoScalableAncestor = errors.New("no scalable ancestor")
+	// ErrOwnershipCycle is returned when following owners leads back to a controller already visited.
+	ErrOwnershipCycle = errors.New("Cycle detected in ownership chain")
+	// ErrKindUnavailable is returned when resolving a well-known controller whose API version the server
+	// doesn't serve, e.g. a Job on a server without batch/v1.
+	ErrKindUnavailable = errors.New("kind is not served by the API server")
+	// ErrUnexpectedOwnerKind is returned when a controller is owned by a built-in kind which isn't expected to
+	// own it and Options.OwnerKindValidation is OwnerKindValidationStrict.
+	ErrUnexpectedOwnerKind = errors.New("unexpected kind of owner")
+	// ErrAmbiguousDeploymentOwner is returned when a ReplicaSet is controlled by several Deployments and
+	// Options.OwnerKindValidation is OwnerKindValidationStrict.
+	ErrAmbiguousDeploymentOwner = errors.New("ReplicaSet is controlled by several Deployments")
+	// ErrTargetTerminating is returned when the top level controller and every controller on the way to it are
+	// being deleted and Options.RejectTerminatingTargets is set.
+	ErrTargetTerminating = errors.New("target is being deleted")
+	// ErrFetcherStopped is passed to callbacks of ResolveAsync for resolutions which didn't finish before the
+	// fetcher was stopped.
+	ErrFetcherStopped = errors.New("controller fetcher is stopped")
+	// ErrSelfOwnership is returned when a controller is its own controller. Such errors unwrap to
+	// ErrOwnershipCycle too.
+	ErrSelfOwnership = errors.New("controller is its own owner")
+	// ErrNoScaleMapping is returned when the kind of a controller read through the scale subresource isn't
+	// mapped to any resource, so there's no scale subresource to read.
+	ErrNoScaleMapping = errors.New("kind is not mapped to any resource")
+	// ErrEmptyScale is the error of a scale subresource read which returned neither a scale nor an error. It's
+	// taken as a failed read rather than a controller without owners.
+	ErrEmptyScale = errors.New("scale subresource read returned nothing")
+)
+
+// sentinelErrors holds every sentinel error above with the code the resolution server reports it with. An error
+// gets the code of the first sentinel it matches, so sentinels which wrap others come first.
+var sentinelErrors = []struct {
+	err  error
+	code ResolutionErrorCode
+}{
+	{ErrControllerNotFound, ErrorCodeControllerNotFound},
+	{ErrMissingNamespace, ErrorCodeMissingNamespace},
+	{ErrNonWorkloadTarget, ErrorCodeNonWorkloadTarget},
+	{ErrNoSelector, ErrorCodeNoSelector},
+	{ErrResolutionTimeout, ErrorCodeResolutionTimeout},
+	{ErrInferredOwner, ErrorCodeInferredOwner},
+	{ErrUnreadableOwnerObject, ErrorCodeUnreadableOwnerObject},
+	{ErrUIDNotFound, ErrorCodeUIDNotFound},
+	{ErrCrossNamespaceOwner, ErrorCodeCrossNamespaceOwner},
+	{ErrPodInformerDisabled, ErrorCodePodInformerDisabled},
+	{ErrNoController, ErrorCodeNoController},
+	{ErrMirrorPod, ErrorCodeMirrorPod},
+	{ErrHPAInformerDisabled, ErrorCodeHPAInformerDisabled},
+	{ErrNoScalableAncestor, ErrorCodeNoScalableAncestor},
+	{ErrSelfOwnership, ErrorCodeSelfOwnership},
+	{ErrOwnershipCycle, ErrorCodeOwnershipCycle},
+	{ErrKindUnavailable, ErrorCodeKindUnavailable},
+	{ErrUnexpectedOwnerKind, ErrorCodeUnexpectedOwnerKind},
+	{ErrAmbiguousDeploymentOwner, ErrorCodeAmbiguousDeploymentOwner},
+	{ErrTargetTerminating, ErrorCodeTargetTerminating},
+	{ErrFetcherStopped, ErrorCodeFetcherStopped},
+	{ErrNoScaleMapping, ErrorCodeNoScaleMapping},
+	{ErrEmptyScale, ErrorCodeEmptyScale},
+}
+
+// ResolutionTimeoutError is returned when resolution times out. It unwraps to ErrResolutionTimeout.
+type ResolutionTimeoutError struct {
+	// Chain holds the controllers read before the timeout, starting from the one being resolved.
+	Chain []ControllerKeyWithAPIVersion
+}
+
+func (e *ResolutionTimeoutError) Error() string {
+	if len(e.Chain) == 0 {
+		return ErrResolutionTimeout.Error()
+	}
+	last := e.Chain[len(e.Chain)-1]
+	return fmt.Sprintf("%v after reading %d controllers, last %s %s/%s", ErrResolutionTimeout, len(e.Chain), last.Kind, last.Namespace, last.Name)
+}
+
+func (e *ResolutionTimeoutError) Unwrap() error {
+	return ErrResolutionTimeout
+}
+
+// ScaleAttempt is a failed read of a scale subresource.
+type ScaleAttempt struct {
+	// GroupResource is the resource whose scale subresource was read.
+	GroupResource schema.GroupResource
+	// Err is the error the read failed with.
+	Err error
+}
+
+// ScaleResolutionError is returned when a controller can't be read through the scale subresource of any of
+// the resources its kind is mapped to. It unwraps to the error of the last attempt.
+type ScaleResolutionError struct {
+	// GroupKind is the kind of the controller.
+	GroupKind schema.GroupKind
+	// Attempts holds a failed read per resource, in the order they were tried.
+	Attempts []ScaleAttempt
+}
+
+func (e *ScaleResolutionError) Error() string {
+	attempts := make([]string, 0, len(e.Attempts))
+	for _, attempt := range e.Attempts {
+		attempts = append(attempts, fmt.Sprintf("%s: %v", attempt.GroupResource, attempt.Err))
+	}
+	return fmt.Sprintf("no scale subresource of %s could be read, tried %s", e.GroupKind, strings.Join(attempts, "; "))
+}
+
+func (e *ScaleResolutionError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1].Err
+}
+
+// InferredOwnerError suggests the controller managing a top level controller without owner references. It's
+// only a hint based on managedFields. It unwraps to ErrInferredOwner.
+type InferredOwnerError struct {
+	// TopLevel is the resolved top level controller.
+	TopLevel ControllerKeyWithAPIVersion
+	// Manager is the field manager likely to be the owner of TopLevel.
+	Manager string
+}
+
+func (e *InferredOwnerError) Error() string {
+	return fmt.Sprintf("%v: %s %s/%s has no owner but is managed by %q", ErrInferredOwner,
+		e.TopLevel.Kind, e.TopLevel.Namespace, e.TopLevel.Name, e.Manager)
+}
+
+func (e *InferredOwnerError) Unwrap() error {
+	return ErrInferredOwner
+}
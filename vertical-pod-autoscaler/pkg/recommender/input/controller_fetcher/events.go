@@ -0,0 +1,166 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// resolveEventsBufferSize is the number of resolve events buffered for a slow OnResolve callback.
+	resolveEventsBufferSize = 1000
+)
+
+// ResolveEvent describes a single FindTopLevel call.
+type ResolveEvent struct {
+	// Controller is the controller FindTopLevel was called with. It's the Pod for resolutions of Pods, and only
+	// has Namespace set for lookups by UID which found nothing.
+	Controller ControllerKeyWithAPIVersion
+	// TopLevel is the resolved top level controller, nil if resolution failed.
+	TopLevel *ControllerKeyWithAPIVersion
+	// Hops is the number of owners followed from Controller.
+	Hops int
+	// Paths holds the resolution path of each controller read, starting from Controller.
+	Paths []ResolutionPath
+	// Cached is true if the top level controller, or the failure to resolve it, was served from the
+	// resolution cache, in which case no controller was read.
+	Cached bool
+	// Shared is true if the resolution was collapsed into a concurrent resolution of the same controller by
+	// another caller, whose result it got. Paths is nil then.
+	Shared bool
+	// Err is the error resolution failed with.
+	Err error
+	// RequestID is the ID the resolution was tagged with by WithRequestID, or the one generated for it if its
+	// context wasn't tagged.
+	RequestID string
+}
+
+// resolveEvents delivers resolve events to a callback from a single goroutine, dropping events which
+// don't fit in the buffer. Once stopped, events still buffered and events sent later are dropped too.
+type resolveEvents struct {
+	events   chan ResolveEvent
+	callback func(ResolveEvent)
+	dropped  uint64
+	// onDrop is called with each dropped event and the number of events dropped so far, if it's set.
+	onDrop func(event ResolveEvent, dropped uint64)
+	// mutex guards stopped, send holds it for reading so that no event is buffered after the buffer is drained.
+	mutex   sync.RWMutex
+	stopped bool
+}
+
+func newResolveEvents(callback func(ResolveEvent), bufferSize int, stopCh <-chan struct{}) *resolveEvents {
+	e := &resolveEvents{
+		events:   make(chan ResolveEvent, bufferSize),
+		callback: callback,
+	}
+	go e.run(stopCh)
+	return e
+}
+
+func (e *resolveEvents) run(stopCh <-chan struct{}) {
+	defer e.stop()
+	for {
+		// Buffered events aren't delivered once stopped, even if both channels are ready.
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		select {
+		case event := <-e.events:
+			e.callback(event)
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// stop drops the buffered events and makes send drop all later ones.
+func (e *resolveEvents) stop() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.stopped = true
+	for {
+		select {
+		case event := <-e.events:
+			e.drop(event)
+		default:
+			return
+		}
+	}
+}
+
+// send queues the event without blocking.
+func (e *resolveEvents) send(event ResolveEvent) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	if e.stopped {
+		e.drop(event)
+		return
+	}
+	select {
+	case e.events <- event:
+	default:
+		e.drop(event)
+	}
+}
+
+func (e *resolveEvents) drop(event ResolveEvent) {
+	dropped := atomic.AddUint64(&e.dropped, 1)
+	if e.onDrop != nil {
+		e.onDrop(event, dropped)
+	}
+}
+
+func (e *resolveEvents) droppedCount() uint64 {
+	return atomic.LoadUint64(&e.dropped)
+}
+
+func (f *controllerFetcher) notifyResolve(event ResolveEvent) {
+	if f.resolveEvents != nil {
+		f.resolveEvents.send(event)
+	}
+	if f.auditEvents != nil {
+		f.auditEvents.send(event)
+	}
+}
+
+// notifyAnswered notifies about a call answered without resolving a controller, e.g. resolution of a Pod without
+// owners, like about resolutions.
+func (f *controllerFetcher) notifyAnswered(ctx context.Context, controller ControllerKeyWithAPIVersion,
+	topLevel *ControllerKeyWithAPIVersion, err error) {
+	_, requestID := ensureRequestID(ctx)
+	f.notifyResolve(ResolveEvent{Controller: controller, TopLevel: copyKey(topLevel), Err: err, RequestID: requestID})
+}
+
+func (f *controllerFetcher) DroppedResolveEvents() uint64 {
+	if f.resolveEvents == nil {
+		return 0
+	}
+	return f.resolveEvents.droppedCount()
+}
+
+// copyKey returns a copy of the given key, so that events don't share keys returned to callers.
+func copyKey(key *ControllerKeyWithAPIVersion) *ControllerKeyWithAPIVersion {
+	if key == nil {
+		return nil
+	}
+	keyCopy := *key
+	return &keyCopy
+}
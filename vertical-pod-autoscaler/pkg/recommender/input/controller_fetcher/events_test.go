@@ -0,0 +1,144 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestOnResolve(t *testing.T) {
+	f := simpleControllerFetcher()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	received := make(chan ResolveEvent)
+	release := make(chan struct{})
+	f.resolveEvents = newResolveEvents(func(event ResolveEvent) {
+		received <- event
+		<-release
+	}, 1, stopCh)
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{Controller: &trueVar, Kind: "Deployment", Name: "test-deployment"},
+			},
+		},
+	})
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	rsKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}}
+	missingKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}}
+
+	topLevel, err := f.FindTopLevel(rsKey)
+	assert.NoError(t, err)
+	select {
+	case event := <-received:
+		assert.Equal(t, *rsKey, event.Controller)
+		assert.Equal(t, topLevel, event.TopLevel)
+		assert.Equal(t, 1, event.Hops)
+		assert.Equal(t, []ResolutionPath{InformerPath, InformerPath}, event.Paths)
+		assert.NoError(t, event.Err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("OnResolve not called")
+	}
+	release <- struct{}{}
+
+	_, err = f.FindTopLevel(missingKey)
+	assert.Error(t, err)
+	event := <-received
+	assert.Equal(t, *missingKey, event.Controller)
+	assert.Nil(t, event.TopLevel)
+	assert.Equal(t, 0, event.Hops)
+	assert.Error(t, event.Err)
+
+	// The callback is blocked, so the next event is buffered and the rest are dropped without stalling
+	// resolution.
+	for i := 0; i < 3; i++ {
+		_, err = f.FindTopLevel(missingKey)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, uint64(2), f.DroppedResolveEvents())
+	release <- struct{}{}
+	<-received
+	release <- struct{}{}
+}
+
+func TestOnResolveSharedResolutions(t *testing.T) {
+	f, unblock, _, slowKey := batchTestFetcher()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	received := make(chan ResolveEvent, 10)
+	f.resolveEvents = newResolveEvents(func(event ResolveEvent) {
+		received <- event
+	}, 10, stopCh)
+	scales := f.scaleNamespacer.(*fakeScalesGetter)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := f.FindTopLevel(slowKey)
+			assert.NoError(t, err)
+		}()
+	}
+	assert.NoError(t, wait.PollImmediate(time.Millisecond, 10*time.Second, func() (bool, error) {
+		scales.mutex.Lock()
+		defer scales.mutex.Unlock()
+		return scales.gets > 0, nil
+	}))
+	// Give the other callers time to wait for the blocked resolution.
+	time.Sleep(50 * time.Millisecond)
+	close(unblock)
+	wg.Wait()
+
+	// Each caller is notified, also those which shared the resolution of another.
+	var shared int
+	for i := 0; i < 3; i++ {
+		select {
+		case event := <-received:
+			assert.NoError(t, event.Err)
+			if assert.NotNil(t, event.TopLevel) {
+				assert.Equal(t, "test-parent", event.TopLevel.Name)
+			}
+			assert.Equal(t, 1, event.Hops)
+			if event.Shared {
+				shared++
+				assert.Nil(t, event.Paths)
+			} else {
+				assert.Len(t, event.Paths, 2)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("OnResolve not called")
+		}
+	}
+	assert.Equal(t, 2, shared)
+}
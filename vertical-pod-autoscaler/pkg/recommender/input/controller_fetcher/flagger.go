@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"fmt"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// flaggerGroup is the API group of Flagger.
+const flaggerGroup = "flagger.app"
+
+// flaggerCanary is the kind of Flagger Canaries. A Canary refers to the Deployment it manages with
+// spec.targetRef and owns the primary Deployment Flagger creates from it, named after the target with
+// flaggerPrimarySuffix. Canaries have no scale subresource, so they're read with the dynamic client.
+var flaggerCanary = schema.GroupKind{Group: flaggerGroup, Kind: "Canary"}
+
+// flaggerPrimarySuffix is appended to the name of the target of a Canary to get the name of its primary.
+const flaggerPrimarySuffix = "-primary"
+
+// FlaggerTerminal is the top level controller of Deployments managed by Flagger Canaries.
+type FlaggerTerminal string
+
+const (
+	// FlaggerCanaryTerminal resolves primary Deployments to the Canary owning them, which is top level. This is
+	// the default.
+	FlaggerCanaryTerminal FlaggerTerminal = "Canary"
+	// FlaggerPrimaryTerminal makes primary Deployments top level, and resolves Canaries to their primary, so
+	// that recommendations follow the primary whether the Canary or the Deployment is targeted.
+	FlaggerPrimaryTerminal FlaggerTerminal = "Primary"
+)
+
+// flaggerPrimaryRef is a ScaleTargetRefExtractor returning the primary of a Canary.
+func flaggerPrimaryRef(obj *unstructured.Unstructured) (*autoscalingv1.CrossVersionObjectReference, error) {
+	ref, found, err := unstructured.NestedMap(obj.Object, "spec", "targetRef")
+	if err != nil || !found {
+		return nil, err
+	}
+	target := &autoscalingv1.CrossVersionObjectReference{}
+	for field, value := range map[string]*string{"apiVersion": &target.APIVersion, "kind": &target.Kind, "name": &target.Name} {
+		if *value, _, err = unstructured.NestedString(ref, field); err != nil {
+			return nil, err
+		}
+	}
+	if target.Kind == "" || target.Name == "" {
+		return nil, fmt.Errorf("spec.targetRef of Canary %s/%s lacks a kind or name", obj.GetNamespace(), obj.GetName())
+	}
+	target.Name += flaggerPrimarySuffix
+	return target, nil
+}
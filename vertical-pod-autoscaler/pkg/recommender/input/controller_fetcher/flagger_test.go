@@ -0,0 +1,91 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFindTopLevelForFlaggerCanary(t *testing.T) {
+	flaggerV1beta1 := schema.GroupVersion{Group: flaggerGroup, Version: "v1beta1"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{flaggerV1beta1})
+	mapper.Add(flaggerV1beta1.WithKind("Canary"), apimeta.RESTScopeNamespace)
+	canary := newUnstructured("flagger.app/v1beta1", "Canary", "test-namespace", "podinfo")
+	assert.NoError(t, unstructured.SetNestedStringMap(canary.Object, map[string]string{
+		"apiVersion": "apps/v1", "kind": "Deployment", "name": "podinfo"}, "spec", "targetRef"))
+	dynamicClient := newFakeDynamicClient()
+	dynamicClient.add(schema.GroupResource{Group: flaggerGroup, Resource: "canaries"}, canary)
+
+	newFetcher := func(terminal FlaggerTerminal) *controllerFetcher {
+		f := simpleControllerFetcher()
+		f.mapper = mapper
+		f.scaleNamespacer = newFakeScalesGetter()
+		f.dynamicClient = dynamicClient
+		f.nonWorkloadOwnerKinds = make(map[schema.GroupKind]bool)
+		if terminal == FlaggerPrimaryTerminal {
+			f.nonWorkloadOwnerKinds[flaggerCanary] = true
+			f.scaleTargetRefExtractors = map[schema.GroupKind]ScaleTargetRefExtractor{flaggerCanary: flaggerPrimaryRef}
+		}
+		// The primary is owned by the Canary, the target it's copied from isn't.
+		addController(f, &appsv1.Deployment{
+			TypeMeta: metav1.TypeMeta{Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "podinfo-primary",
+				Namespace: "test-namespace",
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "flagger.app/v1beta1", Kind: "Canary", Name: "podinfo", Controller: &trueVar},
+				},
+			},
+		})
+		addController(f, &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "test-namespace"},
+		})
+		return f
+	}
+	primaryKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "podinfo-primary", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	canaryKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "podinfo", Kind: "Canary", Namespace: "test-namespace"}, ApiVersion: "flagger.app/v1beta1"}
+
+	// By default the Canary is top level.
+	f := newFetcher(FlaggerCanaryTerminal)
+	res, err := f.findTopLevel(context.Background(), primaryKey)
+	assert.NoError(t, err)
+	assert.Equal(t, canaryKey, res.topLevel)
+	assert.Equal(t, []ResolutionPath{InformerPath, DynamicPath}, res.paths)
+	topLevel, err := f.FindTopLevel(canaryKey)
+	assert.NoError(t, err)
+	assert.Equal(t, canaryKey, topLevel)
+
+	// With the primary as terminal, both the primary and the Canary resolve to the primary.
+	f = newFetcher(FlaggerPrimaryTerminal)
+	for _, key := range []*ControllerKeyWithAPIVersion{primaryKey, canaryKey} {
+		topLevel, err := f.FindTopLevel(key)
+		assert.NoError(t, err)
+		assert.Equal(t, primaryKey, topLevel, "top level controller of %s", key.Kind)
+	}
+}
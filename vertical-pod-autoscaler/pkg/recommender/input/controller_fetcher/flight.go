@@ -0,0 +1,87 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// resolutionFlight is a resolution in progress, which concurrent resolutions of the same controller wait for.
+type resolutionFlight struct {
+	done   chan struct{}
+	result *FindTopLevelResult
+	err    error
+}
+
+// resolutionFlights collapses concurrent resolutions of the same controller into one, so that a burst of
+// lookups of a controller which isn't cached yet reads its owners once. The zero value is ready for use.
+type resolutionFlights struct {
+	mutex   sync.Mutex
+	flights map[ControllerKeyWithAPIVersion]*resolutionFlight
+}
+
+// do calls resolve for the given key, unless a resolution of the key is in progress, in which case it waits for
+// that one and returns a copy of its result; shared tells which. Waiting stops when ctx is done, failing with a
+// ResolutionTimeoutError if its deadline passed. Resolutions canceled or timed out through the context of another
+// caller are retried, so that callers don't fail with each other's cancellations and deadlines.
+func (g *resolutionFlights) do(ctx context.Context, key ControllerKeyWithAPIVersion, resolve func() (*FindTopLevelResult, error)) (result *FindTopLevelResult, shared bool, err error) {
+	for {
+		g.mutex.Lock()
+		flight, found := g.flights[key]
+		if !found {
+			flight = &resolutionFlight{done: make(chan struct{})}
+			if g.flights == nil {
+				g.flights = make(map[ControllerKeyWithAPIVersion]*resolutionFlight)
+			}
+			g.flights[key] = flight
+			g.mutex.Unlock()
+			g.run(key, flight, resolve)
+			return flight.result, false, flight.err
+		}
+		g.mutex.Unlock()
+		select {
+		case <-flight.done:
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, true, &ResolutionTimeoutError{}
+			}
+			return nil, true, ctx.Err()
+		}
+		canceled := errors.Is(flight.err, context.Canceled) || errors.Is(flight.err, context.DeadlineExceeded) ||
+			errors.Is(flight.err, ErrResolutionTimeout)
+		if canceled && ctx.Err() == nil {
+			continue
+		}
+		return copyResult(flight.result), true, flight.err
+	}
+}
+
+// run calls resolve for the given flight and releases callers waiting for it, even if resolve panics.
+func (g *resolutionFlights) run(key ControllerKeyWithAPIVersion, flight *resolutionFlight, resolve func() (*FindTopLevelResult, error)) {
+	defer func() {
+		g.mutex.Lock()
+		delete(g.flights, key)
+		g.mutex.Unlock()
+		close(flight.done)
+	}()
+	// Seen by waiting callers only if resolve panics.
+	flight.err = fmt.Errorf("resolution of %s %s/%s panicked", key.Kind, key.Namespace, key.Name)
+	flight.result, flight.err = resolve()
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolutionFlightsCollapse(t *testing.T) {
+	var flights resolutionFlights
+	key := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	var resolutions int32
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	resolve := func() (*FindTopLevelResult, error) {
+		if atomic.AddInt32(&resolutions, 1) == 1 {
+			close(started)
+		}
+		<-unblock
+		return &FindTopLevelResult{TopLevel: copyKey(&key)}, nil
+	}
+
+	var wg sync.WaitGroup
+	var sharedResults int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-started
+			result, shared, err := flights.do(context.Background(), key, resolve)
+			assert.NoError(t, err)
+			if assert.NotNil(t, result) {
+				assert.Equal(t, key, *result.TopLevel)
+			}
+			if shared {
+				atomic.AddInt32(&sharedResults, 1)
+			}
+		}()
+	}
+	result, shared, err := flights.do(context.Background(), key, func() (*FindTopLevelResult, error) {
+		go func() {
+			// Give the other callers time to wait for this resolution.
+			time.Sleep(50 * time.Millisecond)
+			close(unblock)
+		}()
+		return resolve()
+	})
+	wg.Wait()
+	assert.NoError(t, err)
+	assert.False(t, shared)
+	assert.Equal(t, key, *result.TopLevel)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&resolutions))
+	assert.Equal(t, int32(10), atomic.LoadInt32(&sharedResults))
+
+	// Callers get copies of the result.
+	result.TopLevel.Name = "modified"
+	result, _, err = flights.do(context.Background(), key, resolve)
+	assert.NoError(t, err)
+	assert.Equal(t, key, *result.TopLevel)
+}
+
+func TestResolutionFlightsCancellation(t *testing.T) {
+	var flights resolutionFlights
+	key := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	leaderDone := make(chan error)
+	go func() {
+		_, _, err := flights.do(context.Background(), key, func() (*FindTopLevelResult, error) {
+			close(entered)
+			<-unblock
+			return nil, context.Canceled
+		})
+		leaderDone <- err
+	}()
+	<-entered
+
+	// Waiting callers give up when their context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, shared, err := flights.do(ctx, key, nil)
+	assert.True(t, shared)
+	assert.True(t, errors.Is(err, ErrResolutionTimeout), "unexpected error: %v", err)
+
+	// Cancellations of the resolution waited for are retried.
+	followerDone := make(chan *FindTopLevelResult)
+	go func() {
+		result, _, err := flights.do(context.Background(), key, func() (*FindTopLevelResult, error) {
+			return &FindTopLevelResult{TopLevel: copyKey(&key)}, nil
+		})
+		assert.NoError(t, err)
+		followerDone <- result
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(unblock)
+	assert.Equal(t, context.Canceled, <-leaderDone)
+	if result := <-followerDone; assert.NotNil(t, result) {
+		assert.Equal(t, key, *result.TopLevel)
+	}
+}
+
+func TestResolutionFlightsLeaderTimeout(t *testing.T) {
+	var flights resolutionFlights
+	key := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	entered := make(chan struct{})
+	leaderDone := make(chan error)
+	go func() {
+		// The leader runs with a short deadline and times out while others wait for it.
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, _, err := flights.do(ctx, key, func() (*FindTopLevelResult, error) {
+			close(entered)
+			<-ctx.Done()
+			return nil, &ResolutionTimeoutError{}
+		})
+		leaderDone <- err
+	}()
+	<-entered
+
+	// A waiter with a longer deadline resolves the key itself instead of failing with the leader's timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var resolutions int32
+	result, _, err := flights.do(ctx, key, func() (*FindTopLevelResult, error) {
+		atomic.AddInt32(&resolutions, 1)
+		return &FindTopLevelResult{TopLevel: copyKey(&key)}, nil
+	})
+	assert.NoError(t, err)
+	if assert.NotNil(t, result) {
+		assert.Equal(t, key, *result.TopLevel)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&resolutions))
+	err = <-leaderDone
+	assert.True(t, errors.Is(err, ErrResolutionTimeout), "unexpected error: %v", err)
+}
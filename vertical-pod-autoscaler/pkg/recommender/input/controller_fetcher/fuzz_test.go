@@ -0,0 +1,177 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// maxFuzzControllers bounds the size of generated owner graphs. FindAllTopLevels follows every owner of
+	// controllers without a controlling owner, so the number of paths it walks grows exponentially with it.
+	maxFuzzControllers = 8
+	maxFuzzOwners      = 3
+)
+
+// fuzzKinds are the kinds of generated controllers, all of them well-known so that they're read from informers.
+var fuzzKinds = []wellKnownController{deployment, replicaSet, statefulSet, daemonSet, job, replicationController}
+
+// fuzzController is a generated controller, its owners index the generated controllers. Indexes past the last
+// controller refer to controllers which don't exist.
+type fuzzController struct {
+	kind       wellKnownController
+	owners     []int
+	controller []bool
+}
+
+// newFuzzOwnerGraph decodes an owner graph from the fuzzer input.
+func newFuzzOwnerGraph(data []byte) []fuzzController {
+	next := func() int {
+		if len(data) == 0 {
+			return 0
+		}
+		b := int(data[0])
+		data = data[1:]
+		return b
+	}
+	controllers := make([]fuzzController, next()%maxFuzzControllers+1)
+	for i := range controllers {
+		controllers[i].kind = fuzzKinds[next()%len(fuzzKinds)]
+		for j := next() % (maxFuzzOwners + 1); j > 0; j-- {
+			b := next()
+			controllers[i].owners = append(controllers[i].owners, (b>>1)%(len(controllers)+1))
+			controllers[i].controller = append(controllers[i].controller, b&1 == 1)
+		}
+	}
+	return controllers
+}
+
+func fuzzControllerName(i int) string {
+	return fmt.Sprintf("controller-%d", i)
+}
+
+// newFuzzObject returns the object of the controller with the given index, with its owner references.
+func newFuzzObject(controllers []fuzzController, i int) runtime.Object {
+	c := controllers[i]
+	meta := metav1.ObjectMeta{Name: fuzzControllerName(i), Namespace: "test-namespace"}
+	for j, owner := range c.owners {
+		kind := deployment
+		if owner < len(controllers) {
+			kind = controllers[owner].kind
+		}
+		isController := c.controller[j]
+		meta.OwnerReferences = append(meta.OwnerReferences, metav1.OwnerReference{
+			APIVersion: wellKnownControllerGroupVersions[kind],
+			Kind:       string(kind),
+			Name:       fuzzControllerName(owner),
+			Controller: &isController,
+		})
+	}
+	typeMeta := metav1.TypeMeta{Kind: string(c.kind)}
+	switch c.kind {
+	case deployment:
+		return &appsv1.Deployment{TypeMeta: typeMeta, ObjectMeta: meta}
+	case replicaSet:
+		return &appsv1.ReplicaSet{TypeMeta: typeMeta, ObjectMeta: meta}
+	case statefulSet:
+		return &appsv1.StatefulSet{TypeMeta: typeMeta, ObjectMeta: meta}
+	case daemonSet:
+		return &appsv1.DaemonSet{TypeMeta: typeMeta, ObjectMeta: meta}
+	case job:
+		return &batchv1.Job{TypeMeta: typeMeta, ObjectMeta: meta}
+	default:
+		return &corev1.ReplicationController{TypeMeta: typeMeta, ObjectMeta: meta}
+	}
+}
+
+// checkFuzzTopLevel checks the given key is a generated controller without a controlling owner.
+func checkFuzzTopLevel(t *testing.T, controllers []fuzzController, key ControllerKeyWithAPIVersion) {
+	for i, c := range controllers {
+		if key.Name != fuzzControllerName(i) {
+			continue
+		}
+		if key.Kind != string(c.kind) {
+			t.Errorf("top level controller %v has the kind of another controller", key)
+		}
+		for _, isController := range c.controller {
+			if isController {
+				t.Errorf("top level controller %v has a controlling owner", key)
+			}
+		}
+		return
+	}
+	t.Errorf("top level controller %v doesn't exist", key)
+}
+
+func FuzzFindTopLevel(f *testing.F) {
+	// The first byte is the number of controllers minus one, then for each controller its kind, its number of
+	// owners and for each owner its index shifted left by one, with the lowest bit set for controlling owners.
+	f.Add([]byte{0, 0, 0})                                                                   // a single Deployment
+	f.Add([]byte{0, 1, 1, 1})                                                                // a ReplicaSet controlling itself
+	f.Add([]byte{1, 1, 1, 3, 1, 1, 1})                                                       // two ReplicaSets controlling each other
+	f.Add([]byte{1, 1, 1, 5, 0, 0})                                                          // a ReplicaSet controlled by a missing controller
+	f.Add([]byte{2, 1, 2, 2, 4, 0, 0, 0, 0})                                                 // a ReplicaSet with two owners, neither controlling it
+	f.Add([]byte{2, 1, 2, 3, 5, 0, 0, 0, 0})                                                 // a ReplicaSet with two controlling owners
+	f.Add([]byte{7, 1, 1, 3, 1, 1, 5, 1, 1, 7, 1, 1, 9, 1, 1, 11, 1, 1, 13, 1, 1, 15, 1, 0}) // a long chain
+	f.Add([]byte{3, 1, 1, 3, 1, 1, 5, 1, 1, 7, 1, 1, 3})                                     // a chain leading into a cycle
+	f.Fuzz(func(t *testing.T, data []byte) {
+		controllers := newFuzzOwnerGraph(data)
+		fetcher := simpleControllerFetcher()
+		for i := range controllers {
+			addController(fetcher, newFuzzObject(controllers, i))
+		}
+		key := &ControllerKeyWithAPIVersion{
+			ControllerKey: ControllerKey{Namespace: "test-namespace", Kind: string(controllers[0].kind), Name: fuzzControllerName(0)},
+			ApiVersion:    wellKnownControllerGroupVersions[controllers[0].kind],
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			topLevel, err := fetcher.FindTopLevel(key)
+			if err == nil {
+				checkFuzzTopLevel(t, controllers, *topLevel)
+			} else if !errors.Is(err, ErrOwnershipCycle) && !errors.Is(err, ErrControllerNotFound) {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			topLevels, err := fetcher.FindAllTopLevels(context.Background(), key)
+			if err == nil {
+				for _, topLevel := range topLevels {
+					checkFuzzTopLevel(t, controllers, *topLevel)
+				}
+			} else if !errors.Is(err, ErrOwnershipCycle) && !errors.Is(err, ErrControllerNotFound) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("resolution of %v didn't terminate", controllers)
+		}
+	})
+}
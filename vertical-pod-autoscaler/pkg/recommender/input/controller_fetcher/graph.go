@@ -0,0 +1,98 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NewGraphControllerFetcher returns a controller fetcher resolving controllers from the given ownership graph,
+// mapping each controller to its controller owner (nil for top level controllers), e.g. for tests or to explain
+// resolutions against a dump of a cluster. It never reads from the API server. Resolution walks the graph like
+// it walks a cluster, with the same checks (cycles, owners in other namespaces...). Controllers of kinds which
+// appear in the graph but not as keys don't exist, controllers of other kinds are top level controllers. It fails
+// if a controller or owner of the graph has an invalid API version.
+func NewGraphControllerFetcher(graph map[ControllerKeyWithAPIVersion]*ControllerKeyWithAPIVersion) (ExtendedControllerFetcher, error) {
+	f := &controllerFetcher{
+		informersMap:           make(map[wellKnownController]cache.SharedIndexInformer),
+		customInformers:        make(map[schema.GroupKind]cache.SharedIndexInformer),
+		terminalKinds:          make(map[schema.GroupKind]bool),
+		disableScaleResolution: true,
+		stopCh:                 make(chan struct{}),
+	}
+	stores := make(map[schema.GroupKind]cache.Store)
+	store := func(key ControllerKeyWithAPIVersion) (cache.Store, error) {
+		groupVersion, err := schema.ParseGroupVersion(key.ApiVersion)
+		if err != nil {
+			return nil, err
+		}
+		groupKind := schema.GroupKind{Group: groupVersion.Group, Kind: key.Kind}
+		if _, found := stores[groupKind]; !found {
+			informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &unstructured.Unstructured{}, time.Duration(0),
+				cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if err := addUIDIndexers(groupKind.String(), informer); err != nil {
+				return nil, err
+			}
+			f.customInformers[groupKind] = informer
+			stores[groupKind] = informer.GetStore()
+		}
+		return stores[groupKind], nil
+	}
+	for key, owner := range graph {
+		key = f.canonicalKey(key)
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(key.ApiVersion)
+		obj.SetKind(key.Kind)
+		obj.SetNamespace(key.Namespace)
+		obj.SetName(key.Name)
+		obj.SetUID(graphUID(key))
+		if owner != nil {
+			canonicalOwner := f.canonicalKey(*owner)
+			isController := true
+			obj.SetOwnerReferences([]metav1.OwnerReference{{
+				APIVersion: canonicalOwner.ApiVersion,
+				Kind:       canonicalOwner.Kind,
+				Name:       canonicalOwner.Name,
+				UID:        graphUID(canonicalOwner),
+				Controller: &isController,
+			}})
+			// Owners missing from the graph don't exist, but their kind is known.
+			if _, err := store(canonicalOwner); err != nil {
+				return nil, fmt.Errorf("invalid owner %v of %v: %w", *owner, key, err)
+			}
+		}
+		s, err := store(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid controller %v: %w", key, err)
+		}
+		s.Add(obj)
+	}
+	return f, nil
+}
+
+// graphUID returns the UID of the given controller of the graph, derived from its key so that owner references
+// can refer to it before it's created.
+func graphUID(key ControllerKeyWithAPIVersion) types.UID {
+	return types.UID(fmt.Sprintf("%s/%s/%s/%s", key.ApiVersion, key.Kind, key.Namespace, key.Name))
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphControllerFetcher(t *testing.T) {
+	key := func(apiVersion, kind, namespace, name string) *ControllerKeyWithAPIVersion {
+		return &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{Name: name, Kind: kind, Namespace: namespace}, ApiVersion: apiVersion}
+	}
+	rollout := key("argoproj.io/v1alpha1", "Rollout", "test-namespace", "test-rollout")
+	rs := key("apps/v1", "ReplicaSet", "test-namespace", "test-rs")
+	cycleA := key("apps/v1", "ReplicaSet", "test-namespace", "cycle-a")
+	cycleB := key("example.com/v1", "Widget", "test-namespace", "cycle-b")
+	f, err := NewGraphControllerFetcher(map[ControllerKeyWithAPIVersion]*ControllerKeyWithAPIVersion{
+		*rollout: nil,
+		*rs:      rollout,
+		*key("apps/v1", "ReplicaSet", "test-namespace", "orphan-rs"):    key("apps/v1", "Deployment", "test-namespace", "deleted-deployment"),
+		*key("apps/v1", "ReplicaSet", "other-namespace", "remote-rs"):   rollout,
+		*key("apps.k8s.io/v1", "ReplicaSet", "test-namespace", "alias"): rs,
+		*cycleA: cycleB,
+		*cycleB: cycleA,
+	})
+	assert.NoError(t, err)
+	defer f.Stop()
+
+	testCases := []struct {
+		name     string
+		key      *ControllerKeyWithAPIVersion
+		expected *ControllerKeyWithAPIVersion
+		err      error
+	}{
+		{name: "multiple hops", key: rs, expected: rollout},
+		{name: "top level", key: rollout, expected: rollout},
+		{name: "group alias", key: key("apps/v1", "ReplicaSet", "test-namespace", "alias"), expected: rollout},
+		{name: "kind not in the graph", key: key("batch/v1", "Job", "test-namespace", "test-job"),
+			expected: key("batch/v1", "Job", "test-namespace", "test-job")},
+		{name: "missing controller", key: key("apps/v1", "Deployment", "test-namespace", "missing"), err: ErrControllerNotFound},
+		{name: "missing owner", key: key("apps/v1", "ReplicaSet", "test-namespace", "orphan-rs"), err: ErrControllerNotFound},
+		{name: "owner in another namespace", key: key("apps/v1", "ReplicaSet", "other-namespace", "remote-rs"),
+			err: ErrCrossNamespaceOwner},
+		{name: "cycle", key: cycleA, err: ErrOwnershipCycle},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			topLevel, err := f.FindTopLevelWithContext(context.Background(), tc.key)
+			if tc.err != nil {
+				assert.True(t, errors.Is(err, tc.err), "unexpected error: %v", err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expected, topLevel)
+			}
+		})
+	}
+}
+
+func TestGraphControllerFetcherInvalidGraph(t *testing.T) {
+	valid := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	invalid := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1/extra"}
+
+	_, err := NewGraphControllerFetcher(map[ControllerKeyWithAPIVersion]*ControllerKeyWithAPIVersion{*invalid: nil})
+	assert.Error(t, err)
+	_, err = NewGraphControllerFetcher(map[ControllerKeyWithAPIVersion]*ControllerKeyWithAPIVersion{*valid: invalid})
+	assert.Error(t, err)
+}
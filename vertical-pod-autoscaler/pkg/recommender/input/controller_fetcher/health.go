@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// healthBuckets is the number of buckets the health window is split into.
+	healthBuckets = 10
+	// unhealthyErrorRate is the part of resolutions in the health window which must fail for the fetcher to be
+	// reported unhealthy.
+	unhealthyErrorRate = 0.9
+	// minHealthResolutions is the number of resolutions in the health window below which the fetcher is always
+	// reported healthy, so that a single broken controller doesn't make it unhealthy on a quiet cluster.
+	minHealthResolutions = 10
+)
+
+type healthBucket struct {
+	start       time.Time
+	resolutions int
+	failures    int
+	lastErr     error
+}
+
+// healthTracker counts resolutions and their failures over a sliding window.
+type healthTracker struct {
+	mutex        sync.Mutex
+	window       time.Duration
+	bucketLength time.Duration
+	buckets      [healthBuckets]healthBucket
+}
+
+func newHealthTracker(window time.Duration) *healthTracker {
+	bucketLength := window / healthBuckets
+	if bucketLength <= 0 {
+		bucketLength = 1
+	}
+	return &healthTracker{window: window, bucketLength: bucketLength}
+}
+
+// isFetcherFailure tells whether the resolution error is caused by the fetcher rather than the resolved
+// controller or the caller. Controllers which don't exist or aren't workloads are resolved regularly on healthy
+// clusters.
+func isFetcherFailure(err error) bool {
+	return err != nil && !errors.Is(err, ErrControllerNotFound) && !errors.Is(err, ErrNonWorkloadTarget) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// record records the outcome of a resolution.
+func (t *healthTracker) record(now time.Time, err error) {
+	start := now.Truncate(t.bucketLength)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	bucket := &t.buckets[(start.UnixNano()/int64(t.bucketLength))%healthBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = healthBucket{start: start}
+	}
+	bucket.resolutions++
+	if isFetcherFailure(err) {
+		bucket.failures++
+		bucket.lastErr = err
+	}
+}
+
+// healthy tells whether the part of resolutions failing in the window ending now is below unhealthyErrorRate,
+// together with the reason if it isn't.
+func (t *healthTracker) healthy(now time.Time) (bool, string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	windowStart := now.Add(-t.window)
+	var resolutions, failures int
+	var last *healthBucket
+	for i := range t.buckets {
+		bucket := &t.buckets[i]
+		if bucket.start.Before(windowStart) || bucket.start.After(now) {
+			continue
+		}
+		resolutions += bucket.resolutions
+		failures += bucket.failures
+		if bucket.lastErr != nil && (last == nil || bucket.start.After(last.start)) {
+			last = bucket
+		}
+	}
+	if resolutions < minHealthResolutions || float64(failures) < unhealthyErrorRate*float64(resolutions) {
+		return true, ""
+	}
+	return false, fmt.Sprintf("%d of %d controller resolutions failed in the last %v, last error: %v",
+		failures, resolutions, t.window, last.lastErr)
+}
+
+func (f *controllerFetcher) Healthy() (bool, string) {
+	if f.health == nil {
+		return true, ""
+	}
+	return f.health.healthy(time.Now())
+}
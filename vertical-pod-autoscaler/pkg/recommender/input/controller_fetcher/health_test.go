@@ -0,0 +1,83 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+)
+
+func TestHealthTracker(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newHealthTracker(time.Minute)
+	forbidden := fmt.Errorf("deployments.apps is forbidden")
+
+	healthy, reason := tracker.healthy(now)
+	assert.True(t, healthy)
+	assert.Empty(t, reason)
+
+	// Too few resolutions to tell.
+	for i := 0; i < minHealthResolutions-1; i++ {
+		tracker.record(now, forbidden)
+	}
+	healthy, _ = tracker.healthy(now)
+	assert.True(t, healthy)
+
+	tracker.record(now.Add(time.Second), forbidden)
+	healthy, reason = tracker.healthy(now.Add(time.Second))
+	assert.False(t, healthy)
+	assert.Equal(t, "10 of 10 controller resolutions failed in the last 1m0s, last error: deployments.apps is forbidden", reason)
+
+	// Missing controllers and canceled resolutions aren't failures of the fetcher.
+	tracker.record(now.Add(2*time.Second), fmt.Errorf("Deployment ns/name %w", ErrControllerNotFound))
+	tracker.record(now.Add(2*time.Second), context.Canceled)
+	healthy, _ = tracker.healthy(now.Add(2 * time.Second))
+	assert.True(t, healthy)
+
+	// Failures outside of the window are forgotten.
+	healthy, _ = tracker.healthy(now.Add(2 * time.Minute))
+	assert.True(t, healthy)
+	for i := 0; i < minHealthResolutions; i++ {
+		tracker.record(now.Add(2*time.Minute), nil)
+	}
+	healthy, _ = tracker.healthy(now.Add(2 * time.Minute))
+	assert.True(t, healthy)
+}
+
+func TestControllerFetcherHealthy(t *testing.T) {
+	f := simpleControllerFetcher()
+	healthy, reason := f.Healthy()
+	assert.True(t, healthy)
+	assert.Empty(t, reason)
+
+	// The RESTMapper doesn't know Widgets.
+	f.mapper = apimeta.NewDefaultRESTMapper(nil)
+	f.health = newHealthTracker(time.Minute)
+	for i := 0; i < minHealthResolutions; i++ {
+		_, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: fmt.Sprintf("widget-%d", i), Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"})
+		assert.Error(t, err)
+	}
+	healthy, reason = f.Healthy()
+	assert.False(t, healthy)
+	assert.Contains(t, reason, "10 of 10 controller resolutions failed")
+}
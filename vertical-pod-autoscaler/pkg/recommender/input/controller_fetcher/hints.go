@@ -0,0 +1,50 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+)
+
+// hintedOwner returns the given owner of the given controller as is, if Options.ResolutionHints says owners of
+// the controller's kind are of the owner's kind, instead of canonicalizing it with the RESTMapper. Owners of
+// well-known kinds get the version their informers watch. It returns false if there's no hint or the owner
+// doesn't match it, in which case the owner is canonicalized as usual.
+func (f *controllerFetcher) hintedOwner(key, owner ControllerKeyWithAPIVersion) (ControllerKeyWithAPIVersion, bool) {
+	if len(f.resolutionHints) == 0 {
+		return owner, false
+	}
+	groupVersion, err := schema.ParseGroupVersion(key.ApiVersion)
+	if err != nil {
+		return owner, false
+	}
+	hint, found := f.resolutionHints[schema.GroupKind{Group: groupVersion.Group, Kind: key.Kind}]
+	if !found {
+		return owner, false
+	}
+	ownerGroupVersion, err := schema.ParseGroupVersion(owner.ApiVersion)
+	if err != nil || owner.Kind != hint.Kind || ownerGroupVersion.Group != hint.Group {
+		klog.V(4).Infof("Owner %s %s/%s of %s %s/%s doesn't match the hinted %s", owner.Kind, owner.Namespace, owner.Name,
+			key.Kind, key.Namespace, key.Name, hint)
+		return owner, false
+	}
+	if isWellKnownGroupKind(hint) {
+		owner.ApiVersion = wellKnownControllerGroupVersions[wellKnownController(hint.Kind)]
+	}
+	return owner, true
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// recordingRESTMapper records the groups of the kinds and resources the underlying mapper is asked about.
+type recordingRESTMapper struct {
+	apimeta.RESTMapper
+	groups map[string]int
+}
+
+func (m *recordingRESTMapper) KindFor(resource schema.GroupVersionResource) (schema.GroupVersionKind, error) {
+	m.groups[resource.Group]++
+	return m.RESTMapper.KindFor(resource)
+}
+
+func (m *recordingRESTMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*apimeta.RESTMapping, error) {
+	m.groups[gk.Group]++
+	return m.RESTMapper.RESTMapping(gk, versions...)
+}
+
+func (m *recordingRESTMapper) RESTMappings(gk schema.GroupKind, versions ...string) ([]*apimeta.RESTMapping, error) {
+	m.groups[gk.Group]++
+	return m.RESTMapper.RESTMappings(gk, versions...)
+}
+
+func TestResolutionHints(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	defaultMapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion(), appsv1.SchemeGroupVersion})
+	defaultMapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	defaultMapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), apimeta.RESTScopeNamespace)
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "widgets"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-widget",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", Controller: &trueVar},
+			},
+		},
+	})
+	widgetKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	deploymentKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+
+	testCases := []struct {
+		name                   string
+		hints                  map[schema.GroupKind]schema.GroupKind
+		expectedDiscoveryCalls bool
+	}{
+		{
+			name:                   "no hints",
+			expectedDiscoveryCalls: true,
+		},
+		{
+			name:  "hinted",
+			hints: map[schema.GroupKind]schema.GroupKind{widgetKind.GroupKind(): {Group: "apps", Kind: "Deployment"}},
+		},
+		{
+			name:                   "owner not matching the hint",
+			hints:                  map[schema.GroupKind]schema.GroupKind{widgetKind.GroupKind(): {Group: "apps", Kind: "StatefulSet"}},
+			expectedDiscoveryCalls: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mapper := &recordingRESTMapper{RESTMapper: defaultMapper, groups: make(map[string]int)}
+			f := simpleControllerFetcher()
+			f.mapper = mapper
+			f.scaleNamespacer = scales
+			f.resolutionHints = tc.hints
+			addController(f, &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+			})
+			topLevel, err := f.FindTopLevel(widgetKey)
+			assert.NoError(t, err)
+			assert.Equal(t, deploymentKey, topLevel)
+			// The Widget itself is always mapped, to read its scale subresource.
+			assert.NotZero(t, mapper.groups["example.com"])
+			assert.Equal(t, tc.expectedDiscoveryCalls, mapper.groups["apps"] > 0, "discovery calls of apps: %d", mapper.groups["apps"])
+		})
+	}
+}
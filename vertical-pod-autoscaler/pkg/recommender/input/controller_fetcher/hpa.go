@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// hpaScaleTargetIndex indexes HorizontalPodAutoscalers by their scale targets.
+const hpaScaleTargetIndex = "controllerfetcher/hpaScaleTarget"
+
+// scaleTargetIndexKey returns the key of the given controller in hpaScaleTargetIndex. Versions are left out,
+// so that HPAs referring to the controller in another version than the one it was resolved in match.
+func scaleTargetIndexKey(namespace, apiVersion, kind, name string) string {
+	groupVersion, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		groupVersion = schema.GroupVersion{}
+	}
+	return fmt.Sprintf("%s/%s/%s", namespace, schema.GroupKind{Group: groupVersion.Group, Kind: kind}, name)
+}
+
+func indexByScaleTarget(obj interface{}) ([]string, error) {
+	hpa, ok := obj.(*autoscalingv2beta1.HorizontalPodAutoscaler)
+	if !ok {
+		return nil, nil
+	}
+	target := hpa.Spec.ScaleTargetRef
+	return []string{scaleTargetIndexKey(hpa.Namespace, target.APIVersion, target.Kind, target.Name)}, nil
+}
+
+// addScaleTargetIndexer adds the indexer FindTopLevelWithHPA needs to the HPA informer. It must be called
+// before the informer is started.
+func addScaleTargetIndexer(informer cache.SharedIndexInformer) {
+	err := informer.AddIndexers(cache.Indexers{hpaScaleTargetIndex: indexByScaleTarget})
+	if err != nil {
+		klog.Warningf("Could not add the scale target indexer to the HorizontalPodAutoscaler informer: %v", err)
+	}
+}
+
+func (f *controllerFetcher) FindTopLevelWithHPA(ctx context.Context, key *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, *autoscalingv2beta1.HorizontalPodAutoscaler, error) {
+	if f.hpaInformer == nil {
+		if key != nil {
+			f.notifyAnswered(ctx, f.canonicalKey(*key), nil, ErrHPAInformerDisabled)
+		}
+		return nil, nil, ErrHPAInformerDisabled
+	}
+	result, err := f.findTopLevelDetailed(ctx, key)
+	if err != nil || result == nil {
+		return nil, nil, err
+	}
+	// HPAs refer to the real name of the controller.
+	topLevel := result.TopLevel
+	hpas, err := f.hpasTargeting(topLevel)
+	if err != nil || len(hpas) == 0 {
+		return f.transformKey(topLevel), nil, err
+	}
+	// Several HPAs targeting the same controller fight each other anyway, return the same one every time.
+	return f.transformKey(topLevel), hpas[0], nil
+}
+
+func (f *controllerFetcher) HPAsTargeting(ctx context.Context, key *ControllerKeyWithAPIVersion) ([]*autoscalingv2beta1.HorizontalPodAutoscaler, error) {
+	if f.hpaInformer == nil {
+		return nil, ErrHPAInformerDisabled
+	}
+	if key == nil {
+		return nil, nil
+	}
+	canonical := f.canonicalKey(*key)
+	return f.hpasTargeting(&canonical)
+}
+
+// hpasTargeting returns the HPAs whose scale target is the given controller, sorted by name.
+func (f *controllerFetcher) hpasTargeting(key *ControllerKeyWithAPIVersion) ([]*autoscalingv2beta1.HorizontalPodAutoscaler, error) {
+	objs, err := f.hpaInformer.GetIndexer().ByIndex(hpaScaleTargetIndex,
+		scaleTargetIndexKey(key.Namespace, key.ApiVersion, key.Kind, key.Name))
+	if err != nil {
+		return nil, err
+	}
+	var hpas []*autoscalingv2beta1.HorizontalPodAutoscaler
+	for _, obj := range objs {
+		if hpa, ok := obj.(*autoscalingv2beta1.HorizontalPodAutoscaler); ok {
+			hpas = append(hpas, hpa)
+		}
+	}
+	sort.Slice(hpas, func(i, j int) bool { return hpas[i].Name < hpas[j].Name })
+	return hpas, nil
+}
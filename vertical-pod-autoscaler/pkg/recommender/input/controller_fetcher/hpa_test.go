@@ -0,0 +1,128 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newHPA(namespace, name string, target autoscalingv2beta1.CrossVersionObjectReference) *autoscalingv2beta1.HorizontalPodAutoscaler {
+	return &autoscalingv2beta1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       autoscalingv2beta1.HorizontalPodAutoscalerSpec{ScaleTargetRef: target},
+	}
+}
+
+func TestFindTopLevelWithHPA(t *testing.T) {
+	f := simpleControllerFetcher()
+	rsKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	_, _, err := f.FindTopLevelWithHPA(context.Background(), rsKey)
+	assert.True(t, errors.Is(err, ErrHPAInformerDisabled), "unexpected error: %v", err)
+
+	f.hpaInformer = cache.NewSharedIndexInformer(&cache.ListWatch{}, &autoscalingv2beta1.HorizontalPodAutoscaler{},
+		time.Duration(-1), cache.Indexers{})
+	addScaleTargetIndexer(f.hpaInformer)
+	for _, name := range []string{"test-deployment", "other-deployment"} {
+		addController(f, &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+		})
+	}
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", Controller: &trueVar},
+			},
+		},
+	})
+	deploymentTarget := autoscalingv2beta1.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment"}
+	store := f.hpaInformer.GetStore()
+	// HPAs targeting the Deployment in another namespace, or the ReplicaSet itself, don't scale the top level controller.
+	store.Add(newHPA("other-namespace", "test-hpa", deploymentTarget))
+	store.Add(newHPA("test-namespace", "rs-hpa", autoscalingv2beta1.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "test-rs"}))
+
+	topLevel, hpa, err := f.FindTopLevelWithHPA(context.Background(), rsKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-deployment", topLevel.Name)
+	assert.Nil(t, hpa)
+
+	// HPAs referring to the Deployment in a deprecated version match too.
+	store.Add(newHPA("test-namespace", "test-hpa", autoscalingv2beta1.CrossVersionObjectReference{
+		APIVersion: "apps/v1beta2", Kind: "Deployment", Name: "test-deployment"}))
+	store.Add(newHPA("test-namespace", "another-hpa", deploymentTarget))
+	topLevel, hpa, err = f.FindTopLevelWithHPA(context.Background(), rsKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-deployment", topLevel.Name)
+	if assert.NotNil(t, hpa) {
+		assert.Equal(t, "another-hpa", hpa.Name)
+	}
+
+	_, hpa, err = f.FindTopLevelWithHPA(context.Background(), &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "other-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"})
+	assert.NoError(t, err)
+	assert.Nil(t, hpa)
+}
+
+func TestHPAsTargeting(t *testing.T) {
+	f := simpleControllerFetcher()
+	deploymentKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	_, err := f.HPAsTargeting(context.Background(), deploymentKey)
+	assert.True(t, errors.Is(err, ErrHPAInformerDisabled), "unexpected error: %v", err)
+
+	f.hpaInformer = cache.NewSharedIndexInformer(&cache.ListWatch{}, &autoscalingv2beta1.HorizontalPodAutoscaler{},
+		time.Duration(-1), cache.Indexers{})
+	addScaleTargetIndexer(f.hpaInformer)
+	store := f.hpaInformer.GetStore()
+	store.Add(newHPA("test-namespace", "test-hpa", autoscalingv2beta1.CrossVersionObjectReference{
+		APIVersion: "apps/v1beta2", Kind: "Deployment", Name: "test-deployment"}))
+	store.Add(newHPA("test-namespace", "another-hpa", autoscalingv2beta1.CrossVersionObjectReference{
+		APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment"}))
+	store.Add(newHPA("other-namespace", "other-hpa", autoscalingv2beta1.CrossVersionObjectReference{
+		APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment"}))
+	// A custom resource of the same Kind in another group is another target.
+	store.Add(newHPA("test-namespace", "custom-hpa", autoscalingv2beta1.CrossVersionObjectReference{
+		APIVersion: "example.com/v1", Kind: "Deployment", Name: "test-deployment"}))
+
+	// The controller isn't resolved, it doesn't even need to exist.
+	hpas, err := f.HPAsTargeting(context.Background(), deploymentKey)
+	assert.NoError(t, err)
+	var names []string
+	for _, hpa := range hpas {
+		names = append(names, hpa.Name)
+	}
+	assert.Equal(t, []string{"another-hpa", "test-hpa"}, names)
+
+	hpas, err = f.HPAsTargeting(context.Background(), &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "other-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"})
+	assert.NoError(t, err)
+	assert.Empty(t, hpas)
+}
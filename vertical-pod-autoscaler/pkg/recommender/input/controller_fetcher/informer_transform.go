@@ -0,0 +1,222 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	kube_client "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TransformFunc is applied to objects before they enter informers of the fetcher, see Options.InformerTransform.
+// It mirrors cache.TransformFunc of newer client versions, which this one lacks. It may modify the object in
+// place and must return a runtime.Object.
+type TransformFunc func(obj interface{}) (interface{}, error)
+
+// StripUnusedFields is a TransformFunc dropping the fields of controllers the fetcher never reads which take
+// the most memory: the kubectl.kubernetes.io/last-applied-configuration annotation, which holds a copy of the
+// whole object as last applied, and managedFields. Typed objects of this client version don't carry
+// managedFields at all, they're only dropped from unstructured objects.
+func StripUnusedFields(obj interface{}) (interface{}, error) {
+	obj, err := stripLastAppliedConfiguration(obj)
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		unstructured.RemoveNestedField(u.Object, "metadata", "managedFields")
+	}
+	return obj, nil
+}
+
+// stripLastAppliedConfiguration is StripUnusedFields keeping managedFields, for
+// Options.InferOwnersFromManagedFields.
+func stripLastAppliedConfiguration(obj interface{}) (interface{}, error) {
+	accessor, err := apimeta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	if annotations := accessor.GetAnnotations(); annotations[corev1.LastAppliedConfigAnnotation] != "" {
+		delete(annotations, corev1.LastAppliedConfigAnnotation)
+		accessor.SetAnnotations(annotations)
+	}
+	return obj, nil
+}
+
+// transformingListerWatcher applies a transform to every object listed or watched.
+type transformingListerWatcher struct {
+	cache.ListerWatcher
+	transform TransformFunc
+}
+
+func newTransformingListerWatcher(lw cache.ListerWatcher, transform TransformFunc) cache.ListerWatcher {
+	return &transformingListerWatcher{ListerWatcher: lw, transform: transform}
+}
+
+func (lw *transformingListerWatcher) List(options metav1.ListOptions) (runtime.Object, error) {
+	list, err := lw.ListerWatcher.List(options)
+	if err != nil {
+		return nil, err
+	}
+	items, err := apimeta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		if items[i], err = lw.transformObject(items[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := apimeta.SetList(list, items); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (lw *transformingListerWatcher) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := lw.ListerWatcher.Watch(options)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		if event.Type == watch.Error {
+			return event, true
+		}
+		// Objects of watch events may be shared with other watchers, as with fake clients, so transforms get a
+		// copy they're free to modify.
+		obj, err := lw.transformObject(event.Object.DeepCopyObject())
+		if err != nil {
+			// The informer restarts its watch on errors, reading the event again.
+			return watch.Event{Type: watch.Error, Object: &metav1.Status{
+				Status: metav1.StatusFailure, Message: err.Error()}}, true
+		}
+		event.Object = obj
+		return event, true
+	}), nil
+}
+
+func (lw *transformingListerWatcher) transformObject(obj runtime.Object) (runtime.Object, error) {
+	transformed, err := lw.transform(obj)
+	if err != nil {
+		return nil, err
+	}
+	result, ok := transformed.(runtime.Object)
+	if !ok {
+		return nil, fmt.Errorf("informer transform returned %T, not a runtime.Object", transformed)
+	}
+	return result, nil
+}
+
+// newInformerFunc creates an informer listing and watching with the given client, resyncing with the given period.
+// It's assignable to the constructors factories take in InformerFor.
+type newInformerFunc func(client kube_client.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer
+
+// wellKnownControllerObjects are objects of each well-known controller, factories key their informers by
+// their types.
+var wellKnownControllerObjects = map[wellKnownController]runtime.Object{
+	daemonSet:             &appsv1.DaemonSet{},
+	deployment:            &appsv1.Deployment{},
+	replicaSet:            &appsv1.ReplicaSet{},
+	statefulSet:           &appsv1.StatefulSet{},
+	replicationController: &corev1.ReplicationController{},
+	job:                   &batchv1.Job{},
+}
+
+// newTransformingInformers returns constructors of informers of well-known controllers holding only
+// controllers matching the given selectors, which may be nil, with transform applied. Their list and watch
+// errors are recorded in the trackers of their kinds.
+func newTransformingInformers(labelSelector labels.Selector, fieldSelector fields.Selector, transform TransformFunc,
+	trackers map[wellKnownController]*informerErrors) map[wellKnownController]newInformerFunc {
+	tweak := func(options metav1.ListOptions) metav1.ListOptions {
+		if labelSelector != nil {
+			options.LabelSelector = labelSelector.String()
+		}
+		if fieldSelector != nil {
+			options.FieldSelector = fieldSelector.String()
+		}
+		return options
+	}
+	newInformer := func(kind wellKnownController, listFunc func(kube_client.Interface, metav1.ListOptions) (runtime.Object, error),
+		watchFunc func(kube_client.Interface, metav1.ListOptions) (watch.Interface, error)) newInformerFunc {
+		return func(client kube_client.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+			lw := newTransformingListerWatcher(&cache.ListWatch{
+				ListFunc:  func(options metav1.ListOptions) (runtime.Object, error) { return listFunc(client, tweak(options)) },
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) { return watchFunc(client, tweak(options)) },
+			}, transform)
+			if tracker, found := trackers[kind]; found {
+				lw = newErrorRecordingListerWatcher(lw, tracker)
+			}
+			return cache.NewSharedIndexInformer(lw, wellKnownControllerObjects[kind], resyncPeriod,
+				cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		}
+	}
+	return map[wellKnownController]newInformerFunc{
+		daemonSet: newInformer(daemonSet,
+			func(client kube_client.Interface, options metav1.ListOptions) (runtime.Object, error) {
+				return client.AppsV1().DaemonSets(metav1.NamespaceAll).List(options)
+			},
+			func(client kube_client.Interface, options metav1.ListOptions) (watch.Interface, error) {
+				return client.AppsV1().DaemonSets(metav1.NamespaceAll).Watch(options)
+			}),
+		deployment: newInformer(deployment,
+			func(client kube_client.Interface, options metav1.ListOptions) (runtime.Object, error) {
+				return client.AppsV1().Deployments(metav1.NamespaceAll).List(options)
+			},
+			func(client kube_client.Interface, options metav1.ListOptions) (watch.Interface, error) {
+				return client.AppsV1().Deployments(metav1.NamespaceAll).Watch(options)
+			}),
+		replicaSet: newInformer(replicaSet,
+			func(client kube_client.Interface, options metav1.ListOptions) (runtime.Object, error) {
+				return client.AppsV1().ReplicaSets(metav1.NamespaceAll).List(options)
+			},
+			func(client kube_client.Interface, options metav1.ListOptions) (watch.Interface, error) {
+				return client.AppsV1().ReplicaSets(metav1.NamespaceAll).Watch(options)
+			}),
+		statefulSet: newInformer(statefulSet,
+			func(client kube_client.Interface, options metav1.ListOptions) (runtime.Object, error) {
+				return client.AppsV1().StatefulSets(metav1.NamespaceAll).List(options)
+			},
+			func(client kube_client.Interface, options metav1.ListOptions) (watch.Interface, error) {
+				return client.AppsV1().StatefulSets(metav1.NamespaceAll).Watch(options)
+			}),
+		replicationController: newInformer(replicationController,
+			func(client kube_client.Interface, options metav1.ListOptions) (runtime.Object, error) {
+				return client.CoreV1().ReplicationControllers(metav1.NamespaceAll).List(options)
+			},
+			func(client kube_client.Interface, options metav1.ListOptions) (watch.Interface, error) {
+				return client.CoreV1().ReplicationControllers(metav1.NamespaceAll).Watch(options)
+			}),
+		job: newInformer(job,
+			func(client kube_client.Interface, options metav1.ListOptions) (runtime.Object, error) {
+				return client.BatchV1().Jobs(metav1.NamespaceAll).List(options)
+			},
+			func(client kube_client.Interface, options metav1.ListOptions) (watch.Interface, error) {
+				return client.BatchV1().Jobs(metav1.NamespaceAll).Watch(options)
+			}),
+	}
+}
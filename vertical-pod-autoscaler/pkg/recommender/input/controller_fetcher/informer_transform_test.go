@@ -0,0 +1,133 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStripUnusedFields(t *testing.T) {
+	annotations := map[string]string{corev1.LastAppliedConfigAnnotation: "{}", "other": "kept"}
+	obj, err := StripUnusedFields(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Annotations: annotations}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"other": "kept"}, obj.(*appsv1.Deployment).Annotations)
+
+	u := newUnstructured("apps/v1", "Deployment", "test-namespace", "test-deployment")
+	u.SetAnnotations(map[string]string{corev1.LastAppliedConfigAnnotation: "{}"})
+	assert.NoError(t, unstructured.SetNestedSlice(u.Object, []interface{}{map[string]interface{}{"manager": "kubectl"}},
+		"metadata", "managedFields"))
+	obj, err = StripUnusedFields(u)
+	assert.NoError(t, err)
+	assert.Empty(t, obj.(*unstructured.Unstructured).GetAnnotations())
+	_, found, _ := unstructured.NestedSlice(u.Object, "metadata", "managedFields")
+	assert.False(t, found)
+
+	// managedFields are kept when inferring owners from them.
+	assert.NoError(t, unstructured.SetNestedSlice(u.Object, []interface{}{map[string]interface{}{"manager": "kubectl"}},
+		"metadata", "managedFields"))
+	_, err = stripLastAppliedConfiguration(u)
+	assert.NoError(t, err)
+	_, found, _ = unstructured.NestedSlice(u.Object, "metadata", "managedFields")
+	assert.True(t, found)
+}
+
+func TestInformerTransform(t *testing.T) {
+	newDeployment := func(name string) *appsv1.Deployment {
+		return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "test-namespace",
+			Labels:      map[string]string{"vpa": "enabled"},
+			Annotations: map[string]string{corev1.LastAppliedConfigAnnotation: "{}"},
+		}}
+	}
+	listed := func(f ExtendedControllerFetcher, name string) (*appsv1.Deployment, bool) {
+		obj, exists, _ := f.(*controllerFetcher).informersMap[deployment].GetStore().GetByKey("test-namespace/" + name)
+		if !exists {
+			return nil, false
+		}
+		return obj.(*appsv1.Deployment), true
+	}
+
+	// Informers of the fetcher's own strip unused fields by default, both from lists and watches.
+	kubeClient := fake.NewSimpleClientset(newDeployment("listed"))
+	f := NewControllerFetcherWithClients(kubeClient.Discovery(), kubeClient, informers.NewSharedInformerFactory(kubeClient, 0), Options{
+		InformerLabelSelector: labels.SelectorFromSet(labels.Set{"vpa": "enabled"}),
+	})
+	defer f.Stop()
+	if d, found := listed(f, "listed"); assert.True(t, found) {
+		assert.Empty(t, d.Annotations)
+	}
+	_, err := kubeClient.AppsV1().Deployments("test-namespace").Create(newDeployment("watched"))
+	assert.NoError(t, err)
+	assert.NoError(t, wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		_, found := listed(f, "watched")
+		return found, nil
+	}))
+	if d, found := listed(f, "watched"); assert.True(t, found) {
+		assert.Empty(t, d.Annotations)
+	}
+
+	// Without selectors, as in fetchers created by NewControllerFetcher, the transformed informers are
+	// registered in the factory and shared with its other users.
+	kubeClient = fake.NewSimpleClientset(newDeployment("listed"))
+	factory := informers.NewSharedInformerFactory(kubeClient, 0)
+	f = NewControllerFetcherWithClients(kubeClient.Discovery(), kubeClient, factory, Options{})
+	defer f.Stop()
+	if d, found := listed(f, "listed"); assert.True(t, found) {
+		assert.Empty(t, d.Annotations)
+	}
+	assert.Equal(t, factory.Apps().V1().Deployments().Informer(), f.(*controllerFetcher).informersMap[deployment])
+
+	// Informers other users created in the factory first are shared as they are.
+	kubeClient = fake.NewSimpleClientset(newDeployment("listed"))
+	factory = informers.NewSharedInformerFactory(kubeClient, 0)
+	factoryInformer := factory.Apps().V1().Deployments().Informer()
+	f = NewControllerFetcherWithClients(kubeClient.Discovery(), kubeClient, factory, Options{})
+	defer f.Stop()
+	if d, found := listed(f, "listed"); assert.True(t, found) {
+		assert.Equal(t, map[string]string{corev1.LastAppliedConfigAnnotation: "{}"}, d.Annotations)
+	}
+	assert.Equal(t, factoryInformer, f.(*controllerFetcher).informersMap[deployment])
+
+	// With OwnInformers, the factory's informers are left alone.
+	kubeClient = fake.NewSimpleClientset(newDeployment("listed"))
+	factory = informers.NewSharedInformerFactory(kubeClient, 0)
+	f = NewControllerFetcherWithClients(kubeClient.Discovery(), kubeClient, factory, Options{
+		OwnInformers: true,
+		InformerTransform: func(obj interface{}) (interface{}, error) {
+			obj.(*appsv1.Deployment).Annotations["transformed"] = "true"
+			return obj, nil
+		},
+	})
+	defer f.Stop()
+	if d, found := listed(f, "listed"); assert.True(t, found) {
+		assert.Equal(t, map[string]string{corev1.LastAppliedConfigAnnotation: "{}", "transformed": "true"}, d.Annotations)
+	}
+	assert.NotEqual(t, factory.Apps().V1().Deployments().Informer(), f.(*controllerFetcher).informersMap[deployment])
+}
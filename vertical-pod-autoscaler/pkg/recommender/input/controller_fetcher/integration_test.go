@@ -0,0 +1,252 @@
+//go:build integration
+// +build integration
+
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	kube_client "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// The integration test resolves owner chains created in a real cluster, e.g. one started with kind, through
+// the real discovery, scale and dynamic clients. Run it with
+//
+//	KUBECONFIG=$HOME/.kube/config go test -tags integration -run TestIntegration ./pkg/recommender/input/controller_fetcher/
+//
+// It creates a CRD and a namespace, which are deleted when it's done.
+
+const (
+	integrationPollInterval = time.Second
+	integrationTimeout      = 2 * time.Minute
+	integrationGroup        = "fetcher-test.example.com"
+	integrationImage        = "registry.k8s.io/pause:3.9"
+)
+
+var (
+	widgetsResource = schema.GroupVersionResource{Group: integrationGroup, Version: "v1", Resource: "widgets"}
+	crdsResource    = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	cronJobsV1      = schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"}
+)
+
+func TestIntegrationFindTopLevel(t *testing.T) {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	if kubeconfig == "" {
+		t.Skip("KUBECONFIG isn't set")
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	requireNoError(t, err)
+	kubeClient := kube_client.NewForConfigOrDie(config)
+	dynamicClient := dynamic.NewForConfigOrDie(config)
+
+	namespace, err := kubeClient.CoreV1().Namespaces().Create(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "controller-fetcher-"}})
+	requireNoError(t, err)
+	defer kubeClient.CoreV1().Namespaces().Delete(namespace.Name, &metav1.DeleteOptions{})
+	createWidgetCRD(t, kubeClient, dynamicClient)
+	defer dynamicClient.Resource(crdsResource).Delete("widgets."+integrationGroup, &metav1.DeleteOptions{})
+
+	factory := informers.NewSharedInformerFactory(kubeClient, 0)
+	f := NewControllerFetcherWithOptions(config, kubeClient, factory, Options{
+		// CronJobs have no scale subresource.
+		TerminalKinds: []schema.GroupKind{{Group: "batch", Kind: "CronJob"}},
+	})
+	defer f.Stop()
+	ns := namespace.Name
+
+	t.Run("Deployment", func(t *testing.T) {
+		deploymentClient := kubeClient.AppsV1().Deployments(ns)
+		_, err := deploymentClient.Create(newIntegrationDeployment("test-deployment", 1))
+		requireNoError(t, err)
+		var pod *corev1.Pod
+		requireNoError(t, wait.PollImmediate(integrationPollInterval, integrationTimeout, func() (bool, error) {
+			pods, err := kubeClient.CoreV1().Pods(ns).List(metav1.ListOptions{
+				LabelSelector: labels.SelectorFromSet(labels.Set{"app": "test-deployment"}).String()})
+			if err != nil || len(pods.Items) == 0 {
+				return false, err
+			}
+			pod = &pods.Items[0]
+			return true, nil
+		}), "no Pod of the Deployment")
+		expected := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Namespace: ns, Kind: "Deployment", Name: "test-deployment"}, ApiVersion: "apps/v1"}
+		assertResolvesTo(t, expected, func() (*ControllerKeyWithAPIVersion, error) {
+			return f.FindTopLevelForPod(context.Background(), pod)
+		})
+	})
+
+	t.Run("CronJob", func(t *testing.T) {
+		cronJob := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "batch/v1",
+			"kind":       "CronJob",
+			"metadata":   map[string]interface{}{"name": "test-cronjob", "namespace": ns},
+			"spec": map[string]interface{}{
+				"schedule": "0 0 1 1 *",
+				"suspend":  true,
+				"jobTemplate": map[string]interface{}{"spec": map[string]interface{}{
+					"template": integrationJobTemplate("test-cronjob"),
+				}},
+			},
+		}}
+		cronJob, err := dynamicClient.Resource(cronJobsV1).Namespace(ns).Create(cronJob, metav1.CreateOptions{})
+		requireNoError(t, err)
+		// The Job is created as the CronJob controller would have, so that the test doesn't wait for a schedule.
+		// It runs no Pods.
+		parallelism := int32(0)
+		template := corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "test-cronjob"}},
+			Spec: corev1.PodSpec{
+				RestartPolicy: corev1.RestartPolicyNever,
+				Containers:    []corev1.Container{{Name: "pause", Image: integrationImage}},
+			},
+		}
+		_, err = kubeClient.BatchV1().Jobs(ns).Create(&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-cronjob-1",
+				Namespace: ns,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "batch/v1", Kind: "CronJob", Name: cronJob.GetName(), UID: cronJob.GetUID(), Controller: &trueVar,
+				}},
+			},
+			Spec: batchv1.JobSpec{Parallelism: &parallelism, Template: template},
+		})
+		requireNoError(t, err)
+		key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Namespace: ns, Kind: "Job", Name: "test-cronjob-1"}, ApiVersion: "batch/v1"}
+		expected := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Namespace: ns, Kind: "CronJob", Name: "test-cronjob"}, ApiVersion: "batch/v1"}
+		assertResolvesTo(t, expected, func() (*ControllerKeyWithAPIVersion, error) { return f.FindTopLevel(key) })
+	})
+
+	t.Run("scalable CRD", func(t *testing.T) {
+		widget := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": integrationGroup + "/v1",
+			"kind":       "Widget",
+			"metadata":   map[string]interface{}{"name": "test-widget", "namespace": ns},
+			"spec":       map[string]interface{}{"replicas": int64(0)},
+		}}
+		widget, err := dynamicClient.Resource(widgetsResource).Namespace(ns).Create(widget, metav1.CreateOptions{})
+		requireNoError(t, err)
+		deployment := newIntegrationDeployment("test-widget-deployment", 0)
+		deployment.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: widget.GetAPIVersion(), Kind: "Widget", Name: widget.GetName(), UID: widget.GetUID(), Controller: &trueVar,
+		}}
+		_, err = kubeClient.AppsV1().Deployments(ns).Create(deployment)
+		requireNoError(t, err)
+		key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Namespace: ns, Kind: "Deployment", Name: "test-widget-deployment"}, ApiVersion: "apps/v1"}
+		expected := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Namespace: ns, Kind: "Widget", Name: "test-widget"}, ApiVersion: integrationGroup + "/v1"}
+		assertResolvesTo(t, expected, func() (*ControllerKeyWithAPIVersion, error) { return f.FindTopLevel(key) })
+	})
+}
+
+// assertResolvesTo polls resolve until it returns the expected top level controller, since informers observe
+// the controllers created by the test with a delay.
+func assertResolvesTo(t *testing.T, expected *ControllerKeyWithAPIVersion, resolve func() (*ControllerKeyWithAPIVersion, error)) {
+	var topLevel *ControllerKeyWithAPIVersion
+	var err error
+	pollErr := wait.PollImmediate(integrationPollInterval, integrationTimeout, func() (bool, error) {
+		topLevel, err = resolve()
+		return err == nil, nil
+	})
+	if assert.NoError(t, pollErr, "last error: %v", err) {
+		assert.Equal(t, expected, topLevel)
+	}
+}
+
+// createWidgetCRD creates the Widget CRD, which has a scale subresource, and waits until it's served.
+func createWidgetCRD(t *testing.T, kubeClient kube_client.Interface, dynamicClient dynamic.Interface) {
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "widgets." + integrationGroup},
+		"spec": map[string]interface{}{
+			"group": integrationGroup,
+			"scope": "Namespaced",
+			"names": map[string]interface{}{"kind": "Widget", "plural": "widgets", "singular": "widget"},
+			"versions": []interface{}{map[string]interface{}{
+				"name":    "v1",
+				"served":  true,
+				"storage": true,
+				"schema": map[string]interface{}{"openAPIV3Schema": map[string]interface{}{
+					"type": "object", "x-kubernetes-preserve-unknown-fields": true,
+				}},
+				"subresources": map[string]interface{}{"scale": map[string]interface{}{
+					"specReplicasPath":   ".spec.replicas",
+					"statusReplicasPath": ".status.replicas",
+				}},
+			}},
+		},
+	}}
+	_, err := dynamicClient.Resource(crdsResource).Create(crd, metav1.CreateOptions{})
+	requireNoError(t, err)
+	requireNoError(t, wait.PollImmediate(integrationPollInterval, integrationTimeout, func() (bool, error) {
+		_, err := kubeClient.Discovery().ServerResourcesForGroupVersion(integrationGroup + "/v1")
+		return err == nil, nil
+	}), "Widget CRD isn't served")
+}
+
+func newIntegrationDeployment(name string, replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "pause", Image: integrationImage}}},
+			},
+		},
+	}
+}
+
+// integrationJobTemplate is the Pod template of Jobs, as an unstructured object for CronJobs.
+func integrationJobTemplate(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": name}},
+		"spec": map[string]interface{}{
+			"restartPolicy": "Never",
+			"containers":    []interface{}{map[string]interface{}{"name": "pause", "image": integrationImage}},
+		},
+	}
+}
+
+// requireNoError stops the test if err isn't nil, as later steps depend on the objects created.
+func requireNoError(t *testing.T, err error, msgAndArgs ...interface{}) {
+	if !assert.NoError(t, err, msgAndArgs...) {
+		t.FailNow()
+	}
+}
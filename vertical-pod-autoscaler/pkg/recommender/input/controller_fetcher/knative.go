@@ -0,0 +1,45 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// knativeServingGroup is the API group of Knative Serving.
+const knativeServingGroup = "serving.knative.dev"
+
+// knativeServingKinds are the kinds of Knative Serving above the Deployments it creates: a Revision owns a
+// Deployment and is owned by a Configuration, which is owned by a Service. None of them has a scale
+// subresource, so they're read with the dynamic client.
+var knativeServingKinds = map[schema.GroupKind]bool{
+	{Group: knativeServingGroup, Kind: "Service"}:       true,
+	{Group: knativeServingGroup, Kind: "Configuration"}: true,
+	{Group: knativeServingGroup, Kind: "Revision"}:      true,
+}
+
+// KnativeTerminal is the top level controller of Deployments created by Knative Serving.
+type KnativeTerminal string
+
+const (
+	// KnativeServiceTerminal resolves Deployments of Knative Revisions to the Knative Service. This is the
+	// default.
+	KnativeServiceTerminal KnativeTerminal = "Service"
+	// KnativeDeploymentTerminal makes Deployments of Knative Revisions top level, so that each Revision
+	// gets recommendations of its own.
+	KnativeDeploymentTerminal KnativeTerminal = "Deployment"
+)
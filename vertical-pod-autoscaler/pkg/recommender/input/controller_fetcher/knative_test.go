@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFindTopLevelForKnativeDeployment(t *testing.T) {
+	servingV1 := schema.GroupVersion{Group: knativeServingGroup, Version: "v1"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{servingV1})
+	for _, kind := range []string{"Service", "Configuration", "Revision"} {
+		mapper.Add(servingV1.WithKind(kind), apimeta.RESTScopeNamespace)
+	}
+	dynamicClient := newFakeDynamicClient()
+	dynamicClient.add(schema.GroupResource{Group: knativeServingGroup, Resource: "revisions"},
+		newUnstructured("serving.knative.dev/v1", "Revision", "test-namespace", "test-service-00001",
+			metav1.OwnerReference{APIVersion: "serving.knative.dev/v1", Kind: "Configuration", Name: "test-service", Controller: &trueVar}))
+	dynamicClient.add(schema.GroupResource{Group: knativeServingGroup, Resource: "configurations"},
+		newUnstructured("serving.knative.dev/v1", "Configuration", "test-namespace", "test-service",
+			metav1.OwnerReference{APIVersion: "serving.knative.dev/v1", Kind: "Service", Name: "test-service", Controller: &trueVar}))
+	dynamicClient.add(schema.GroupResource{Group: knativeServingGroup, Resource: "services"},
+		newUnstructured("serving.knative.dev/v1", "Service", "test-namespace", "test-service"))
+
+	newFetcher := func() *controllerFetcher {
+		f := simpleControllerFetcher()
+		f.mapper = mapper
+		f.scaleNamespacer = newFakeScalesGetter()
+		f.dynamicClient = dynamicClient
+		f.nonWorkloadOwnerKinds = make(map[schema.GroupKind]bool)
+		addController(f, &appsv1.Deployment{
+			TypeMeta: metav1.TypeMeta{Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-service-00001-deployment",
+				Namespace: "test-namespace",
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "serving.knative.dev/v1", Kind: "Revision", Name: "test-service-00001", Controller: &trueVar},
+				},
+			},
+		})
+		return f
+	}
+	deploymentKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-service-00001-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+
+	f := newFetcher()
+	res, err := f.findTopLevel(context.Background(), deploymentKey)
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-service", Kind: "Service", Namespace: "test-namespace"}, ApiVersion: "serving.knative.dev/v1"}, res.topLevel)
+	assert.Equal(t, []ResolutionPath{InformerPath, DynamicPath, DynamicPath, DynamicPath}, res.paths)
+
+	// With the Deployment as terminal, Revisions aren't followed.
+	f = newFetcher()
+	f.nonWorkloadOwnerKinds[schema.GroupKind{Group: knativeServingGroup, Kind: "Revision"}] = true
+	topLevel, err := f.FindTopLevel(deploymentKey)
+	assert.NoError(t, err)
+	assert.Equal(t, deploymentKey, topLevel)
+}
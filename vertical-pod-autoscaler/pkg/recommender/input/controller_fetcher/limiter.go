@@ -0,0 +1,94 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// limiter is a semaphore bounding concurrency. A nil limiter doesn't limit anything.
+type limiter chan struct{}
+
+// newLimiter returns a limiter allowing n concurrent holders, or nil if n isn't positive.
+func newLimiter(n int) limiter {
+	if n <= 0 {
+		return nil
+	}
+	return make(limiter, n)
+}
+
+// acquire waits until the limiter can be held or the context is done.
+func (l limiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l limiter) release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// groupKindLimiter bounds concurrency separately for each GroupKind, so that holders of a slow GroupKind
+// don't starve others. A nil groupKindLimiter doesn't limit anything.
+type groupKindLimiter struct {
+	size     int
+	mutex    sync.Mutex
+	limiters map[schema.GroupKind]limiter
+}
+
+// newGroupKindLimiter returns a limiter allowing n concurrent holders per GroupKind, or nil if n isn't
+// positive.
+func newGroupKindLimiter(n int) *groupKindLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return &groupKindLimiter{size: n, limiters: make(map[schema.GroupKind]limiter)}
+}
+
+func (l *groupKindLimiter) forGroupKind(groupKind schema.GroupKind) limiter {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	kindLimiter, found := l.limiters[groupKind]
+	if !found {
+		kindLimiter = newLimiter(l.size)
+		l.limiters[groupKind] = kindLimiter
+	}
+	return kindLimiter
+}
+
+// acquire waits until the limiter of the GroupKind can be held or the context is done.
+func (l *groupKindLimiter) acquire(ctx context.Context, groupKind schema.GroupKind) error {
+	return l.forGroupKind(groupKind).acquire(ctx)
+}
+
+func (l *groupKindLimiter) release(groupKind schema.GroupKind) {
+	l.forGroupKind(groupKind).release()
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestGroupKindLimiter(t *testing.T) {
+	slowKind := schema.GroupKind{Group: "example.com", Kind: "Slow"}
+	fastKind := schema.GroupKind{Group: "example.com", Kind: "Fast"}
+	l := newGroupKindLimiter(1)
+	assert.NoError(t, l.acquire(context.Background(), slowKind))
+
+	// The limiter of a GroupKind is independent from the others.
+	assert.NoError(t, l.acquire(context.Background(), fastKind))
+	l.release(fastKind)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l.acquire(ctx, slowKind))
+
+	l.release(slowKind)
+	assert.NoError(t, l.acquire(context.Background(), slowKind))
+	l.release(slowKind)
+
+	var unlimited *groupKindLimiter
+	assert.NoError(t, unlimited.acquire(context.Background(), slowKind))
+	unlimited.release(slowKind)
+}
+
+func TestMaxConcurrentReadsPerGroupKind(t *testing.T) {
+	groupVersion := schema.GroupVersion{Group: "example.com", Version: "v1"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{groupVersion})
+	mapper.Add(groupVersion.WithKind("SlowApp"), apimeta.RESTScopeNamespace)
+	mapper.Add(groupVersion.WithKind("FastApp"), apimeta.RESTScopeNamespace)
+	slowApps := schema.GroupResource{Group: "example.com", Resource: "slowapps"}
+	fastApps := schema.GroupResource{Group: "example.com", Resource: "fastapps"}
+	scales := newFakeScalesGetter()
+	scales.add(slowApps, &autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{Name: "test-slow", Namespace: "test-namespace"}})
+	scales.add(fastApps, &autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{Name: "test-fast", Namespace: "test-namespace"}})
+	unblock := make(chan struct{})
+	scales.blocked = map[schema.GroupResource]chan struct{}{slowApps: unblock}
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.readLimiter = newGroupKindLimiter(1)
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	slowKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-slow", Kind: "SlowApp", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	fastKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-fast", Kind: "FastApp", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	deploymentKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+
+	slowDone := make(chan error)
+	go func() {
+		_, err := f.FindTopLevel(slowKey)
+		slowDone <- err
+	}()
+	// Wait for the slow read to hold the limiter of its kind.
+	assert.NoError(t, wait.PollImmediate(time.Millisecond, 10*time.Second, func() (bool, error) {
+		scales.mutex.Lock()
+		defer scales.mutex.Unlock()
+		return scales.gets == 1, nil
+	}))
+
+	// Another resolution of the slow kind waits for it...
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := f.FindTopLevelWithContext(ctx, slowKey)
+	assert.True(t, errors.Is(err, ErrResolutionTimeout), "unexpected error: %v", err)
+
+	// ...while other kinds aren't held up, whether they're read from the API server or from informers.
+	topLevel, err := f.FindTopLevel(fastKey)
+	assert.NoError(t, err)
+	assert.Equal(t, fastKey, topLevel)
+	topLevel, err = f.FindTopLevel(deploymentKey)
+	assert.NoError(t, err)
+	assert.Equal(t, deploymentKey, topLevel)
+
+	close(unblock)
+	assert.NoError(t, <-slowDone)
+	topLevel, err = f.FindTopLevel(slowKey)
+	assert.NoError(t, err)
+	assert.Equal(t, slowKey, topLevel)
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ignoredManagers are field managers which don't indicate an owning controller: users and built-in
+// controllers managing status.
+var ignoredManagers = map[string]bool{
+	"before-first-apply":      true,
+	"helm":                    true,
+	"kube-controller-manager": true,
+}
+
+// inferManager returns the first field manager of the given object which looks like a controller, or "" if
+// there's none or the object doesn't expose managedFields.
+func inferManager(obj interface{}) string {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return ""
+	}
+	managedFields, found, err := unstructured.NestedSlice(u.Object, "metadata", "managedFields")
+	if err != nil || !found {
+		return ""
+	}
+	for _, entry := range managedFields {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		manager, _ := fields["manager"].(string)
+		if manager == "" || ignoredManagers[manager] || strings.HasPrefix(manager, "kubectl") {
+			continue
+		}
+		return manager
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func withManagers(obj *unstructured.Unstructured, managers ...string) *unstructured.Unstructured {
+	var managedFields []interface{}
+	for _, manager := range managers {
+		managedFields = append(managedFields, map[string]interface{}{"manager": manager, "operation": "Update"})
+	}
+	unstructured.SetNestedSlice(obj.Object, managedFields, "metadata", "managedFields")
+	return obj
+}
+
+func TestInferOwnersFromManagedFields(t *testing.T) {
+	widgetInformer := newCustomInformer()
+	widgetInformer.GetStore().Add(withManagers(newUnstructured("example.com/v1", "Widget", "test-namespace", "operated"),
+		"kubectl-client-side-apply", "widget-operator", "kube-controller-manager"))
+	widgetInformer.GetStore().Add(withManagers(newUnstructured("example.com/v1", "Widget", "test-namespace", "applied"),
+		"kubectl-client-side-apply", "kube-controller-manager"))
+	widgetInformer.GetStore().Add(newUnstructured("example.com/v1", "Widget", "test-namespace", "unmanaged"))
+	f := simpleControllerFetcher()
+	f.customInformers = map[schema.GroupKind]cache.SharedIndexInformer{
+		{Group: "example.com", Kind: "Widget"}: widgetInformer,
+	}
+	widgetKey := func(name string) *ControllerKeyWithAPIVersion {
+		return &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: name, Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	}
+
+	// Inference is opt-in.
+	topLevel, err := f.FindTopLevel(widgetKey("operated"))
+	assert.NoError(t, err)
+	assert.Equal(t, widgetKey("operated"), topLevel)
+
+	f.inferOwners = true
+	_, err = f.FindTopLevel(widgetKey("operated"))
+	assert.True(t, errors.Is(err, ErrInferredOwner), "unexpected error: %v", err)
+	var inferredErr *InferredOwnerError
+	if assert.True(t, errors.As(err, &inferredErr)) {
+		assert.Equal(t, *widgetKey("operated"), inferredErr.TopLevel)
+		assert.Equal(t, "widget-operator", inferredErr.Manager)
+	}
+
+	for _, name := range []string{"applied", "unmanaged"} {
+		topLevel, err = f.FindTopLevel(widgetKey(name))
+		assert.NoError(t, err)
+		assert.Equal(t, widgetKey(name), topLevel)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// nodeKind is the kind of the controller of mirror Pods: the kubelet sets the Node it runs on as the controller
+// of the mirror Pods it creates for its static Pods. Nodes don't manage Pods the way workload controllers do
+// and have no scale subresource, so they're never followed.
+var nodeKind = schema.GroupKind{Kind: "Node"}
+
+// MirrorPodPolicy decides how mirror Pods of static Pods, which are controlled by a Node, are resolved.
+type MirrorPodPolicy string
+
+const (
+	// MirrorPodReject fails resolution of mirror Pods with ErrMirrorPod. This is the default.
+	MirrorPodReject MirrorPodPolicy = "Reject"
+	// MirrorPodStandalone resolves mirror Pods to themselves, like Pods without a controller are with
+	// Options.AllowStandalonePods.
+	MirrorPodStandalone MirrorPodPolicy = "Standalone"
+)
+
+// isNodeOwner tells whether the given canonical owner is a Node.
+func isNodeOwner(owner ControllerKeyWithAPIVersion) bool {
+	return owner.Kind == nodeKind.Kind && apiGroup(owner.ApiVersion) == nodeKind.Group
+}
+
+// resolveMirrorPod resolves the given mirror Pod, controlled by the given Node, according to
+// Options.MirrorPods.
+func (f *controllerFetcher) resolveMirrorPod(pod *corev1.Pod, node ControllerKeyWithAPIVersion) (*FindTopLevelResult, error) {
+	if f.mirrorPods != MirrorPodStandalone {
+		return nil, fmt.Errorf("%w: Pod %s/%s is controlled by Node %s", ErrMirrorPod, pod.Namespace, pod.Name, node.Name)
+	}
+	return f.podAsTopLevel(pod), nil
+}
+
+// podAsTopLevel returns the result of resolving the given Pod to itself.
+func (f *controllerFetcher) podAsTopLevel(pod *corev1.Pod) *FindTopLevelResult {
+	return &FindTopLevelResult{TopLevel: f.transformKey(&ControllerKeyWithAPIVersion{
+		ControllerKey: ControllerKey{Namespace: pod.Namespace, Kind: "Pod", Name: pod.Name},
+		ApiVersion:    "v1",
+	})}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindTopLevelForMirrorPod(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kube-apiserver-test-node",
+			Namespace: "kube-system",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "v1", Kind: "Node", Name: "test-node", Controller: &trueVar},
+			},
+		},
+	}
+	f := simpleControllerFetcher()
+	scales := newFakeScalesGetter()
+	f.scaleNamespacer = scales
+
+	_, err := f.FindTopLevelForPod(context.Background(), pod)
+	assert.EqualError(t, err, "pod is a mirror pod of a static pod: Pod kube-system/kube-apiserver-test-node is controlled by Node test-node")
+	assert.True(t, errors.Is(err, ErrMirrorPod))
+	assert.Equal(t, outcomeUnsupported, resolutionOutcome(err))
+
+	// AllowStandalonePods doesn't apply to mirror Pods, which have a controller.
+	f.allowStandalonePods = true
+	_, err = f.FindTopLevelForPod(context.Background(), pod)
+	assert.True(t, errors.Is(err, ErrMirrorPod), "unexpected error: %v", err)
+
+	f.mirrorPods = MirrorPodStandalone
+	topLevel, err := f.FindTopLevelForPod(context.Background(), pod)
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "kube-apiserver-test-node", Kind: "Pod", Namespace: "kube-system"}, ApiVersion: "v1"}, topLevel)
+
+	// Nodes are never read through the scale subresource.
+	_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-node", Kind: "Node"}, ApiVersion: "v1"})
+	assert.True(t, errors.Is(err, ErrNonWorkloadTarget), "unexpected error: %v", err)
+	assert.Zero(t, scales.gets)
+}
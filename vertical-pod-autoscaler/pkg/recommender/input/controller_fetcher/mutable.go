@@ -0,0 +1,61 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// completedPhases are values of status.phase of custom controllers, e.g. Argo Workflows, which mean the
+// controller has finished.
+var completedPhases = map[string]bool{
+	"Succeeded": true,
+	"Failed":    true,
+	"Error":     true,
+	"Completed": true,
+}
+
+func (f *controllerFetcher) IsMutableTopLevel(key *ControllerKeyWithAPIVersion) (bool, error) {
+	controller, err := f.getController(context.Background(), *key)
+	if err != nil {
+		return false, err
+	}
+	groupVersion, err := schema.ParseGroupVersion(key.ApiVersion)
+	if err != nil {
+		return false, err
+	}
+	if key.Kind == string(job) && (groupVersion.Group == "" || groupVersion.Group == batchv1.GroupName) {
+		// Pod templates of Jobs can't be changed, whether they're running or not.
+		return false, nil
+	}
+	return !isCompleted(controller.object), nil
+}
+
+// isCompleted tells whether the given controller object has finished running. Objects of unknown types are
+// considered running.
+func isCompleted(obj interface{}) bool {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	phase, _, _ := unstructured.NestedString(u.Object, "status", "phase")
+	return completedPhases[phase]
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestIsMutableTopLevel(t *testing.T) {
+	workflowKind := schema.GroupKind{Group: "argoproj.io", Kind: "Workflow"}
+	f := simpleControllerFetcher()
+	f.customInformers = map[schema.GroupKind]cache.SharedIndexInformer{workflowKind: newCustomInformer()}
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	addController(f, &batchv1.Job{
+		TypeMeta:   metav1.TypeMeta{Kind: "Job"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-job", Namespace: "test-namespace"},
+	})
+	running := newUnstructured("argoproj.io/v1alpha1", "Workflow", "test-namespace", "running-workflow")
+	assert.NoError(t, unstructured.SetNestedField(running.Object, "Running", "status", "phase"))
+	succeeded := newUnstructured("argoproj.io/v1alpha1", "Workflow", "test-namespace", "succeeded-workflow")
+	assert.NoError(t, unstructured.SetNestedField(succeeded.Object, "Succeeded", "status", "phase"))
+	f.customInformers[workflowKind].GetStore().Add(running)
+	f.customInformers[workflowKind].GetStore().Add(succeeded)
+
+	testCases := []struct {
+		key     ControllerKeyWithAPIVersion
+		mutable bool
+	}{
+		{ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}, true},
+		{ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "test-job", Kind: "Job", Namespace: "test-namespace"}, ApiVersion: "batch/v1"}, false},
+		{ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "running-workflow", Kind: "Workflow", Namespace: "test-namespace"}, ApiVersion: "argoproj.io/v1alpha1"}, true},
+		{ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "succeeded-workflow", Kind: "Workflow", Namespace: "test-namespace"}, ApiVersion: "argoproj.io/v1alpha1"}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.key.Name, func(t *testing.T) {
+			mutable, err := f.IsMutableTopLevel(&tc.key)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.mutable, mutable)
+		})
+	}
+
+	_, err := f.IsMutableTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-job", Kind: "Job", Namespace: "test-namespace"}, ApiVersion: "batch/v1"})
+	assert.True(t, errors.Is(err, ErrControllerNotFound), "unexpected error: %v", err)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+)
+
+// defaultNotFoundBurstWindow is the window of Options.NotFoundBurstThreshold if Options.NotFoundBurstWindow
+// isn't set.
+const defaultNotFoundBurstWindow = time.Minute
+
+type notFoundBurstKind struct {
+	// worked is set once a controller of the kind was read.
+	worked bool
+	// notFounds holds the times of reads which found nothing within the window, oldest first.
+	notFounds []time.Time
+}
+
+// notFoundBursts detects bursts of reads of controllers finding nothing, by GroupKind. Many controllers of a
+// kind which could be read before suddenly going missing is more likely a change of the API surface, e.g. a
+// version of a CRD removed or an API server rollout, than all of them being deleted.
+type notFoundBursts struct {
+	mutex     sync.Mutex
+	threshold int
+	window    time.Duration
+	kinds     map[schema.GroupKind]*notFoundBurstKind
+}
+
+func newNotFoundBursts(threshold int, window time.Duration) *notFoundBursts {
+	if window <= 0 {
+		window = defaultNotFoundBurstWindow
+	}
+	return &notFoundBursts{threshold: threshold, window: window, kinds: make(map[schema.GroupKind]*notFoundBurstKind)}
+}
+
+func (b *notFoundBursts) kind(groupKind schema.GroupKind) *notFoundBurstKind {
+	kind, found := b.kinds[groupKind]
+	if !found {
+		kind = &notFoundBurstKind{}
+		b.kinds[groupKind] = kind
+	}
+	return kind
+}
+
+// recordRead records a read of a controller of the given kind.
+func (b *notFoundBursts) recordRead(groupKind schema.GroupKind) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.kind(groupKind).worked = true
+}
+
+// recordNotFound records a read of a controller of the given kind which found nothing, and tells whether it
+// completes a burst: threshold such reads within the window, of a kind which was read before. Reads which
+// found nothing are forgotten for all kinds once a burst is detected, so that a burst is reported once,
+// however many resolutions are failing at the time.
+func (b *notFoundBursts) recordNotFound(groupKind schema.GroupKind, now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	kind := b.kind(groupKind)
+	if !kind.worked {
+		return false
+	}
+	windowStart := now.Add(-b.window)
+	first := 0
+	for first < len(kind.notFounds) && !kind.notFounds[first].After(windowStart) {
+		first++
+	}
+	kind.notFounds = append(kind.notFounds[first:], now)
+	if len(kind.notFounds) < b.threshold {
+		return false
+	}
+	for _, kind := range b.kinds {
+		kind.notFounds = nil
+	}
+	return true
+}
+
+// recordNotFoundRead records a read of a controller of the given kind which found nothing, and resets the
+// mapper if it completes a burst, see Options.NotFoundBurstThreshold.
+func (f *controllerFetcher) recordNotFoundRead(groupKind schema.GroupKind) {
+	if f.notFoundBursts == nil {
+		return
+	}
+	now := time.Now()
+	if f.notFoundBursts.recordNotFound(groupKind, now) {
+		klog.Warningf("%d reads of %s found nothing within %v, refreshing discovery information",
+			f.notFoundBursts.threshold, groupKind, f.notFoundBursts.window)
+		f.resetStaleMapper(now)
+	}
+}
+
+// recordFoundRead records a read of a controller of the given kind which found it.
+func (f *controllerFetcher) recordFoundRead(groupKind schema.GroupKind) {
+	if f.notFoundBursts != nil {
+		f.notFoundBursts.recordRead(groupKind)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestNotFoundBursts(t *testing.T) {
+	widgets := schema.GroupKind{Group: "example.com", Kind: "Widget"}
+	gadgets := schema.GroupKind{Group: "example.com", Kind: "Gadget"}
+	b := newNotFoundBursts(3, time.Minute)
+	now := time.Now()
+
+	// Kinds which were never read don't burst.
+	for i := 0; i < 5; i++ {
+		assert.False(t, b.recordNotFound(widgets, now))
+	}
+
+	b.recordRead(widgets)
+	b.recordRead(gadgets)
+	assert.False(t, b.recordNotFound(widgets, now))
+	// Reads older than the window are forgotten.
+	assert.False(t, b.recordNotFound(widgets, now.Add(time.Minute)))
+	assert.False(t, b.recordNotFound(gadgets, now.Add(time.Minute)))
+	assert.False(t, b.recordNotFound(widgets, now.Add(time.Minute)))
+	assert.True(t, b.recordNotFound(widgets, now.Add(time.Minute)))
+	// A burst is reported once, all kinds start over.
+	assert.False(t, b.recordNotFound(gadgets, now.Add(time.Minute)))
+	assert.False(t, b.recordNotFound(widgets, now.Add(time.Minute)))
+}
+
+func TestNotFoundBurstResetsMapper(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	defaultMapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	defaultMapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	mapper := &countingRESTMapper{RESTMapper: defaultMapper}
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "widgets"},
+		&autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{Name: "test-widget", Namespace: "test-namespace"}})
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.notFoundBursts = newNotFoundBursts(3, time.Minute)
+	widgetKey := func(name string) *ControllerKeyWithAPIVersion {
+		return &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: name, Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	}
+
+	_, err := f.FindTopLevel(widgetKey("test-widget"))
+	assert.NoError(t, err)
+	// The Widgets go missing, e.g. because the version they're read with isn't served anymore.
+	for i := 0; i < 2; i++ {
+		_, err = f.FindTopLevel(widgetKey(fmt.Sprintf("missing-widget-%d", i)))
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 0, mapper.resets)
+	_, err = f.FindTopLevel(widgetKey("missing-widget-2"))
+	assert.Error(t, err)
+	assert.Equal(t, 1, mapper.resets)
+
+	// Another burst right after doesn't reset the mapper again.
+	for i := 3; i < 6; i++ {
+		_, err = f.FindTopLevel(widgetKey(fmt.Sprintf("missing-widget-%d", i)))
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 1, mapper.resets)
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// DefaultResolutionCacheTTL is the ResolutionCacheTTL of fetchers created by NewControllerFetcher.
+	DefaultResolutionCacheTTL = time.Minute
+	// DefaultNegativeResolutionCacheTTL is the NegativeResolutionCacheTTL of fetchers created by
+	// NewControllerFetcher.
+	DefaultNegativeResolutionCacheTTL = 10 * time.Second
+)
+
+// Options contains optional configuration of a controller fetcher.
+type Options struct {
+	// CustomInformers are used to read owners of controllers of the given kinds (typically CRDs) instead of
+	// their scale subresource. Objects stored in the informers must implement metav1.Object, which is the
+	// case for unstructured objects. They must not be started before the fetcher is created, as the fetcher
+	// adds the indexers FindTopLevelByUID needs to them; the fetcher starts them.
+	CustomInformers map[schema.GroupKind]cache.SharedIndexInformer
+	// TerminalKinds are always treated as top level controllers, their owners are never followed.
+	// If a custom informer is registered for a terminal kind it's used to check the controller exists,
+	// otherwise the controller isn't read at all. For example, registering the Volcano Job
+	// (batch.volcano.sh/Job) as a terminal kind makes Pods and PodGroups of a Volcano Job resolve to it.
+	TerminalKinds []schema.GroupKind
+	// ResolutionCacheTTL enables caching of resolved top level controllers, and of each controller read while
+	// resolving them, for the given time. Cached resolutions are dropped when discovery information is reset.
+	// Caching is disabled by default, except in fetchers created by NewControllerFetcher.
+	ResolutionCacheTTL time.Duration
+	// NegativeResolutionCacheTTL enables caching of failures to resolve top level controllers for the given
+	// time, so that controllers which fail repeatedly, e.g. because they were deleted, aren't read on every
+	// lookup. Timeouts, cancellations and throttling aren't cached. It's independent of ResolutionCacheTTL and
+	// disabled by default, except in fetchers created by NewControllerFetcher.
+	NegativeResolutionCacheTTL time.Duration
+	// Cache replaces the built-in resolution cache, e.g. with one shared by several fetchers or bounded in size.
+	// The fetcher stores resolutions and cacheable failures in it and purges it when discovery information is
+	// reset; expiry is up to the cache, so NegativeResolutionCacheTTL, RefreshResolutionCache, EagerCache,
+	// OnCacheEvict and dumps of the cache have no effect. ResolutionCacheTTL still enables the cache of
+	// controllers read while resolving. Concurrent resolutions of the same controller are collapsed into one
+	// whichever cache is used.
+	Cache Cache
+	// RefreshResolutionCache makes the fetcher re-resolve cached controllers in the background shortly
+	// before their entries expire, with jitter to spread the load. This keeps the cache warm for controllers
+	// which are resolved regularly while still bounding staleness by ResolutionCacheTTL. Refreshing stops
+	// when the fetcher is stopped.
+	RefreshResolutionCache bool
+	// EagerCache makes the fetcher resolve well-known controllers as soon as their informers observe them being
+	// added or updated and cache the results, so that FindTopLevel nearly always hits the cache. Entries of
+	// deleted controllers are invalidated. It costs a resolution per change of any watched controller, which
+	// adds up during churn. It needs ResolutionCacheTTL and is disabled by default.
+	EagerCache bool
+	// FreshScaleReads makes every resolution read controllers resolved through the scale subresource from the
+	// API server, instead of reusing reads cached for ResolutionCacheTTL when resolving other controllers with
+	// the same owners. This trades a scale subresource GET per such controller and resolution for never
+	// following owners older than the resolution. The scale client doesn't cache reads, and results of whole
+	// resolutions are still cached, so it only matters with ResolutionCacheTTL set. It's off by default.
+	FreshScaleReads bool
+	// OnCacheEvict is called with each entry evicted from the resolution cache and the reason: CacheEvictTTL
+	// for expired entries, CacheEvictInvalidated for entries of controllers found deleted while refreshing or
+	// failing to resolve, CacheEvictPurged for entries dropped when discovery information is reset. The cache
+	// isn't bounded in size, so there are no other evictions. It's called synchronously, from
+	// resolutions and refreshes, so it must be fast.
+	OnCacheEvict func(key ControllerKeyWithAPIVersion, reason string)
+	// NonWorkloadKinds extends the built-in list of kinds which aren't workloads (Services, ConfigMaps etc.).
+	// Resolving such a kind fails with ErrNonWorkloadTarget instead of trying its scale subresource.
+	NonWorkloadKinds []schema.GroupKind
+	// ResolutionPolicy decides how each controller is read during resolution. DefaultResolutionPolicy is used
+	// if it's nil.
+	ResolutionPolicy ResolutionPolicy
+	// KeyCanonicalizer normalizes the kind and API version of each controller entering resolution.
+	// DefaultKeyCanonicalizer is used if it's nil.
+	KeyCanonicalizer KeyCanonicalizer
+	// KindAliases map GroupKinds to the GroupKinds they're equivalent to, e.g. while a kind is migrated to a new
+	// group and served under both. Aliases are replaced before KeyCanonicalizer runs, so controllers referred to
+	// with an alias are read, cached and returned as the canonical kind. The version is kept.
+	// KeyCanonicalizer (DefaultKeyCanonicalizer replaces versions unknown to the RESTMapper) can adjust it.
+	KindAliases map[schema.GroupKind]schema.GroupKind
+	// ResolutionHints map the GroupKinds of controllers to the GroupKind of their owners, for operators who know
+	// that e.g. a CRD is always owned by a Deployment. Owners matching the hint are followed as they are, without
+	// asking the RESTMapper for their canonical kind and preferred version, which saves discovery calls after
+	// each mapper reset. Owners of hinted well-known kinds are read from their informers with the version the
+	// informers watch. Owners not matching the hint are resolved as usual. It's an advanced performance knob: a
+	// hint makes resolution trust the owner reference's kind, so aliases and capitalization aren't fixed.
+	ResolutionHints map[schema.GroupKind]schema.GroupKind
+	// OnResolve is called after each FindTopLevel with a description of the resolution. It's called
+	// asynchronously from a single goroutine, so it never stalls resolution: events are buffered and dropped
+	// if the buffer is full, see DroppedResolveEvents.
+	OnResolve func(ResolveEvent)
+	// AuditSink records each FindTopLevel call. Like OnResolve it's called asynchronously and records are
+	// dropped if it doesn't keep up, see DroppedAuditRecords; drops are also counted in a metric and logged.
+	// Nothing is recorded if it's nil.
+	AuditSink AuditSink
+	// DynamicClient is used to read owners of controllers resolved through the scale subresource when the
+	// scale subresource doesn't carry them, as is the case for many custom resources. This requires the
+	// fetcher to be allowed to get these resources. NewControllerFetcherWithOptions creates the client from
+	// its config if it's nil. Without it owners are only read from the scale subresource.
+	DynamicClient dynamic.Interface
+	// ResolutionTimeout bounds the duration of a single resolution, however long the ownership chain is.
+	// The deadline is derived from the context resolution was called with and is checked before reading each
+	// controller. Resolution exceeding it fails with ErrResolutionTimeout. There's no timeout by default.
+	ResolutionTimeout time.Duration
+	// InformerLabelSelector and InformerFieldSelector, if set, make the fetcher watch only well-known
+	// controllers matching them, with informers of its own (see OwnInformers). On large clusters this cuts the memory used by the informers to the
+	// controllers VPA cares about, e.g. workloads with an opt-in label. Controllers not matching the selectors
+	// are still resolved, but each of them costs a GET to the API server, so the selectors should cover all
+	// controllers resolved regularly.
+	InformerLabelSelector labels.Selector
+	InformerFieldSelector fields.Selector
+	// InformerTransform is applied to controllers entering the informers of well-known controllers, e.g. to
+	// strip fields the fetcher never reads. StripUnusedFields is used if it's nil: on clusters where controllers
+	// are applied with kubectl, the last-applied-configuration annotation holds a copy of each of them, which can
+	// make up half of the memory used by the informers. With InferOwnersFromManagedFields, managedFields are kept.
+	// The fetcher registers its informers in the given factory, so the transform applies to the factory's other
+	// users too (the recommender's target selector fetcher only reads selectors), which must not need the
+	// stripped fields. Informers of kinds other users created in the factory first are shared untransformed.
+	InformerTransform TransformFunc
+	// OwnInformers makes the fetcher watch well-known controllers with informers of its own instead of
+	// registering them in the given factory, e.g. when other users of the factory need fields InformerTransform
+	// strips. This costs a second watch and cache of each controller if the factory's users watch them too.
+	// Informer selectors imply it. Pod and HorizontalPodAutoscaler informers always come from the factory.
+	OwnInformers bool
+	// InferOwnersFromManagedFields is an experimental debugging aid for operators which don't set owner
+	// references. If a top level controller is managed (according to its managedFields) by something other
+	// than kubectl, Helm or the kube-controller-manager, resolution fails with ErrInferredOwner naming the manager,
+	// which is likely the real controller. Typed objects of this client version don't expose managedFields,
+	// so only controllers read as unstructured objects, i.e. from custom informers, are inspected.
+	InferOwnersFromManagedFields bool
+	// ScalePathKinds are always read through their scale subresource, overriding the ResolutionPolicy. CRDs
+	// reusing the Kind of a well-known controller in another group (e.g. while migrating from Deployments to a
+	// custom Deployment) are told apart by their group already, but controllers referred to without an API
+	// version are taken to be well-known. Listing a well-known GroupKind here makes it use the scale subresource,
+	// losing the informer fast path for it. Kinds without a scale subresource can't be resolved at all once
+	// listed.
+	ScalePathKinds []schema.GroupKind
+	// DynamicInformerResources are watched with informers backed by DynamicClient, which are then used like
+	// CustomInformers: owners of these resources are read from the informers instead of the scale subresource.
+	// This saves a scale subresource GET per read and works for CRDs whose scale subresource lacks owner
+	// references. Resources the RESTMapper doesn't know at construction are skipped. CustomInformers take
+	// precedence for the same GroupKind.
+	DynamicInformerResources []schema.GroupVersionResource
+	// KnativeTerminal decides where resolution of Deployments created by Knative Serving stops. Knative
+	// Revisions, Configurations and Services are read with DynamicClient, or with CustomInformers if there
+	// are any for them. KnativeServiceTerminal is used if it's empty.
+	KnativeTerminal KnativeTerminal
+	// ArgoRolloutsTerminal decides where resolution of Pods created by Argo Rollouts Experiments and
+	// AnalysisRuns stops. Experiments and AnalysisRuns are read with DynamicClient, or with CustomInformers if
+	// there are any for them. ArgoRolloutsRolloutTerminal is used if it's empty.
+	ArgoRolloutsTerminal ArgoRolloutsTerminal
+	// FlaggerTerminal decides where resolution of primary Deployments of Flagger Canaries stops, and what
+	// Canaries resolve to. Canaries are read with DynamicClient, or with CustomInformers if there are any for
+	// them. FlaggerCanaryTerminal is used if it's empty.
+	FlaggerTerminal FlaggerTerminal
+	// WatchPods makes the fetcher watch all Pods, so that FindTopLevelForPodName and FindTopLevelByUID
+	// can resolve from Pods without reading them from the API server. Pods aren't filtered by the informer
+	// selectors. It's off by default because of the memory the informer takes on large clusters.
+	WatchPods bool
+	// NameTransformer maps top level controllers returned by resolution to their logical names, for platforms
+	// which prefix or suffix names of controllers per tenant. It's applied to results only: resolution, the
+	// resolution cache, OnResolve and AuditSink work with the real names. Names are left alone if it's nil.
+	NameTransformer func(ControllerKey) ControllerKey
+	// FinalKindRewrite maps top level controllers returned by resolution to the controllers recommendations
+	// should be attributed to, e.g. every Argo Rollout to a synthetic Service kind of a platform's own
+	// attribution model. Like NameTransformer, which is applied first, it only affects results, and only the top
+	// level controller: owners are followed as they are. Results are returned as resolved if it's nil.
+	FinalKindRewrite func(ControllerKeyWithAPIVersion) ControllerKeyWithAPIVersion
+	// AllowStandalonePods makes Pods without a controller, e.g. created directly with kubectl, resolve to
+	// themselves (Kind Pod, API version v1), so that they can be tracked in recommendation-only mode. Without
+	// it resolving them fails with ErrNoController.
+	AllowStandalonePods bool
+	// MirrorPods decides how mirror Pods of static Pods, whose controller is the Node they run on, are resolved:
+	// MirrorPodReject (the default) fails with ErrMirrorPod, MirrorPodStandalone resolves them to themselves.
+	// Nodes are never followed as owners either way.
+	MirrorPods MirrorPodPolicy
+	// WatchHPAs makes the fetcher watch all HorizontalPodAutoscalers, which FindTopLevelWithHPA and
+	// HPAsTargeting need. HPAs aren't filtered by the informer selectors. It's off by default.
+	WatchHPAs bool
+	// DisableScaleResolution stops the fetcher from using the scale subresource, for clusters where it's
+	// known not to be allowed to. Only controllers with informers are read, any other controller is treated
+	// as top level without an error.
+	DisableScaleResolution bool
+	// NonWorkloadOwnerKinds extends the built-in list of kinds which deployment tools set as owners of
+	// workloads (Flux HelmReleases and Kustomizations, Argo CD Applications). Such owners are never followed,
+	// so a Deployment owned by a HelmRelease is the top level controller. NonWorkloadKinds aren't followed
+	// either.
+	NonWorkloadOwnerKinds []schema.GroupKind
+	// MaxConcurrentResolutions bounds the number of resolutions running at the same time, to bound the load on
+	// the API server. Resolutions wait (within their context) for others to finish. It's unbounded by default.
+	MaxConcurrentResolutions int
+	// MaxConcurrentReadsPerGroupKind bounds the number of controllers of each GroupKind read from the API server
+	// (through the scale subresource or the dynamic client) at the same time. Resolutions wait (within their
+	// context) for reads of the same GroupKind to finish, so a slow CRD only throttles resolutions reading it.
+	// Controllers read from informers aren't limited. It's unbounded by default.
+	MaxConcurrentReadsPerGroupKind int
+	// MaxInformerStaleness makes the fetcher read well-known controllers from the API server instead of their
+	// informer when the informer's reflector reported list or watch errors and the informer received no event
+	// (a change, resync or relist) for longer than this, see InformerStaleness. This trades latency for
+	// correctness while a watch is broken; informers which don't fail are used however quiet their kind is. It's
+	// only effective for fetchers with a kube client. Informers are always used by default.
+	MaxInformerStaleness time.Duration
+	// PreserveOwnerAPIVersion makes resolution return top level controllers with the API version their owner
+	// references were created with. By default the version is replaced with the one the server prefers for
+	// the kind, since the recorded one may be deprecated or no longer served.
+	PreserveOwnerAPIVersion bool
+	// BlockOwnerDeletionAsController makes resolution follow the owner with blockOwnerDeletion set of Pods and
+	// controllers which have no owner with controller set, since some controllers only set the former. It's a
+	// heuristic: the owner is followed only if it's the only one blocking deletion and results reached through it
+	// are marked with FindTopLevelResult.InferredOwner. Such controllers are top level by default.
+	BlockOwnerDeletionAsController bool
+	// InferCronJobFromLabels makes resolution follow the CronJob named by the CronJobNameKey label or annotation
+	// of Jobs which have no owners, for tools creating Jobs from CronJobs without owner references. Results
+	// reached through such a CronJob are marked with FindTopLevelResult.InferredOwner. Those Jobs are top level
+	// by default.
+	InferCronJobFromLabels bool
+	// OwnerKindValidation makes resolution check that built-in kinds are only owned by the built-in kinds
+	// expected to own them (ReplicaSets by Deployments, Jobs by CronJobs, Pods by workloads), to catch
+	// misconfigured operators, e.g. one making a Pod own a Deployment. ReplicaSets controlled by several
+	// Deployments, e.g. after a botched adoption, are flagged too; the Deployment with the lowest UID is followed
+	// unless validation is strict. Owners which are custom resources are never flagged. It's
+	// OwnerKindValidationOff by default.
+	OwnerKindValidation OwnerKindValidation
+	// RejectTerminatingTargets makes resolution fail with ErrTargetTerminating when the top level controller and
+	// every controller read on the way to it are being deleted, i.e. the whole workload is going away.
+	// Controllers being deleted are otherwise resolved as usual, FindTopLevelResult.Terminating tells whether the
+	// top level controller is one of them.
+	RejectTerminatingTargets bool
+	// ScaleTargetRefExtractors make resolution follow a reference read from controllers of the given kinds which
+	// have no owners, for scalable CRDs referring to the workload they manage the way HPAs do with
+	// spec.scaleTargetRef (see SpecScaleTargetRef) instead of being its owner. The referenced controller, in the
+	// namespace of the CRD, is followed as if it was the owner. The CRD is read from its custom informer or with
+	// DynamicClient, as its scale subresource doesn't carry its spec.
+	ScaleTargetRefExtractors map[schema.GroupKind]ScaleTargetRefExtractor
+	// HealthWindow enables Healthy, which reports the fetcher unhealthy if nearly all resolutions over the last
+	// HealthWindow failed. Cached resolutions aren't counted. Health isn't tracked by default.
+	HealthWindow time.Duration
+	// RecentErrorsSize is the number of failed resolutions RecentErrors returns, DefaultRecentErrorsSize if it
+	// isn't positive.
+	RecentErrorsSize int
+	// NotFoundBurstThreshold makes the fetcher refresh its discovery information as soon as this many reads of
+	// controllers of a kind which could be read before find nothing within NotFoundBurstWindow, instead of
+	// waiting for the periodic refresh. Such bursts typically follow a removed version of a CRD or an API
+	// server rollout. Refreshes are debounced like those after reads of resources which aren't served. It's
+	// disabled by default.
+	NotFoundBurstThreshold int
+	// NotFoundBurstWindow is the window of NotFoundBurstThreshold, a minute if it isn't set.
+	NotFoundBurstWindow time.Duration
+	// DiscoveryMode decides when the RESTMapper reads discovery information, see DiscoveryCached (the default)
+	// and DiscoveryUncached, which trades API server load for CRDs being resolvable as soon as they're installed.
+	DiscoveryMode DiscoveryMode
+	// DiscoveryRefreshInterval is how often discovery information is re-read, five minutes if it isn't set.
+	// Each refresh reads the discovery information of all API groups and versions, one request each, and drops
+	// cached resolutions, so short intervals load the API server and lower the hit rate of the resolution cache.
+	DiscoveryRefreshInterval time.Duration
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Outcomes of resolutions, the values of the outcome label of the resolutions counter.
+const (
+	outcomeOK          = "ok"
+	outcomeNotFound    = "not_found"
+	outcomeCycle       = "cycle"
+	outcomeUnsupported = "unsupported"
+	outcomeForbidden   = "forbidden"
+	outcomeTimeout     = "timeout"
+	outcomeError       = "error"
+)
+
+// outcomeErrors maps sentinel errors to outcomes, errors matching none of them are outcomeError.
+var outcomeErrors = []struct {
+	err     error
+	outcome string
+}{
+	{ErrControllerNotFound, outcomeNotFound},
+	{ErrOwnershipCycle, outcomeCycle},
+	{ErrNonWorkloadTarget, outcomeUnsupported},
+	{ErrKindUnavailable, outcomeUnsupported},
+	{ErrNoController, outcomeUnsupported},
+	{ErrMirrorPod, outcomeUnsupported},
+	{ErrResolutionTimeout, outcomeTimeout},
+	{context.DeadlineExceeded, outcomeTimeout},
+}
+
+// resolutionOutcome returns the outcome of a resolution which failed with the given error, outcomeOK if it's nil.
+func resolutionOutcome(err error) string {
+	if err == nil {
+		return outcomeOK
+	}
+	for _, outcomeError := range outcomeErrors {
+		if errors.Is(err, outcomeError.err) {
+			return outcomeError.outcome
+		}
+	}
+	var status k8serrors.APIStatus
+	if errors.As(err, &status) && status.Status().Code == http.StatusForbidden {
+		return outcomeForbidden
+	}
+	return outcomeError
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestResolutionOutcome(t *testing.T) {
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	testCases := []struct {
+		err      error
+		expected string
+	}{
+		{nil, outcomeOK},
+		{fmt.Errorf("Deployment test-namespace/test-deployment %w", ErrControllerNotFound), outcomeNotFound},
+		{fmt.Errorf("%w: ReplicaSet test-namespace/test-rs, %w", ErrSelfOwnership, ErrOwnershipCycle), outcomeCycle},
+		{fmt.Errorf("%w: Service test-namespace/test-service", ErrNonWorkloadTarget), outcomeUnsupported},
+		{ErrNoController, outcomeUnsupported},
+		{&ResolutionTimeoutError{}, outcomeTimeout},
+		{fmt.Errorf("Unhandled targetRef: %w", k8serrors.NewForbidden(deployments, "test-deployment", errors.New("denied"))),
+			outcomeForbidden},
+		{k8serrors.NewInternalError(errors.New("boom")), outcomeError},
+		{errors.New("unexpected"), outcomeError},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprint(tc.err), func(t *testing.T) {
+			assert.Equal(t, tc.expected, resolutionOutcome(tc.err))
+		})
+	}
+}
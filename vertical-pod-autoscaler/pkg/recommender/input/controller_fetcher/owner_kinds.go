@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// OwnerKindValidation decides what happens when a controller is owned by a built-in kind which isn't expected
+// to own it, e.g. a Deployment owned by a Pod, which is likely a misconfigured operator.
+type OwnerKindValidation string
+
+const (
+	// OwnerKindValidationOff doesn't check kinds of owners.
+	OwnerKindValidationOff OwnerKindValidation = ""
+	// OwnerKindValidationWarn logs a warning for each unexpected owner and follows it anyway.
+	OwnerKindValidationWarn OwnerKindValidation = "Warn"
+	// OwnerKindValidationStrict fails resolution with ErrUnexpectedOwnerKind.
+	OwnerKindValidationStrict OwnerKindValidation = "Strict"
+)
+
+// builtInOwnerKinds are the built-in kinds which own workloads, with their API groups. Only owners of these kinds
+// are validated, any custom resource may own a workload.
+var builtInOwnerKinds = map[string]string{
+	"Pod":                         "",
+	string(replicationController): "",
+	string(daemonSet):             "apps",
+	string(deployment):            "apps",
+	string(replicaSet):            "apps",
+	string(statefulSet):           "apps",
+	string(job):                   "batch",
+	"CronJob":                     "batch",
+}
+
+// expectedBuiltInOwnerKinds are the built-in kinds expected to own each built-in kind. Kinds missing from the
+// map aren't expected to be owned by any built-in kind.
+var expectedBuiltInOwnerKinds = map[string]map[string]bool{
+	"Pod": {
+		string(replicaSet):            true,
+		string(job):                   true,
+		string(statefulSet):           true,
+		string(daemonSet):             true,
+		string(replicationController): true,
+	},
+	string(replicaSet): {string(deployment): true},
+	string(job):        {"CronJob": true},
+}
+
+// isBuiltInKind tells whether the key is of the built-in kind of the same name, rather than of a custom
+// resource reusing the name.
+func isBuiltInKind(key ControllerKeyWithAPIVersion) bool {
+	group, found := builtInOwnerKinds[key.Kind]
+	return found && (key.ApiVersion == "" || apiGroup(key.ApiVersion) == group)
+}
+
+// checkOwnerKind validates the kind of the owner of the given controller, according to Options.OwnerKindValidation.
+func (f *controllerFetcher) checkOwnerKind(controller, owner ControllerKeyWithAPIVersion) error {
+	if f.ownerKindValidation == OwnerKindValidationOff || !isBuiltInKind(controller) || !isBuiltInKind(owner) {
+		return nil
+	}
+	if expectedBuiltInOwnerKinds[controller.Kind][owner.Kind] {
+		return nil
+	}
+	if f.ownerKindValidation == OwnerKindValidationStrict {
+		return fmt.Errorf("%w: %s %s/%s is owned by %s %s", ErrUnexpectedOwnerKind, controller.Kind,
+			controller.Namespace, controller.Name, owner.Kind, owner.Name)
+	}
+	klog.Warningf("%s %s/%s is owned by %s %s, which isn't expected to own it", controller.Kind, controller.Namespace,
+		controller.Name, owner.Kind, owner.Name)
+	return nil
+}
+
+// checkDeploymentOwners checks that the given controller, if it's a ReplicaSet, has a single Deployment as
+// controller owner. Several can be left behind by an operator adopting the ReplicaSet; the owner with the lowest
+// UID is followed then, unless Options.OwnerKindValidation is OwnerKindValidationStrict, which fails resolution
+// with ErrAmbiguousDeploymentOwner.
+func (f *controllerFetcher) checkDeploymentOwners(controller ControllerKeyWithAPIVersion, owners []metav1.OwnerReference) error {
+	if f.ownerKindValidation == OwnerKindValidationOff || controller.Kind != string(replicaSet) || !isBuiltInKind(controller) {
+		return nil
+	}
+	var names []string
+	for _, owner := range owners {
+		if owner.Controller != nil && *owner.Controller && owner.Kind == string(deployment) &&
+			isBuiltInKind(ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{Kind: owner.Kind}, ApiVersion: owner.APIVersion}) {
+			names = append(names, owner.Name)
+		}
+	}
+	if len(names) < 2 {
+		return nil
+	}
+	if f.ownerKindValidation == OwnerKindValidationStrict {
+		return fmt.Errorf("%w: %s %s/%s is controlled by Deployments %s", ErrAmbiguousDeploymentOwner, controller.Kind,
+			controller.Namespace, controller.Name, strings.Join(names, ", "))
+	}
+	klog.Warningf("%s %s/%s is controlled by Deployments %s, following the one with the lowest UID", controller.Kind,
+		controller.Namespace, controller.Name, strings.Join(names, ", "))
+	return nil
+}
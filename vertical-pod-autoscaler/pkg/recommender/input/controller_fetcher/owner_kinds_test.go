@@ -0,0 +1,152 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestOwnerKindValidation(t *testing.T) {
+	statefulSetKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-sts", Kind: "StatefulSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	deploymentKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	rolloutKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rollout", Kind: "Rollout", Namespace: "test-namespace"}, ApiVersion: "argoproj.io/v1alpha1"}
+
+	testCases := []struct {
+		name             string
+		owner            *ControllerKeyWithAPIVersion
+		validation       OwnerKindValidation
+		expectedTopLevel *ControllerKeyWithAPIVersion
+		expectedErr      error
+	}{
+		{name: "unexpected owner, off", owner: statefulSetKey, expectedTopLevel: statefulSetKey},
+		{name: "unexpected owner, warn", owner: statefulSetKey, validation: OwnerKindValidationWarn, expectedTopLevel: statefulSetKey},
+		{name: "unexpected owner, strict", owner: statefulSetKey, validation: OwnerKindValidationStrict, expectedErr: ErrUnexpectedOwnerKind},
+		{name: "expected owner, strict", owner: deploymentKey, validation: OwnerKindValidationStrict, expectedTopLevel: deploymentKey},
+		{name: "custom owner, strict", owner: rolloutKey, validation: OwnerKindValidationStrict, expectedTopLevel: rolloutKey},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rolloutKind := schema.GroupKind{Group: "argoproj.io", Kind: "Rollout"}
+			f := simpleControllerFetcher()
+			f.ownerKindValidation = tc.validation
+			f.customInformers = map[schema.GroupKind]cache.SharedIndexInformer{rolloutKind: newCustomInformer()}
+			f.customInformers[rolloutKind].GetStore().Add(newUnstructured("argoproj.io/v1alpha1", "Rollout", "test-namespace", "test-rollout"))
+			addController(f, &appsv1.ReplicaSet{
+				TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-rs",
+					Namespace: "test-namespace",
+					OwnerReferences: []metav1.OwnerReference{
+						{APIVersion: tc.owner.ApiVersion, Kind: tc.owner.Kind, Name: tc.owner.Name, Controller: &trueVar},
+					},
+				},
+			})
+			addController(f, &appsv1.StatefulSet{
+				TypeMeta:   metav1.TypeMeta{Kind: "StatefulSet"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-sts", Namespace: "test-namespace"},
+			})
+			addController(f, &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+			})
+
+			topLevel, err := f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"})
+			if tc.expectedErr != nil {
+				assert.True(t, errors.Is(err, tc.expectedErr), "unexpected error: %v", err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedTopLevel, topLevel)
+		})
+	}
+}
+
+func TestOwnerKindValidationOfPods(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.ownerKindValidation = OwnerKindValidationStrict
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "test-pod",
+		Namespace: "test-namespace",
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", Controller: &trueVar},
+		},
+	}}
+
+	_, err := f.FindTopLevelForPod(context.Background(), pod)
+	assert.True(t, errors.Is(err, ErrUnexpectedOwnerKind), "unexpected error: %v", err)
+}
+
+func TestReplicaSetAdoptedByTwoDeployments(t *testing.T) {
+	f := simpleControllerFetcher()
+	for _, name := range []string{"old-deployment", "new-deployment"} {
+		addController(f, &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+		})
+	}
+	// The new Deployment adopted the ReplicaSet without the old owner reference being removed.
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "new-deployment", UID: "uid-2", Controller: &trueVar},
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "old-deployment", UID: "uid-1", Controller: &trueVar},
+			},
+		},
+	})
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "test-pod",
+		Namespace: "test-namespace",
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "test-rs", Controller: &trueVar},
+		},
+	}}
+
+	for _, validation := range []OwnerKindValidation{OwnerKindValidationOff, OwnerKindValidationWarn} {
+		f.ownerKindValidation = validation
+		for i := 0; i < 3; i++ {
+			topLevel, err := f.FindTopLevelForPod(context.Background(), pod)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "old-deployment", topLevel.Name)
+			}
+		}
+	}
+
+	f.ownerKindValidation = OwnerKindValidationStrict
+	_, err := f.FindTopLevelForPod(context.Background(), pod)
+	assert.True(t, errors.Is(err, ErrAmbiguousDeploymentOwner), "unexpected error: %v", err)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func (f *controllerFetcher) FindTopLevelForPodName(ctx context.Context, namespace, name string) (*ControllerKeyWithAPIVersion, error) {
+	podKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{Namespace: namespace, Kind: "Pod", Name: name}, ApiVersion: "v1"}
+	fail := func(err error) (*ControllerKeyWithAPIVersion, error) {
+		f.notifyAnswered(ctx, podKey, nil, err)
+		return nil, err
+	}
+	if f.podInformer == nil {
+		return fail(fmt.Errorf("%w: can't read Pod %s/%s", ErrPodInformerDisabled, namespace, name))
+	}
+	obj, exists, err := f.podInformer.GetStore().GetByKey(storeKey(namespace, name))
+	if err != nil {
+		return fail(err)
+	}
+	if !exists {
+		return fail(fmt.Errorf("Pod %s/%s %w", namespace, name, ErrControllerNotFound))
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return fail(fmt.Errorf("%w: Pod %s/%s is a %T", ErrUnreadableOwnerObject, namespace, name, obj))
+	}
+	return f.FindTopLevelForPod(ctx, pod)
+}
+
+// findPodByUID returns the Pod with the given UID in the given namespace, which is ignored if empty. It
+// returns nil if there's no Pod informer or the Pod isn't in it.
+func (f *controllerFetcher) findPodByUID(namespace string, uid types.UID) *corev1.Pod {
+	if f.podInformer == nil {
+		return nil
+	}
+	objs, err := f.podInformer.GetIndexer().ByIndex(uidIndex, string(uid))
+	if err != nil {
+		return nil
+	}
+	for _, obj := range objs {
+		if pod, ok := obj.(*corev1.Pod); ok && (namespace == "" || pod.Namespace == namespace) {
+			return pod
+		}
+	}
+	return nil
+}
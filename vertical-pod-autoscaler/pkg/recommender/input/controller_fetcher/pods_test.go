@@ -0,0 +1,210 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWatchPods(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+			UID:       "pod-uid",
+			OwnerReferences: []metav1.OwnerReference{
+				{Controller: &trueVar, Kind: "ReplicaSet", Name: "test-rs"},
+			},
+		},
+	}, &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{Controller: &trueVar, Kind: "Deployment", Name: "test-deployment"},
+			},
+		},
+	}, &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	expected := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+
+	f := NewControllerFetcherWithClients(kubeClient.Discovery(), kubeClient, informers.NewSharedInformerFactory(kubeClient, 0),
+		Options{WatchPods: true})
+	defer f.Stop()
+	topLevel, err := f.FindTopLevelForPodName(context.Background(), "test-namespace", "test-pod")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, topLevel)
+	topLevel, err = f.FindTopLevelByUID(context.Background(), "test-namespace", "pod-uid")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, topLevel)
+	_, err = f.FindTopLevelForPodName(context.Background(), "test-namespace", "missing-pod")
+	assert.True(t, errors.Is(err, ErrControllerNotFound), "unexpected error: %v", err)
+
+	// Pods aren't watched by default.
+	f = NewControllerFetcherWithClients(kubeClient.Discovery(), kubeClient, informers.NewSharedInformerFactory(kubeClient, 0),
+		Options{})
+	defer f.Stop()
+	_, err = f.FindTopLevelForPodName(context.Background(), "test-namespace", "test-pod")
+	assert.True(t, errors.Is(err, ErrPodInformerDisabled), "unexpected error: %v", err)
+	_, err = f.FindTopLevelByUID(context.Background(), "test-namespace", "pod-uid")
+	assert.True(t, errors.Is(err, ErrUIDNotFound), "unexpected error: %v", err)
+}
+
+func TestFindTopLevelForStandalonePod(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+			// Owners which aren't controllers don't make the Pod controlled.
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "v1", Kind: "ConfigMap", Name: "test-config"},
+			},
+		},
+	}
+	f := simpleControllerFetcher()
+
+	_, err := f.FindTopLevelForPod(context.Background(), pod)
+	assert.EqualError(t, err, "pod has no controller: Pod test-namespace/test-pod")
+	assert.True(t, errors.Is(err, ErrNoController))
+
+	f.allowStandalonePods = true
+	topLevel, err := f.FindTopLevelForPod(context.Background(), pod)
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-pod", Kind: "Pod", Namespace: "test-namespace"}, ApiVersion: "v1"}, topLevel)
+}
+
+func TestFindTopLevelDetailedForStatefulSetPod(t *testing.T) {
+	f := simpleControllerFetcher()
+	addController(f, &appsv1.StatefulSet{
+		TypeMeta:   metav1.TypeMeta{Kind: "StatefulSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-sts", Namespace: "test-namespace"},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta:   metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-sts", Namespace: "test-namespace"},
+	})
+	ordinal := func(i int) *int { return &i }
+	testCases := []struct {
+		podName, ownerKind string
+		expected           *int
+	}{
+		{podName: "test-sts-0", ownerKind: "StatefulSet", expected: ordinal(0)},
+		{podName: "test-sts-12", ownerKind: "StatefulSet", expected: ordinal(12)},
+		{podName: "test-sts-x", ownerKind: "StatefulSet"},
+		{podName: "test-sts-01", ownerKind: "StatefulSet"},
+		{podName: "test-sts--1", ownerKind: "StatefulSet"},
+		{podName: "other-sts-1", ownerKind: "StatefulSet"},
+		{podName: "test-sts-1", ownerKind: "ReplicaSet"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.podName+"/"+tc.ownerKind, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name:      tc.podName,
+				Namespace: "test-namespace",
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: tc.ownerKind, Name: "test-sts", Controller: &trueVar},
+				},
+			}}
+			result, err := f.FindTopLevelDetailedForPod(context.Background(), pod)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "test-sts", result.TopLevel.Name)
+				assert.Equal(t, tc.expected, result.StatefulSetOrdinal)
+			}
+		})
+	}
+}
+
+func TestFindTopLevelDetailedForIndexedJobPod(t *testing.T) {
+	f := simpleControllerFetcher()
+	addController(f, &batchv1.Job{
+		TypeMeta:   metav1.TypeMeta{Kind: "Job"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-job", Namespace: "test-namespace"},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta:   metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-job", Namespace: "test-namespace"},
+	})
+	index := func(i int) *int { return &i }
+	testCases := []struct {
+		name        string
+		owner       metav1.OwnerReference
+		annotations map[string]string
+		labels      map[string]string
+		expected    *int
+	}{
+		{
+			name:        "annotated",
+			owner:       metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job"},
+			annotations: map[string]string{JobCompletionIndexKey: "3"},
+			expected:    index(3),
+		},
+		{
+			name:     "labeled",
+			owner:    metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job"},
+			labels:   map[string]string{JobCompletionIndexKey: "0"},
+			expected: index(0),
+		},
+		{
+			name:  "non-indexed",
+			owner: metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job"},
+		},
+		{
+			name:        "malformed",
+			owner:       metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job"},
+			annotations: map[string]string{JobCompletionIndexKey: "03"},
+		},
+		{
+			name:        "not owned by a Job",
+			owner:       metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet"},
+			annotations: map[string]string{JobCompletionIndexKey: "3"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			owner := tc.owner
+			owner.Name = "test-job"
+			owner.Controller = &trueVar
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name:            "test-job-abcde",
+				Namespace:       "test-namespace",
+				Annotations:     tc.annotations,
+				Labels:          tc.labels,
+				OwnerReferences: []metav1.OwnerReference{owner},
+			}}
+			result, err := f.FindTopLevelDetailedForPod(context.Background(), pod)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "test-job", result.TopLevel.Name)
+				assert.Equal(t, tc.expected, result.CompletionIndex)
+				assert.Nil(t, result.StatefulSetOrdinal)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+// ResolutionPath is a way of reading a controller during resolution.
+type ResolutionPath string
+
+const (
+	// InformerPath reads the controller from an informer. Fetchers without informers read well-known
+	// controllers from the API server instead.
+	InformerPath ResolutionPath = "informer"
+	// ScalePath reads the controller through its scale subresource.
+	ScalePath ResolutionPath = "scale"
+	// TerminalPath treats the controller as top level without reading it.
+	TerminalPath ResolutionPath = "terminal"
+	// DynamicPath reads the controller with the dynamic client. It's used for kinds without a scale
+	// subresource, like those of Knative Serving.
+	DynamicPath ResolutionPath = "dynamic"
+)
+
+// ResolutionPolicy decides, for each controller met during resolution, how to read it.
+type ResolutionPolicy interface {
+	// ResolutionPath returns the way to read the given controller. hasInformer tells whether the fetcher
+	// is able to read the controller's kind through InformerPath.
+	ResolutionPath(controller ControllerKeyWithAPIVersion, hasInformer bool) ResolutionPath
+}
+
+// DefaultResolutionPolicy reads controllers from informers when possible and through the scale
+// subresource otherwise.
+type DefaultResolutionPolicy struct{}
+
+// ResolutionPath implements ResolutionPolicy.
+func (DefaultResolutionPolicy) ResolutionPath(controller ControllerKeyWithAPIVersion, hasInformer bool) ResolutionPath {
+	if hasInformer {
+		return InformerPath
+	}
+	return ScalePath
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// terminalDeploymentsPolicy treats Deployments as top level, delegating everything else to DefaultResolutionPolicy.
+type terminalDeploymentsPolicy struct {
+	DefaultResolutionPolicy
+}
+
+func (p terminalDeploymentsPolicy) ResolutionPath(controller ControllerKeyWithAPIVersion, hasInformer bool) ResolutionPath {
+	if controller.Kind == "Deployment" {
+		return TerminalPath
+	}
+	return p.DefaultResolutionPolicy.ResolutionPath(controller, hasInformer)
+}
+
+func TestCustomResolutionPolicy(t *testing.T) {
+	f := simpleControllerFetcher()
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{Controller: &trueVar, Kind: "Deployment", Name: "test-deployment"},
+			},
+		},
+	})
+	// The Deployment is missing from the informer, which is fine as long as it doesn't need to be read.
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}}
+	expected := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+
+	_, err := f.FindTopLevel(key)
+	assert.Error(t, err)
+
+	f.resolutionPolicy = terminalDeploymentsPolicy{}
+	topLevel, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, topLevel)
+}
+
+func TestDefaultResolutionPolicy(t *testing.T) {
+	key := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{Name: "test", Kind: "Widget", Namespace: "test-namespace"}}
+	assert.Equal(t, InformerPath, DefaultResolutionPolicy{}.ResolutionPath(key, true))
+	assert.Equal(t, ScalePath, DefaultResolutionPolicy{}.ResolutionPath(key, false))
+}
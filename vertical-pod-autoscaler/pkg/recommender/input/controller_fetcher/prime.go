@@ -0,0 +1,69 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/klog"
+)
+
+const (
+	// primeCacheWorkers is the number of controllers PrimeCache and FindTopLevelBatch resolve at the same time
+	// if neither the number of concurrent resolutions nor reads is limited.
+	primeCacheWorkers = 10
+)
+
+// resolutionWorkers returns the number of controllers to resolve at the same time when resolving many.
+func (f *controllerFetcher) resolutionWorkers() int {
+	if f.resolutionLimiter != nil {
+		return cap(f.resolutionLimiter)
+	}
+	if f.readLimiter != nil {
+		return f.readLimiter.size
+	}
+	return primeCacheWorkers
+}
+
+func (f *controllerFetcher) PrimeCache(ctx context.Context, keys []ControllerKeyWithAPIVersion) {
+	workers := f.resolutionWorkers()
+	queue := make(chan ControllerKeyWithAPIVersion)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range queue {
+				if _, err := f.FindTopLevelWithContext(ctx, &key); err != nil {
+					klog.Warningf("Failed to prime top level controller of %s %s/%s: %v", key.Kind, key.Namespace, key.Name, err)
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(queue)
+		wg.Wait()
+	}()
+	for _, key := range keys {
+		select {
+		case queue <- key:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
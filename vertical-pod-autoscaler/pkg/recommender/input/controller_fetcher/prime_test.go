@@ -0,0 +1,83 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPrimeCache(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.resolutionCache = newResolutionCache(time.Minute)
+	f.resolutionLimiter = newLimiter(2)
+	var keys []ControllerKeyWithAPIVersion
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("test-deployment-%d", i)
+		addController(f, &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+		})
+		keys = append(keys, ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: name, Kind: "Deployment", Namespace: "test-namespace"}})
+	}
+	// Failures don't stop priming.
+	missingKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	keys = append([]ControllerKeyWithAPIVersion{missingKey}, keys...)
+
+	f.PrimeCache(context.Background(), keys)
+	for _, key := range keys[1:] {
+		result, found := f.resolutionCache.get(key, time.Now())
+		if assert.True(t, found, "%s not cached", key.Name) {
+			assert.Equal(t, key, *result.TopLevel)
+		}
+	}
+	_, found := f.resolutionCache.get(missingKey, time.Now())
+	assert.False(t, found)
+}
+
+func TestMaxConcurrentResolutions(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.resolutionLimiter = newLimiter(1)
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+
+	// Resolutions wait for a free slot within their context, even if they only read informers.
+	assert.NoError(t, f.resolutionLimiter.acquire(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := f.FindTopLevelWithContext(ctx, key)
+	assert.True(t, errors.Is(err, ErrResolutionTimeout), "unexpected error: %v", err)
+
+	f.resolutionLimiter.release()
+	topLevel, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, topLevel)
+}
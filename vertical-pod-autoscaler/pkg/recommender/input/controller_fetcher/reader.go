@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ObjectReader reads objects by their namespace and name into the given typed object, failing with a NotFound
+// API error if they don't exist. Its method matches Get of controller-runtime's client.Reader in versions
+// taking a runtime.Object, so a controller-runtime cache.Cache or client can be passed as is. Newer versions
+// need a wrapper converting the object to a client.Object.
+type ObjectReader interface {
+	Get(ctx context.Context, key types.NamespacedName, obj runtime.Object) error
+}
+
+// newWellKnownObject returns an empty object of the given well-known kind.
+func newWellKnownObject(kind wellKnownController) (runtime.Object, error) {
+	switch kind {
+	case daemonSet:
+		return &appsv1.DaemonSet{}, nil
+	case deployment:
+		return &appsv1.Deployment{}, nil
+	case statefulSet:
+		return &appsv1.StatefulSet{}, nil
+	case replicaSet:
+		return &appsv1.ReplicaSet{}, nil
+	case job:
+		return &batchv1.Job{}, nil
+	case replicationController:
+		return &corev1.ReplicationController{}, nil
+	}
+	return nil, fmt.Errorf("%s is not a well-known controller", kind)
+}
+
+func (f *controllerFetcher) getWellKnownControllerFromReader(ctx context.Context, controllerKey ControllerKeyWithAPIVersion) (*controllerObject, error) {
+	obj, err := newWellKnownObject(wellKnownController(controllerKey.Kind))
+	if err != nil {
+		return nil, err
+	}
+	err = f.reader.Get(ctx, types.NamespacedName{Namespace: controllerKey.Namespace, Name: controllerKey.Name}, obj)
+	if k8serrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%s %s/%s %w", controllerKey.Kind, controllerKey.Namespace, controllerKey.Name, ErrControllerNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newWellKnownControllerObject(obj, controllerKey)
+}
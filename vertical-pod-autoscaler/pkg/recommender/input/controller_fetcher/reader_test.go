@@ -0,0 +1,85 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeObjectReader is an ObjectReader serving the given objects, like the cache of a controller-runtime manager.
+type fakeObjectReader struct {
+	objects []runtime.Object
+	// requestIDs are the request IDs of the contexts of Gets, in order.
+	requestIDs []string
+}
+
+func (r *fakeObjectReader) Get(ctx context.Context, key types.NamespacedName, obj runtime.Object) error {
+	requestID, _ := RequestIDFromContext(ctx)
+	r.requestIDs = append(r.requestIDs, requestID)
+	for _, stored := range r.objects {
+		accessor := stored.(metav1.Object)
+		if reflect.TypeOf(stored) == reflect.TypeOf(obj) && accessor.GetNamespace() == key.Namespace && accessor.GetName() == key.Name {
+			reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(stored).Elem())
+			return nil
+		}
+	}
+	return k8serrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func TestNewControllerFetcherWithReader(t *testing.T) {
+	reader := &fakeObjectReader{objects: []runtime.Object{
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-rs",
+				Namespace: "test-namespace",
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", Controller: &trueVar},
+				},
+			},
+		},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"}},
+	}}
+	// The API server doesn't have the controllers, they can only be read through the reader.
+	kubeClient := fake.NewSimpleClientset()
+	f := NewControllerFetcherWithReader(kubeClient.Discovery(), kubeClient, reader, Options{})
+	defer f.Stop()
+	assert.Empty(t, f.(*controllerFetcher).informersMap)
+
+	topLevel, err := f.FindTopLevelWithContext(WithRequestID(context.Background(), "test-request"), &ControllerKeyWithAPIVersion{
+		ControllerKey: ControllerKey{Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}, topLevel)
+	// Reads get the context of the resolution.
+	assert.Equal(t, []string{"test-request", "test-request"}, reader.requestIDs)
+
+	_, err = f.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"})
+	assert.EqualError(t, err, "ReplicaSet test-namespace/missing-rs does not exist")
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// DefaultRecentErrorsSize is the number of errors RecentErrors returns if Options.RecentErrorsSize isn't set.
+const DefaultRecentErrorsSize = 100
+
+// RecentError is a failed resolution of a top level controller.
+type RecentError struct {
+	// Controller is the controller whose resolution failed.
+	Controller ControllerKeyWithAPIVersion
+	// Err is the error resolution failed with.
+	Err error
+	// Time is when the resolution failed.
+	Time time.Time
+}
+
+// recentErrors is a ring buffer of the last failed resolutions. Its zero value holds DefaultRecentErrorsSize
+// errors.
+type recentErrors struct {
+	mutex  sync.Mutex
+	size   int
+	errors []RecentError
+	next   int
+	full   bool
+}
+
+func (r *recentErrors) add(recentError RecentError) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.errors == nil {
+		if r.size <= 0 {
+			r.size = DefaultRecentErrorsSize
+		}
+		r.errors = make([]RecentError, r.size)
+	}
+	r.errors[r.next] = recentError
+	r.next = (r.next + 1) % r.size
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the errors, oldest first.
+func (r *recentErrors) list() []RecentError {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.full {
+		return append([]RecentError(nil), r.errors[:r.next]...)
+	}
+	return append(append(make([]RecentError, 0, r.size), r.errors[r.next:]...), r.errors[:r.next]...)
+}
+
+func (f *controllerFetcher) RecentErrors() []RecentError {
+	return f.recentErrors.list()
+}
+
+// recentErrorJSON is the JSON encoding of a RecentError.
+type recentErrorJSON struct {
+	Controller ControllerKeyWithAPIVersion `json:"controller"`
+	Error      string                      `json:"error"`
+	Time       time.Time                   `json:"time"`
+}
+
+// RecentErrorsHandler serves the recent errors of a fetcher as a JSON array, oldest first, for an admin
+// endpoint operators can check to see what fails to resolve.
+type RecentErrorsHandler struct {
+	fetcher ExtendedControllerFetcher
+}
+
+// NewRecentErrorsHandler constructs new RecentErrorsHandler.
+func NewRecentErrorsHandler(fetcher ExtendedControllerFetcher) *RecentErrorsHandler {
+	return &RecentErrorsHandler{fetcher: fetcher}
+}
+
+// ServeHTTP implements http.Handler interface.
+func (h *RecentErrorsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	recentErrors := h.fetcher.RecentErrors()
+	encoded := make([]recentErrorJSON, 0, len(recentErrors))
+	for _, recentError := range recentErrors {
+		encoded = append(encoded, recentErrorJSON{
+			Controller: recentError.Controller,
+			Error:      recentError.Err.Error(),
+			Time:       recentError.Time,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(encoded); err != nil {
+		klog.Errorf("Could not write recent errors: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentErrorsBuffer(t *testing.T) {
+	var r recentErrors
+	assert.Empty(t, r.list())
+	for i := 0; i < DefaultRecentErrorsSize+5; i++ {
+		r.add(RecentError{Err: fmt.Errorf("error %d", i)})
+	}
+	listed := r.list()
+	if assert.Len(t, listed, DefaultRecentErrorsSize) {
+		assert.EqualError(t, listed[0].Err, "error 5")
+		assert.EqualError(t, listed[DefaultRecentErrorsSize-1].Err, fmt.Sprintf("error %d", DefaultRecentErrorsSize+4))
+	}
+
+	small := recentErrors{size: 2}
+	for i := 0; i < 3; i++ {
+		small.add(RecentError{Err: fmt.Errorf("error %d", i)})
+	}
+	listed = small.list()
+	if assert.Len(t, listed, 2) {
+		assert.EqualError(t, listed[0].Err, "error 1")
+		assert.EqualError(t, listed[1].Err, "error 2")
+	}
+}
+
+func TestFindTopLevelRecordsErrors(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.resolutionCache = newResolutionCache(time.Minute)
+	f.resolutionCache.negativeTTL = time.Minute
+	key := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	// The second resolution is served from the cache.
+	for i := 0; i < 2; i++ {
+		_, err := f.FindTopLevel(&key)
+		assert.True(t, errors.Is(err, ErrControllerNotFound), "unexpected error: %v", err)
+	}
+
+	recentErrors := f.RecentErrors()
+	if assert.Len(t, recentErrors, 1) {
+		assert.Equal(t, key, recentErrors[0].Controller)
+		assert.True(t, errors.Is(recentErrors[0].Err, ErrControllerNotFound))
+		assert.False(t, recentErrors[0].Time.IsZero())
+	}
+
+	server := httptest.NewServer(NewRecentErrorsHandler(f))
+	defer server.Close()
+	response, err := http.Get(server.URL)
+	if assert.NoError(t, err) {
+		defer response.Body.Close()
+		var body []map[string]interface{}
+		assert.NoError(t, json.NewDecoder(response.Body).Decode(&body))
+		if assert.Len(t, body, 1) {
+			assert.Equal(t, recentErrors[0].Err.Error(), body[0]["error"])
+			assert.Equal(t, "missing-deployment", body[0]["controller"].(map[string]interface{})["Name"])
+		}
+	}
+	response, err = http.Post(server.URL, "application/json", nil)
+	if assert.NoError(t, err) {
+		response.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+	}
+}
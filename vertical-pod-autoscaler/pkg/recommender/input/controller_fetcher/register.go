@@ -0,0 +1,62 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func (f *controllerFetcher) RegisterController(groupKind schema.GroupKind, informer cache.SharedIndexInformer) error {
+	if _, exists := f.customInformer(groupKind); exists {
+		return fmt.Errorf("Informer of %s is already registered", groupKind)
+	}
+	// The informer participates in resolution only once it's synced.
+	addUIDIndexers(groupKind.String(), informer)
+	if !runInformer(groupKind.String(), informer, f.stopCh) {
+		return fmt.Errorf("Could not sync informer of %s", groupKind)
+	}
+	f.informersMutex.Lock()
+	defer f.informersMutex.Unlock()
+	if _, exists := f.customInformers[groupKind]; exists {
+		return fmt.Errorf("Informer of %s is already registered", groupKind)
+	}
+	customInformers := make(map[schema.GroupKind]cache.SharedIndexInformer, len(f.customInformers)+1)
+	for registered, registeredInformer := range f.customInformers {
+		customInformers[registered] = registeredInformer
+	}
+	customInformers[groupKind] = informer
+	f.customInformers = customInformers
+	return nil
+}
+
+// customInformer returns the custom informer of the given kind.
+func (f *controllerFetcher) customInformer(groupKind schema.GroupKind) (cache.SharedIndexInformer, bool) {
+	f.informersMutex.RLock()
+	defer f.informersMutex.RUnlock()
+	informer, exists := f.customInformers[groupKind]
+	return informer, exists
+}
+
+// getCustomInformers returns all custom informers. The returned map must not be modified.
+func (f *controllerFetcher) getCustomInformers() map[schema.GroupKind]cache.SharedIndexInformer {
+	f.informersMutex.RLock()
+	defer f.informersMutex.RUnlock()
+	return f.customInformers
+}
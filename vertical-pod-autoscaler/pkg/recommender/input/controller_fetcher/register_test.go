@@ -0,0 +1,86 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// TestRegisterControllerWhileResolving is meant to be run with -race.
+func TestRegisterControllerWhileResolving(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	mapper.Add(widgetKind.GroupVersion().WithKind("Gadget"), apimeta.RESTScopeNamespace)
+	widgets := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	// Only the informer knows the owner of the Widget.
+	scales := newFakeScalesGetter()
+	scales.add(widgets.GroupResource(), &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-widget", Namespace: "test-namespace"},
+	})
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "gadgets"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-gadget", Namespace: "test-namespace"},
+	})
+	dynamicClient := newFakeDynamicClient()
+	dynamicClient.add(widgets.GroupResource(), newUnstructured("example.com/v1", "Widget", "test-namespace", "test-widget",
+		metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "Gadget", Name: "test-gadget", Controller: &trueVar}))
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.stopCh = make(chan struct{})
+	defer f.Stop()
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				topLevel, err := f.FindTopLevel(key)
+				if assert.NoError(t, err) {
+					assert.Contains(t, []string{"test-widget", "test-gadget"}, topLevel.Name)
+				}
+			}
+		}()
+	}
+	informer := newDynamicInformer(dynamicClient, widgets)
+	assert.NoError(t, f.RegisterController(widgetKind.GroupKind(), informer))
+	close(done)
+	wg.Wait()
+
+	topLevel, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-gadget", topLevel.Name)
+	assert.Error(t, f.RegisterController(widgetKind.GroupKind(), newDynamicInformer(dynamicClient, widgets)))
+}
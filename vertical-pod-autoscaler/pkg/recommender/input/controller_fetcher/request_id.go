@@ -0,0 +1,48 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// requestIDKey is the context key of request IDs.
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx tagging resolutions called with it with the given request ID, e.g. the
+// ID of the VPA reconcile triggering them. The ID is included in logs of the resolution, in its ResolveEvent
+// and in the context passed to the AuditSink.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID ctx was tagged with by WithRequestID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey{}).(string)
+	return requestID, ok && requestID != ""
+}
+
+// ensureRequestID returns ctx with its request ID, generating one if ctx isn't tagged with any.
+func ensureRequestID(ctx context.Context) (context.Context, string) {
+	if requestID, ok := RequestIDFromContext(ctx); ok {
+		return ctx, requestID
+	}
+	requestID := string(uuid.NewUUID())
+	return WithRequestID(ctx, requestID), requestID
+}
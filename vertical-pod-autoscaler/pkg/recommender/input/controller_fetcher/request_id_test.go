@@ -0,0 +1,120 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRequestIDFromContext(t *testing.T) {
+	_, found := RequestIDFromContext(context.Background())
+	assert.False(t, found)
+	_, found = RequestIDFromContext(WithRequestID(context.Background(), ""))
+	assert.False(t, found)
+	requestID, found := RequestIDFromContext(WithRequestID(context.Background(), "reconcile-1"))
+	assert.True(t, found)
+	assert.Equal(t, "reconcile-1", requestID)
+}
+
+func TestResolveEventRequestID(t *testing.T) {
+	f := simpleControllerFetcher()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	received := make(chan ResolveEvent, 10)
+	f.resolveEvents = newResolveEvents(func(event ResolveEvent) { received <- event }, 10, stopCh)
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	nextEvent := func() ResolveEvent {
+		select {
+		case event := <-received:
+			return event
+		case <-time.After(10 * time.Second):
+			t.Fatal("OnResolve not called")
+			return ResolveEvent{}
+		}
+	}
+
+	_, err := f.FindTopLevelWithContext(WithRequestID(context.Background(), "reconcile-1"), key)
+	assert.NoError(t, err)
+	assert.Equal(t, "reconcile-1", nextEvent().RequestID)
+
+	// Untagged resolutions get an ID of their own.
+	_, err = f.FindTopLevel(key)
+	assert.NoError(t, err)
+	first := nextEvent().RequestID
+	_, err = f.FindTopLevel(key)
+	assert.NoError(t, err)
+	second := nextEvent().RequestID
+	assert.NotEmpty(t, first)
+	assert.NotEmpty(t, second)
+	assert.NotEqual(t, first, second)
+}
+
+// requestIDAuditSink reports request IDs of the recorded resolutions.
+type requestIDAuditSink struct {
+	requestIDs chan string
+}
+
+func (s *requestIDAuditSink) Record(ctx context.Context, input, result ControllerKeyWithAPIVersion, err error) error {
+	requestID, _ := RequestIDFromContext(ctx)
+	s.requestIDs <- requestID
+	return nil
+}
+
+func TestAuditSinkRequestID(t *testing.T) {
+	f := simpleControllerFetcher()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	sink := &requestIDAuditSink{requestIDs: make(chan string, 1)}
+	f.auditEvents = newAuditEvents(sink, 1, false, stopCh)
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+
+	_, err := f.FindTopLevelWithContext(WithRequestID(context.Background(), "reconcile-1"), key)
+	assert.NoError(t, err)
+	select {
+	case requestID := <-sink.requestIDs:
+		assert.Equal(t, "reconcile-1", requestID)
+	case <-time.After(10 * time.Second):
+		t.Fatal("AuditSink not called")
+	}
+
+	var buffer bytes.Buffer
+	jsonSink := NewJSONLinesAuditSink(&buffer).(*jsonLinesAuditSink)
+	jsonSink.now = func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) }
+	assert.NoError(t, jsonSink.Record(WithRequestID(context.Background(), "reconcile-1"), *key, *key, nil))
+	assert.Equal(t,
+		`{"time":"2020-01-02T03:04:05Z","requestID":"reconcile-1","input":{"Namespace":"test-namespace","Kind":"Deployment","Name":"test-deployment","ApiVersion":"","ResourceVersion":""},`+
+			`"result":{"Namespace":"test-namespace","Kind":"Deployment","Name":"test-deployment","ApiVersion":"","ResourceVersion":""}}`+"\n",
+		buffer.String())
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// JobCompletionIndexKey is the annotation, and in newer clusters also the label, holding the completion index
+// of Pods of Indexed Jobs.
+const JobCompletionIndexKey = "batch.kubernetes.io/job-completion-index"
+
+// scalableWellKnownControllers are the well-known controllers which have a scale subresource.
+var scalableWellKnownControllers = map[wellKnownController]bool{
+	deployment:            true,
+	replicaSet:            true,
+	statefulSet:           true,
+	replicationController: true,
+}
+
+// FindTopLevelResult describes a resolved top level controller.
+type FindTopLevelResult struct {
+	// TopLevel is the top level controller.
+	TopLevel *ControllerKeyWithAPIVersion
+	// Scalable is true if the top level controller has a scale subresource. It's only known for controllers read
+	// through the scale subresource and well-known controllers, others are reported as not scalable.
+	Scalable bool
+	// HopCount is the number of owners followed to get to the top level controller.
+	HopCount int
+	// ResolvedVia is the resolution path the top level controller was read with, see ResolutionPath.
+	ResolvedVia string
+	// Paused is true if the top level controller is a paused Deployment. It's false for other kinds. Like the
+	// rest of the result it's cached, so it may be stale by up to Options.ResolutionCacheTTL.
+	Paused bool
+	// InferredOwner is true if an owner on the way to the top level controller was followed only because it
+	// blocks deletion of the controller it owns, see Options.BlockOwnerDeletionAsController, or because it's
+	// named in the metadata of a Job, see Options.InferCronJobFromLabels.
+	InferredOwner bool
+	// Terminating is true if the top level controller is being deleted (its deletionTimestamp is set), e.g.
+	// waiting for finalizers. It's false for controllers which weren't read, see TerminalKinds.
+	Terminating bool
+	// StatefulSetOrdinal is the ordinal of the Pod resolution started from, parsed from its name
+	// (<StatefulSet>-<ordinal>), if the Pod is owned by a StatefulSet. It's only set by
+	// FindTopLevelDetailedForPod and isn't cached.
+	StatefulSetOrdinal *int
+	// CompletionIndex is the completion index of the Pod resolution started from, if the Pod is owned by an
+	// Indexed Job, parsed from its JobCompletionIndexKey annotation or label. It's only set by
+	// FindTopLevelDetailedForPod and isn't cached.
+	CompletionIndex *int
+}
+
+// copyResult returns a copy of the given result which shares nothing with it.
+func copyResult(result *FindTopLevelResult) *FindTopLevelResult {
+	if result == nil {
+		return nil
+	}
+	copied := *result
+	copied.TopLevel = copyKey(result.TopLevel)
+	if result.StatefulSetOrdinal != nil {
+		ordinal := *result.StatefulSetOrdinal
+		copied.StatefulSetOrdinal = &ordinal
+	}
+	if result.CompletionIndex != nil {
+		index := *result.CompletionIndex
+		copied.CompletionIndex = &index
+	}
+	return &copied
+}
+
+func (f *controllerFetcher) newFindTopLevelResult(res *resolution) *FindTopLevelResult {
+	return &FindTopLevelResult{
+		TopLevel:      f.withPreferredVersion(res.topLevel, res.hintedTopLevel),
+		Scalable:      f.isScalable(*res.topLevel, res.controller),
+		HopCount:      res.hops,
+		ResolvedVia:   string(res.controller.path),
+		Paused:        isPausedDeployment(res.controller),
+		InferredOwner: res.inferredOwner,
+		Terminating:   isTerminating(res.controller),
+	}
+}
+
+// withPreferredVersion returns the given key with the API version the server prefers for its kind, unless
+// Options.PreserveOwnerAPIVersion is set. Owner references keep the version their owner was created with,
+// which may since have been deprecated. Keys of kinds the mapper doesn't know, and hinted ones (see
+// Options.ResolutionHints), are returned as they are.
+func (f *controllerFetcher) withPreferredVersion(key *ControllerKeyWithAPIVersion, hinted bool) *ControllerKeyWithAPIVersion {
+	if f.preserveOwnerAPIVersion || hinted || f.mapper == nil || key.ApiVersion == "" {
+		return key
+	}
+	groupVersion, err := schema.ParseGroupVersion(key.ApiVersion)
+	if err != nil {
+		return key
+	}
+	mapping, err := f.mapper.RESTMapping(schema.GroupKind{Group: groupVersion.Group, Kind: key.Kind})
+	if err != nil {
+		return key
+	}
+	preferred := mapping.GroupVersionKind.GroupVersion().String()
+	if preferred == key.ApiVersion {
+		return key
+	}
+	normalized := *key
+	normalized.ApiVersion = preferred
+	return &normalized
+}
+
+// isPausedDeployment tells whether the given controller is a Deployment with spec.paused set.
+func isPausedDeployment(controller *controllerObject) bool {
+	deployment, ok := controller.object.(*appsv1.Deployment)
+	return ok && deployment.Spec.Paused
+}
+
+// statefulSetOrdinal returns the ordinal of the Pod with the given name if its owner is a StatefulSet whose name
+// prefixes it, nil otherwise. The owner must be canonical.
+func statefulSetOrdinal(podName string, owner ControllerKeyWithAPIVersion) *int {
+	if owner.Kind != string(statefulSet) || apiGroup(owner.ApiVersion) != appsv1.GroupName {
+		return nil
+	}
+	prefix := owner.Name + "-"
+	if !strings.HasPrefix(podName, prefix) {
+		return nil
+	}
+	return parseIndex(podName[len(prefix):])
+}
+
+// jobCompletionIndex returns the completion index of the given Pod if its owner is a Job and the Pod has a
+// JobCompletionIndexKey annotation or label, as Pods of Indexed Jobs do, nil otherwise. The owner must be
+// canonical.
+func jobCompletionIndex(pod *corev1.Pod, owner ControllerKeyWithAPIVersion) *int {
+	if owner.Kind != string(job) || apiGroup(owner.ApiVersion) != batchv1.GroupName {
+		return nil
+	}
+	index, found := pod.Annotations[JobCompletionIndexKey]
+	if !found {
+		index, found = pod.Labels[JobCompletionIndexKey]
+	}
+	if !found {
+		return nil
+	}
+	return parseIndex(index)
+}
+
+// parseIndex parses a StatefulSet ordinal or a completion index, which are formatted without sign or leading
+// zeros. It returns nil if the given string isn't one.
+func parseIndex(s string) *int {
+	index, err := strconv.Atoi(s)
+	if err != nil || index < 0 || strconv.Itoa(index) != s {
+		return nil
+	}
+	return &index
+}
+
+// isTerminating tells whether the given controller is being deleted.
+func isTerminating(controller *controllerObject) bool {
+	if controller.object == nil {
+		return false
+	}
+	accessor, err := apimeta.Accessor(controller.object)
+	return err == nil && accessor.GetDeletionTimestamp() != nil
+}
+
+// isScalable tells whether the given controller has a scale subresource. Only controllers read through the
+// scale subresource and well-known controllers read from their informers are known to have one.
+func (f *controllerFetcher) isScalable(key ControllerKeyWithAPIVersion, controller *controllerObject) bool {
+	switch controller.path {
+	case ScalePath:
+		return true
+	case InformerPath:
+		groupVersion, err := schema.ParseGroupVersion(key.ApiVersion)
+		if err != nil {
+			return false
+		}
+		if _, exists := f.customInformer(schema.GroupKind{Group: groupVersion.Group, Kind: key.Kind}); exists {
+			return false
+		}
+		return scalableWellKnownControllers[wellKnownController(key.Kind)]
+	}
+	return false
+}
+
+func (f *controllerFetcher) FindScalableAncestor(ctx context.Context, key *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error) {
+	if key == nil {
+		return nil, nil
+	}
+	res, err := f.findAncestor(ctx, key, f.isScalable)
+	if err != nil {
+		return nil, err
+	}
+	if !res.stopped {
+		return nil, fmt.Errorf("%w: reached top level %s %s/%s", ErrNoScalableAncestor,
+			res.topLevel.Kind, res.topLevel.Namespace, res.topLevel.Name)
+	}
+	return res.topLevel, nil
+}
@@ -0,0 +1,332 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFindTopLevelDetailed(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "widgets"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-widget", Namespace: "test-namespace"},
+	})
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.resolutionCache = newResolutionCache(time.Minute)
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", Controller: &trueVar},
+			},
+		},
+	})
+	addController(f, &appsv1.DaemonSet{
+		TypeMeta:   metav1.TypeMeta{Kind: "DaemonSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ds", Namespace: "test-namespace"},
+	})
+
+	testCases := []struct {
+		name     string
+		key      ControllerKeyWithAPIVersion
+		expected FindTopLevelResult
+	}{
+		{
+			name: "deployment through replica set",
+			key: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}},
+			expected: FindTopLevelResult{
+				TopLevel: &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+					Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"},
+				Scalable:    true,
+				HopCount:    1,
+				ResolvedVia: "informer",
+			},
+		},
+		{
+			name: "daemon set",
+			key: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-ds", Kind: "DaemonSet", Namespace: "test-namespace"}},
+			expected: FindTopLevelResult{
+				TopLevel: &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+					Name: "test-ds", Kind: "DaemonSet", Namespace: "test-namespace"}},
+				ResolvedVia: "informer",
+			},
+		},
+		{
+			name: "custom resource with scale subresource",
+			key: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"},
+			expected: FindTopLevelResult{
+				TopLevel: &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+					Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"},
+				Scalable:    true,
+				ResolvedVia: "scale",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := f.FindTopLevelDetailed(context.Background(), &tc.key)
+			assert.NoError(t, err)
+			assert.Equal(t, &tc.expected, result)
+			// Cached results carry the same details.
+			result, err = f.FindTopLevelDetailed(context.Background(), &tc.key)
+			assert.NoError(t, err)
+			assert.Equal(t, &tc.expected, result)
+		})
+	}
+
+	result, err := f.FindTopLevelDetailed(context.Background(), &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-ds", Kind: "DaemonSet", Namespace: "test-namespace"}})
+	assert.Error(t, err)
+	assert.Nil(t, result)
+}
+
+func TestFindScalableAncestor(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	gadgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Gadget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	mapper.Add(gadgetKind, apimeta.RESTScopeNamespace)
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "widgets"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-widget",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "example.com/v1", Kind: "Gadget", Name: "test-gadget", Controller: &trueVar},
+			},
+		},
+	})
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "gadgets"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-gadget", Namespace: "test-namespace"},
+	})
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	addController(f, &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{Kind: "Job"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-job",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "example.com/v1", Kind: "Widget", Name: "test-widget", Controller: &trueVar},
+			},
+		},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", Controller: &trueVar},
+			},
+		},
+	})
+	addController(f, &appsv1.DaemonSet{
+		TypeMeta:   metav1.TypeMeta{Kind: "DaemonSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ds", Namespace: "test-namespace"},
+	})
+	jobKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-job", Kind: "Job", Namespace: "test-namespace"}, ApiVersion: "batch/v1"}
+
+	// Resolution stops at the Widget, while the top level is the Gadget owning it.
+	ancestor, err := f.FindScalableAncestor(context.Background(), jobKey)
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}, ancestor)
+	topLevel, err := f.FindTopLevel(jobKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-gadget", topLevel.Name)
+
+	// Scalable controllers are their own nearest scalable ancestor.
+	rsKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	ancestor, err = f.FindScalableAncestor(context.Background(), rsKey)
+	assert.NoError(t, err)
+	assert.Equal(t, rsKey, ancestor)
+
+	_, err = f.FindScalableAncestor(context.Background(), &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-ds", Kind: "DaemonSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"})
+	assert.True(t, errors.Is(err, ErrNoScalableAncestor), "unexpected error: %v", err)
+}
+
+func TestFindTopLevelDetailedPaused(t *testing.T) {
+	f := simpleControllerFetcher()
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "paused-deployment", Namespace: "test-namespace"},
+		Spec:       appsv1.DeploymentSpec{Paused: true},
+	})
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "paused-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "paused-deployment", Controller: &trueVar},
+			},
+		},
+	})
+	addController(f, &appsv1.DaemonSet{
+		TypeMeta:   metav1.TypeMeta{Kind: "DaemonSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ds", Namespace: "test-namespace"},
+	})
+
+	testCases := []struct {
+		kind, name string
+		paused     bool
+	}{
+		{kind: "ReplicaSet", name: "paused-rs", paused: true},
+		{kind: "Deployment", name: "paused-deployment", paused: true},
+		{kind: "Deployment", name: "test-deployment", paused: false},
+		{kind: "DaemonSet", name: "test-ds", paused: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := f.FindTopLevelDetailed(context.Background(), &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: tc.name, Kind: tc.kind, Namespace: "test-namespace"}, ApiVersion: "apps/v1"})
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.paused, result.Paused)
+			}
+		})
+	}
+}
+
+func TestFindTopLevelDetailedTerminating(t *testing.T) {
+	f := simpleControllerFetcher()
+	deleted := metav1.NewTime(time.Now())
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "deleted-deployment", Namespace: "test-namespace", DeletionTimestamp: &deleted},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "deleted-rs",
+			Namespace:         "test-namespace",
+			DeletionTimestamp: &deleted,
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "deleted-deployment", Controller: &trueVar},
+			},
+		},
+	})
+	// The Deployment is being deleted with the orphan policy, its ReplicaSet stays.
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "live-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "deleted-deployment", Controller: &trueVar},
+			},
+		},
+	})
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+
+	testCases := []struct {
+		kind, name  string
+		terminating bool
+		rejected    bool
+	}{
+		{kind: "ReplicaSet", name: "deleted-rs", terminating: true, rejected: true},
+		{kind: "Deployment", name: "deleted-deployment", terminating: true, rejected: true},
+		{kind: "ReplicaSet", name: "live-rs", terminating: true, rejected: false},
+		{kind: "Deployment", name: "test-deployment", terminating: false, rejected: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: tc.name, Kind: tc.kind, Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+			f.rejectTerminatingTargets = false
+			result, err := f.FindTopLevelDetailed(context.Background(), key)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.terminating, result.Terminating)
+			}
+
+			f.rejectTerminatingTargets = true
+			_, err = f.FindTopLevelDetailed(context.Background(), key)
+			if tc.rejected {
+				assert.True(t, errors.Is(err, ErrTargetTerminating), "unexpected error: %v", err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFindTopLevelPreferredVersion(t *testing.T) {
+	widgetsV1beta1 := schema.GroupVersionKind{Group: "example.com", Version: "v1beta1", Kind: "Widget"}
+	widgetsV1 := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetsV1.GroupVersion(), widgetsV1beta1.GroupVersion()})
+	mapper.Add(widgetsV1beta1, apimeta.RESTScopeNamespace)
+	mapper.Add(widgetsV1, apimeta.RESTScopeNamespace)
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "widgets"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-widget", Namespace: "test-namespace"},
+	})
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	// The Widget was created in a version which has since been deprecated.
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1beta1"}
+
+	topLevel, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com/v1", topLevel.ApiVersion)
+	assert.Equal(t, "example.com/v1beta1", key.ApiVersion)
+
+	f.preserveOwnerAPIVersion = true
+	topLevel, err = f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, topLevel)
+}
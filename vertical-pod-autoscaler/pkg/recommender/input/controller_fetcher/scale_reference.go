@@ -0,0 +1,54 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// scaleSubresourceSuffix is the suffix of kinds referring to the scale subresource of a resource.
+const scaleSubresourceSuffix = "/scale"
+
+// parentOfScaleReference returns the key of the resource the scale subresource referred to by the given key
+// belongs to, e.g. Deployment for a Kind of "deployments/scale" or "Deployment/scale". Other keys are returned
+// unchanged. The parent is mapped with the RESTMapper if it's a resource, its API version is taken from the
+// RESTMapper if the key has none.
+func (f *controllerFetcher) parentOfScaleReference(key ControllerKeyWithAPIVersion) ControllerKeyWithAPIVersion {
+	if len(key.Kind) <= len(scaleSubresourceSuffix) || !strings.EqualFold(key.Kind[len(key.Kind)-len(scaleSubresourceSuffix):], scaleSubresourceSuffix) {
+		return key
+	}
+	parent := key.Kind[:len(key.Kind)-len(scaleSubresourceSuffix)]
+	key.Kind = parent
+	if f.mapper == nil {
+		return key
+	}
+	groupVersion, err := schema.ParseGroupVersion(key.ApiVersion)
+	if err != nil {
+		return key
+	}
+	kind, err := f.mapper.KindFor(groupVersion.WithResource(strings.ToLower(parent)))
+	if err != nil {
+		return key
+	}
+	key.Kind = kind.Kind
+	if key.ApiVersion == "" {
+		key.ApiVersion = kind.GroupVersion().String()
+	}
+	return key
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFindTopLevelScaleReference(t *testing.T) {
+	appsV1 := schema.GroupVersion{Group: "apps", Version: "v1"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{appsV1})
+	mapper.Add(appsV1.WithKind("Deployment"), apimeta.RESTScopeNamespace)
+	mapper.Add(appsV1.WithKind("ReplicaSet"), apimeta.RESTScopeNamespace)
+	deploymentKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+
+	testCases := []struct {
+		name       string
+		key        ControllerKeyWithAPIVersion
+		withMapper bool
+	}{
+		{
+			name: "resource",
+			key: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-deployment", Kind: "deployments/scale", Namespace: "test-namespace"}, ApiVersion: "apps/v1"},
+			withMapper: true,
+		},
+		{
+			name: "resource without API version",
+			key: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-deployment", Kind: "deployments/scale", Namespace: "test-namespace"}},
+			withMapper: true,
+		},
+		{
+			name: "kind",
+			key: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-deployment", Kind: "Deployment/Scale", Namespace: "test-namespace"}, ApiVersion: "apps/v1"},
+		},
+		{
+			name: "owned resource",
+			key: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-rs", Kind: "replicasets/scale", Namespace: "test-namespace"}, ApiVersion: "apps/v1"},
+			withMapper: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := simpleControllerFetcher()
+			if tc.withMapper {
+				f.mapper = mapper
+			}
+			addController(f, &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+			})
+			addController(f, &appsv1.ReplicaSet{
+				TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-rs",
+					Namespace: "test-namespace",
+					OwnerReferences: []metav1.OwnerReference{
+						{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", Controller: &trueVar},
+					},
+				},
+			})
+			key := tc.key
+			topLevel, err := f.FindTopLevel(&key)
+			assert.NoError(t, err)
+			assert.Equal(t, deploymentKey, topLevel)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"fmt"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ScaleTargetRefExtractor reads the reference to the controller managed by the given object. It returns nil if
+// the object doesn't refer to one.
+type ScaleTargetRefExtractor func(obj *unstructured.Unstructured) (*autoscalingv1.CrossVersionObjectReference, error)
+
+// SpecScaleTargetRef is a ScaleTargetRefExtractor reading spec.scaleTargetRef, the reference HPAs use.
+func SpecScaleTargetRef(obj *unstructured.Unstructured) (*autoscalingv1.CrossVersionObjectReference, error) {
+	ref, found, err := unstructured.NestedMap(obj.Object, "spec", "scaleTargetRef")
+	if err != nil || !found {
+		return nil, err
+	}
+	target := &autoscalingv1.CrossVersionObjectReference{}
+	for field, value := range map[string]*string{"apiVersion": &target.APIVersion, "kind": &target.Kind, "name": &target.Name} {
+		if *value, _, err = unstructured.NestedString(ref, field); err != nil {
+			return nil, err
+		}
+	}
+	if target.Kind == "" || target.Name == "" {
+		return nil, fmt.Errorf("spec.scaleTargetRef of %s %s/%s lacks a kind or name", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	}
+	return target, nil
+}
+
+// scaleTargetRefOwners returns the controller referenced by the given controller, as its owner, if there's an
+// extractor for its kind. Controllers not read as unstructured objects are read again with the dynamic client.
+func (f *controllerFetcher) scaleTargetRefOwners(ctx context.Context, key ControllerKeyWithAPIVersion, controller *controllerObject) ([]metav1.OwnerReference, error) {
+	groupVersion, err := schema.ParseGroupVersion(key.ApiVersion)
+	if err != nil {
+		return nil, nil
+	}
+	groupKind := schema.GroupKind{Group: groupVersion.Group, Kind: key.Kind}
+	extract, found := f.scaleTargetRefExtractors[groupKind]
+	if !found {
+		return nil, nil
+	}
+	obj, ok := controller.object.(*unstructured.Unstructured)
+	if !ok {
+		read, err := f.readControllerFromDynamicClient(ctx, groupKind, key)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read scaleTargetRef of %s %s/%s: %w", groupKind, key.Namespace, key.Name, err)
+		}
+		if obj, ok = read.object.(*unstructured.Unstructured); !ok {
+			return nil, nil
+		}
+	}
+	target, err := extract(obj)
+	if err != nil || target == nil {
+		return nil, err
+	}
+	isController := true
+	return []metav1.OwnerReference{{
+		APIVersion: target.APIVersion,
+		Kind:       target.Kind,
+		Name:       target.Name,
+		Controller: &isController,
+	}}, nil
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func withScaleTargetRef(obj *unstructured.Unstructured, apiVersion, kind, name string) *unstructured.Unstructured {
+	unstructured.SetNestedStringMap(obj.Object, map[string]string{"apiVersion": apiVersion, "kind": kind, "name": name},
+		"spec", "scaleTargetRef")
+	return obj
+}
+
+func TestSpecScaleTargetRef(t *testing.T) {
+	obj := newUnstructured("example.com/v1", "Scaler", "test-namespace", "test-scaler")
+	target, err := SpecScaleTargetRef(obj)
+	assert.NoError(t, err)
+	assert.Nil(t, target)
+
+	withScaleTargetRef(obj, "apps/v1", "Deployment", "test-deployment")
+	target, err = SpecScaleTargetRef(obj)
+	assert.NoError(t, err)
+	assert.Equal(t, &autoscalingv1.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment"}, target)
+
+	withScaleTargetRef(obj, "apps/v1", "Deployment", "")
+	_, err = SpecScaleTargetRef(obj)
+	assert.Error(t, err)
+}
+
+func TestFindTopLevelScaleTargetRef(t *testing.T) {
+	scalerKind := schema.GroupKind{Group: "example.com", Kind: "Scaler"}
+	scaledAppKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "ScaledApp"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{scaledAppKind.GroupVersion()})
+	mapper.Add(scaledAppKind, apimeta.RESTScopeNamespace)
+	scaledApps := schema.GroupResource{Group: "example.com", Resource: "scaledapps"}
+	scales := newFakeScalesGetter()
+	scales.add(scaledApps, &autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{Name: "test-app", Namespace: "test-namespace"}})
+	dynamicClient := newFakeDynamicClient()
+	dynamicClient.add(scaledApps, withScaleTargetRef(newUnstructured("example.com/v1", "ScaledApp", "test-namespace", "test-app"),
+		"apps/v1", "Deployment", "test-deployment"))
+
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.dynamicClient = dynamicClient
+	f.customInformers = map[schema.GroupKind]cache.SharedIndexInformer{scalerKind: newCustomInformer()}
+	f.scaleTargetRefExtractors = map[schema.GroupKind]ScaleTargetRefExtractor{
+		scalerKind:                SpecScaleTargetRef,
+		scaledAppKind.GroupKind(): SpecScaleTargetRef,
+	}
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "owner-deployment", Namespace: "test-namespace"},
+	})
+	store := f.customInformers[scalerKind].GetStore()
+	store.Add(withScaleTargetRef(newUnstructured("example.com/v1", "Scaler", "test-namespace", "test-scaler"),
+		"apps/v1", "Deployment", "test-deployment"))
+	// Owners take precedence over the reference.
+	store.Add(withScaleTargetRef(newUnstructured("example.com/v1", "Scaler", "test-namespace", "owned-scaler",
+		metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "owner-deployment", Controller: &trueVar}),
+		"apps/v1", "Deployment", "test-deployment"))
+	store.Add(newUnstructured("example.com/v1", "Scaler", "test-namespace", "lone-scaler"))
+	store.Add(withScaleTargetRef(newUnstructured("example.com/v1", "Scaler", "test-namespace", "broken-scaler"),
+		"apps/v1", "Deployment", "missing-deployment"))
+
+	testCases := []struct {
+		name          string
+		key           ControllerKeyWithAPIVersion
+		expected      string
+		expectedError bool
+	}{
+		{name: "follows the reference", key: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "test-scaler", Kind: "Scaler", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"},
+			expected: "test-deployment"},
+		{name: "reads the reference with the dynamic client", key: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "test-app", Kind: "ScaledApp", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"},
+			expected: "test-deployment"},
+		{name: "prefers owners", key: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "owned-scaler", Kind: "Scaler", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"},
+			expected: "owner-deployment"},
+		{name: "without a reference", key: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "lone-scaler", Kind: "Scaler", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"},
+			expected: "lone-scaler"},
+		{name: "missing target", key: ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: "broken-scaler", Kind: "Scaler", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"},
+			expectedError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			topLevel, err := f.FindTopLevel(&tc.key)
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expected, topLevel.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/scale"
+)
+
+// emptyScalesGetter returns neither a scale nor an error.
+type emptyScalesGetter struct{}
+
+func (emptyScalesGetter) Scales(string) scale.ScaleInterface { return emptyScalesGetter{} }
+
+func (emptyScalesGetter) Get(schema.GroupResource, string) (*autoscalingv1.Scale, error) {
+	return nil, nil
+}
+
+func (emptyScalesGetter) Update(schema.GroupResource, *autoscalingv1.Scale) (*autoscalingv1.Scale, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+// unmappedRESTMapper maps no kind to any resource, without failing.
+type unmappedRESTMapper struct {
+	apimeta.RESTMapper
+}
+
+func (unmappedRESTMapper) RESTMappings(schema.GroupKind, ...string) ([]*apimeta.RESTMapping, error) {
+	return nil, nil
+}
+
+func TestScaleTerminalVersusFailure(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	widgets := schema.GroupResource{Group: "example.com", Resource: "widgets"}
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+
+	ownerless := newFakeScalesGetter()
+	ownerless.add(widgets, &autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{Name: "test-widget", Namespace: "test-namespace"}})
+
+	testCases := []struct {
+		name          string
+		mapper        apimeta.RESTMapper
+		scales        scale.ScalesGetter
+		expectedError error
+	}{
+		{
+			name:   "scale read without owners",
+			mapper: mapper,
+			scales: ownerless,
+		},
+		{
+			name:          "no scale",
+			mapper:        mapper,
+			scales:        newFakeScalesGetter(),
+			expectedError: ErrControllerNotFound,
+		},
+		{
+			name:          "empty read",
+			mapper:        mapper,
+			scales:        emptyScalesGetter{},
+			expectedError: ErrEmptyScale,
+		},
+		{
+			name:          "no mapping",
+			mapper:        unmappedRESTMapper{mapper},
+			scales:        ownerless,
+			expectedError: ErrNoScaleMapping,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := simpleControllerFetcher()
+			f.mapper = tc.mapper
+			f.scaleNamespacer = tc.scales
+			result, err := f.FindTopLevelDetailed(context.Background(), key)
+			if tc.expectedError != nil {
+				assert.True(t, errors.Is(err, tc.expectedError), "unexpected error: %v", err)
+				assert.Nil(t, result)
+				return
+			}
+			if assert.NoError(t, err) {
+				// The Widget is the top level controller, and known to be scalable since its scale was read.
+				assert.Equal(t, key, result.TopLevel)
+				assert.Equal(t, string(ScalePath), result.ResolvedVia)
+				assert.True(t, result.Scalable)
+			}
+		})
+	}
+}
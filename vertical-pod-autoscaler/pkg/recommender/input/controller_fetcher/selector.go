@@ -0,0 +1,94 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func (f *controllerFetcher) TopLevelSelector(ctx context.Context, key *ControllerKeyWithAPIVersion) (labels.Selector, error) {
+	if key == nil {
+		return nil, fmt.Errorf("controller not defined")
+	}
+	start := *key
+	start.ResourceVersion = ""
+	res, err := f.findTopLevel(ctx, &start)
+	if err != nil {
+		return nil, err
+	}
+	topLevel, controller := res.topLevel, res.controller
+	selector, found, err := getSelector(controller.object)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		// The object doesn't tell, which is the case for custom and terminal controllers: ask its scale subresource.
+		controller, err = f.getControllerFromScale(ctx, *topLevel)
+		if err != nil {
+			return nil, err
+		}
+		selector, _, err = getSelector(controller.object)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if selector.Empty() {
+		return nil, fmt.Errorf("%w: %s %s/%s", ErrNoSelector, topLevel.Kind, topLevel.Namespace, topLevel.Name)
+	}
+	return selector, nil
+}
+
+// getSelector returns the label selector of the given controller object. found is false if the object
+// is of a type the selector can't be read from. An empty selector is returned if the controller doesn't
+// define one.
+func getSelector(obj interface{}) (selector labels.Selector, found bool, err error) {
+	var labelSelector *metav1.LabelSelector
+	switch apiObj := obj.(type) {
+	case *appsv1.DaemonSet:
+		labelSelector = apiObj.Spec.Selector
+	case *appsv1.Deployment:
+		labelSelector = apiObj.Spec.Selector
+	case *appsv1.StatefulSet:
+		labelSelector = apiObj.Spec.Selector
+	case *appsv1.ReplicaSet:
+		labelSelector = apiObj.Spec.Selector
+	case *batchv1.Job:
+		labelSelector = apiObj.Spec.Selector
+	case *corev1.ReplicationController:
+		if len(apiObj.Spec.Selector) > 0 {
+			labelSelector = metav1.SetAsLabelSelector(apiObj.Spec.Selector)
+		}
+	case *autoscalingv1.Scale:
+		selector, err := labels.Parse(apiObj.Status.Selector)
+		return selector, true, err
+	default:
+		return nil, false, nil
+	}
+	if labelSelector == nil {
+		return labels.Everything(), true, nil
+	}
+	selector, err = metav1.LabelSelectorAsSelector(labelSelector)
+	return selector, true, err
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestTopLevelSelector(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	widgets := schema.GroupResource{Group: "example.com", Resource: "widgets"}
+	scales := newFakeScalesGetter()
+	// Older CRDs don't populate status.selector of their scale subresource.
+	scales.add(widgets, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "old-widget", Namespace: "test-namespace"},
+	})
+	scales.add(widgets, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "new-widget", Namespace: "test-namespace"},
+		Status:     autoscalingv1.ScaleStatus{Selector: "app=widget"},
+	})
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test"}},
+		},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{Controller: &trueVar, Kind: "Deployment", Name: "test-deployment"},
+			},
+		},
+	})
+	addController(f, &appsv1.DaemonSet{
+		TypeMeta:   metav1.TypeMeta{Kind: "DaemonSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ds", Namespace: "test-namespace"},
+	})
+
+	for _, tc := range []struct {
+		name             string
+		key              *ControllerKeyWithAPIVersion
+		expectedSelector labels.Selector
+		expectedError    error
+	}{
+		{
+			name: "deployment",
+			key: &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}},
+			expectedSelector: labels.SelectorFromSet(labels.Set{"app": "test"}),
+		},
+		{
+			name: "daemon set without selector",
+			key: &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "test-ds", Kind: "DaemonSet", Namespace: "test-namespace"}},
+			expectedError: ErrNoSelector,
+		},
+		{
+			name: "scale with selector",
+			key: &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "new-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"},
+			expectedSelector: labels.SelectorFromSet(labels.Set{"app": "widget"}),
+		},
+		{
+			name: "scale without selector",
+			key: &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+				Name: "old-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"},
+			expectedError: ErrNoSelector,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			selector, err := f.TopLevelSelector(context.Background(), tc.key)
+			if tc.expectedError != nil {
+				assert.True(t, errors.Is(err, tc.expectedError), "unexpected error: %v", err)
+				assert.Nil(t, selector)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedSelector.String(), selector.String())
+		})
+	}
+}
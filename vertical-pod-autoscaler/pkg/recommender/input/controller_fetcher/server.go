@@ -0,0 +1,206 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"k8s.io/klog"
+)
+
+// ResolutionErrorCode identifies the kind of error returned by the resolution server.
+type ResolutionErrorCode string
+
+const (
+	// ErrorCodeInvalidRequest means the request couldn't be decoded, e.g. because it's too large.
+	ErrorCodeInvalidRequest ResolutionErrorCode = "InvalidRequest"
+	// ErrorCodeControllerNotFound corresponds to ErrControllerNotFound.
+	ErrorCodeControllerNotFound ResolutionErrorCode = "ControllerNotFound"
+	// ErrorCodeMissingNamespace corresponds to ErrMissingNamespace.
+	ErrorCodeMissingNamespace ResolutionErrorCode = "MissingNamespace"
+	// ErrorCodeNonWorkloadTarget corresponds to ErrNonWorkloadTarget.
+	ErrorCodeNonWorkloadTarget ResolutionErrorCode = "NonWorkloadTarget"
+	// ErrorCodeResolutionTimeout corresponds to ErrResolutionTimeout.
+	ErrorCodeResolutionTimeout ResolutionErrorCode = "ResolutionTimeout"
+	// ErrorCodeInferredOwner corresponds to ErrInferredOwner.
+	ErrorCodeInferredOwner ResolutionErrorCode = "InferredOwner"
+	// ErrorCodeUnreadableOwnerObject corresponds to ErrUnreadableOwnerObject.
+	ErrorCodeUnreadableOwnerObject ResolutionErrorCode = "UnreadableOwnerObject"
+	// ErrorCodeCrossNamespaceOwner corresponds to ErrCrossNamespaceOwner.
+	ErrorCodeCrossNamespaceOwner ResolutionErrorCode = "CrossNamespaceOwner"
+	// ErrorCodeNoSelector corresponds to ErrNoSelector.
+	ErrorCodeNoSelector ResolutionErrorCode = "NoSelector"
+	// ErrorCodeUIDNotFound corresponds to ErrUIDNotFound.
+	ErrorCodeUIDNotFound ResolutionErrorCode = "UIDNotFound"
+	// ErrorCodePodInformerDisabled corresponds to ErrPodInformerDisabled.
+	ErrorCodePodInformerDisabled ResolutionErrorCode = "PodInformerDisabled"
+	// ErrorCodeNoController corresponds to ErrNoController.
+	ErrorCodeNoController ResolutionErrorCode = "NoController"
+	// ErrorCodeMirrorPod corresponds to ErrMirrorPod.
+	ErrorCodeMirrorPod ResolutionErrorCode = "MirrorPod"
+	// ErrorCodeHPAInformerDisabled corresponds to ErrHPAInformerDisabled.
+	ErrorCodeHPAInformerDisabled ResolutionErrorCode = "HPAInformerDisabled"
+	// ErrorCodeNoScalableAncestor corresponds to ErrNoScalableAncestor.
+	ErrorCodeNoScalableAncestor ResolutionErrorCode = "NoScalableAncestor"
+	// ErrorCodeSelfOwnership corresponds to ErrSelfOwnership.
+	ErrorCodeSelfOwnership ResolutionErrorCode = "SelfOwnership"
+	// ErrorCodeOwnershipCycle corresponds to ErrOwnershipCycle.
+	ErrorCodeOwnershipCycle ResolutionErrorCode = "OwnershipCycle"
+	// ErrorCodeKindUnavailable corresponds to ErrKindUnavailable.
+	ErrorCodeKindUnavailable ResolutionErrorCode = "KindUnavailable"
+	// ErrorCodeUnexpectedOwnerKind corresponds to ErrUnexpectedOwnerKind.
+	ErrorCodeUnexpectedOwnerKind ResolutionErrorCode = "UnexpectedOwnerKind"
+	// ErrorCodeAmbiguousDeploymentOwner corresponds to ErrAmbiguousDeploymentOwner.
+	ErrorCodeAmbiguousDeploymentOwner ResolutionErrorCode = "AmbiguousDeploymentOwner"
+	// ErrorCodeTargetTerminating corresponds to ErrTargetTerminating.
+	ErrorCodeTargetTerminating ResolutionErrorCode = "TargetTerminating"
+	// ErrorCodeFetcherStopped corresponds to ErrFetcherStopped.
+	ErrorCodeFetcherStopped ResolutionErrorCode = "FetcherStopped"
+	// ErrorCodeNoScaleMapping corresponds to ErrNoScaleMapping.
+	ErrorCodeNoScaleMapping ResolutionErrorCode = "NoScaleMapping"
+	// ErrorCodeEmptyScale corresponds to ErrEmptyScale.
+	ErrorCodeEmptyScale ResolutionErrorCode = "EmptyScale"
+	// ErrorCodeUnknown is used for all other errors.
+	ErrorCodeUnknown ResolutionErrorCode = "Unknown"
+)
+
+// maxResolutionRequestBytes limits the size of request bodies of the resolution server. Keys are far smaller.
+const maxResolutionRequestBytes = 64 * 1024
+
+// ResolutionResponse is the body of responses of the resolution server. The request body is the JSON encoded
+// ControllerKeyWithAPIVersion to resolve.
+type ResolutionResponse struct {
+	TopLevel *ControllerKeyWithAPIVersion `json:"topLevel,omitempty"`
+	Error    *ResolutionError             `json:"error,omitempty"`
+}
+
+// ResolutionError is an error returned by the resolution server.
+type ResolutionError struct {
+	Code    ResolutionErrorCode `json:"code"`
+	Message string              `json:"message"`
+}
+
+func (e *ResolutionError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the sentinel error of the code, so that errors.Is works on errors of remote fetchers.
+func (e *ResolutionError) Unwrap() error {
+	for _, c := range sentinelErrors {
+		if c.code == e.Code {
+			return c.err
+		}
+	}
+	return nil
+}
+
+func newResolutionError(err error) *ResolutionError {
+	for _, c := range sentinelErrors {
+		if errors.Is(err, c.err) {
+			return &ResolutionError{Code: c.code, Message: err.Error()}
+		}
+	}
+	return &ResolutionError{Code: ErrorCodeUnknown, Message: err.Error()}
+}
+
+// ResolutionServer serves FindTopLevel of a single fetcher over HTTP, so that several processes can share
+// its informers.
+type ResolutionServer struct {
+	fetcher ControllerFetcher
+}
+
+// NewResolutionServer constructs new ResolutionServer.
+func NewResolutionServer(fetcher ControllerFetcher) *ResolutionServer {
+	return &ResolutionServer{fetcher: fetcher}
+}
+
+// ServeHTTP implements http.Handler interface. It resolves controllers POSTed as JSON.
+func (s *ResolutionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var key ControllerKeyWithAPIVersion
+	body := http.MaxBytesReader(w, r.Body, maxResolutionRequestBytes)
+	if err := json.NewDecoder(body).Decode(&key); err != nil {
+		s.respond(w, http.StatusBadRequest, ResolutionResponse{
+			Error: &ResolutionError{Code: ErrorCodeInvalidRequest, Message: err.Error()}})
+		return
+	}
+	var topLevel *ControllerKeyWithAPIVersion
+	var err error
+	if extended, ok := s.fetcher.(ExtendedControllerFetcher); ok {
+		topLevel, err = extended.FindTopLevelWithContext(r.Context(), &key)
+	} else {
+		topLevel, err = s.fetcher.FindTopLevel(&key)
+	}
+	if err != nil {
+		s.respond(w, http.StatusOK, ResolutionResponse{Error: newResolutionError(err)})
+		return
+	}
+	s.respond(w, http.StatusOK, ResolutionResponse{TopLevel: topLevel})
+}
+
+func (s *ResolutionServer) respond(w http.ResponseWriter, status int, response ResolutionResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		klog.Errorf("Could not write resolution response: %v", err)
+	}
+}
+
+type remoteControllerFetcher struct {
+	url    string
+	client *http.Client
+}
+
+// NewRemoteControllerFetcher returns a ControllerFetcher resolving controllers with the ResolutionServer
+// at the given URL. Errors returned by the server are *ResolutionError.
+func NewRemoteControllerFetcher(url string, client *http.Client) ControllerFetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &remoteControllerFetcher{url: url, client: client}
+}
+
+func (f *remoteControllerFetcher) FindTopLevel(key *ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error) {
+	if key == nil {
+		return nil, nil
+	}
+	body, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	httpResponse, err := f.client.Post(f.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+	var response ResolutionResponse
+	if err := json.NewDecoder(httpResponse.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("Could not decode response of %s (status %d): %v", f.url, httpResponse.StatusCode, err)
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	return response.TopLevel, nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolutionServer(t *testing.T) {
+	f := simpleControllerFetcher()
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", Controller: &trueVar},
+			},
+		},
+	})
+	server := httptest.NewServer(NewResolutionServer(f))
+	defer server.Close()
+	remote := NewRemoteControllerFetcher(server.URL, server.Client())
+
+	topLevel, err := remote.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}, topLevel)
+
+	// Errors keep their kind.
+	_, err = remote.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet"}})
+	assert.True(t, errors.Is(err, ErrMissingNamespace), "unexpected error: %v", err)
+	_, err = remote.FindTopLevel(&ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "missing-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}})
+	assert.True(t, errors.Is(err, ErrControllerNotFound), "unexpected error: %v", err)
+	var resolutionErr *ResolutionError
+	if assert.True(t, errors.As(err, &resolutionErr), "unexpected error: %v", err) {
+		assert.Equal(t, ErrorCodeControllerNotFound, resolutionErr.Code)
+	}
+
+	response, err := server.Client().Post(server.URL, "application/json", strings.NewReader("{"))
+	if assert.NoError(t, err) {
+		response.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	}
+	response, err = server.Client().Post(server.URL, "application/json",
+		strings.NewReader(`{"name":"`+strings.Repeat("a", maxResolutionRequestBytes)+`"}`))
+	if assert.NoError(t, err) {
+		response.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	}
+	response, err = server.Client().Get(server.URL)
+	if assert.NoError(t, err) {
+		response.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+	}
+}
+
+func TestResolutionErrorCodes(t *testing.T) {
+	// Every sentinel declared in errors.go has a code.
+	file, err := parser.ParseFile(token.NewFileSet(), "errors.go", nil, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	declared := 0
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.VAR {
+			for _, spec := range gen.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					if strings.HasPrefix(name.Name, "Err") {
+						declared++
+					}
+				}
+			}
+		}
+	}
+	assert.Equal(t, declared, len(sentinelErrors))
+
+	codes := make(map[ResolutionErrorCode]bool)
+	for _, c := range sentinelErrors {
+		assert.False(t, codes[c.code], "duplicate code %s", c.code)
+		codes[c.code] = true
+		encoded, err := json.Marshal(newResolutionError(fmt.Errorf("test-controller: %w", c.err)))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		decoded := &ResolutionError{}
+		if assert.NoError(t, json.Unmarshal(encoded, decoded)) {
+			assert.Equal(t, c.code, decoded.Code)
+			assert.True(t, errors.Is(decoded, c.err), "code %s doesn't unwrap to %v", c.code, c.err)
+		}
+	}
+	assert.Equal(t, ErrorCodeUnknown, newResolutionError(errors.New("test error")).Code)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// informerFreshness records when an informer last received an event: an add, update or delete, or a resync or
+// relist replaying its objects. Informers only resync while their reflector's list and watch run, and relist
+// once a failed one succeeds again, so a healthy informer holding objects receives an event at least every
+// resync period, also on a quiet cluster.
+type informerFreshness struct {
+	// lastEvent is the time of the last event in Unix nanoseconds, accessed atomically.
+	lastEvent int64
+}
+
+// newInformerFreshness returns the freshness of the given informer, which is considered fresh until it
+// receives its first event.
+func newInformerFreshness(informer cache.SharedIndexInformer) *informerFreshness {
+	freshness := &informerFreshness{lastEvent: time.Now().UnixNano()}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { freshness.touch() },
+		UpdateFunc: func(interface{}, interface{}) { freshness.touch() },
+		DeleteFunc: func(interface{}) { freshness.touch() },
+	})
+	return freshness
+}
+
+func (i *informerFreshness) touch() {
+	atomic.StoreInt64(&i.lastEvent, time.Now().UnixNano())
+}
+
+// lastEventTime returns the time of the last event.
+func (i *informerFreshness) lastEventTime() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&i.lastEvent))
+}
+
+// staleness returns the time since the last event of the informer of the given kind if its reflector reported a
+// list or watch error since then, zero otherwise: informers which don't fail are fresh however quiet they are.
+func (f *controllerFetcher) staleness(kind wellKnownController, now time.Time) time.Duration {
+	freshness, found := f.informerFreshness[kind]
+	if !found {
+		return 0
+	}
+	lastEvent := freshness.lastEventTime()
+	tracker, found := f.informerErrors[kind]
+	if !found {
+		return 0
+	}
+	if err, errTime := tracker.last(); err == nil || errTime.Before(lastEvent) {
+		return 0
+	}
+	return now.Sub(lastEvent)
+}
+
+// isInformerStale tells whether the informer of the given kind has been failing to list or watch for longer
+// than Options.MaxInformerStaleness, measured from its last event.
+func (f *controllerFetcher) isInformerStale(kind wellKnownController) bool {
+	if f.maxInformerStaleness <= 0 {
+		return false
+	}
+	staleness := f.staleness(kind, time.Now())
+	if staleness <= f.maxInformerStaleness {
+		return false
+	}
+	klog.V(4).Infof("Informer of %s failing for %v since its last event, reading from the API server", kind, staleness)
+	return true
+}
+
+func (f *controllerFetcher) InformerStaleness() map[string]time.Duration {
+	now := time.Now()
+	staleness := make(map[string]time.Duration, len(f.informerFreshness))
+	for kind := range f.informerFreshness {
+		staleness[string(kind)] = f.staleness(kind, now)
+	}
+	return staleness
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newReplicaSetOwnedBy(deploymentName string) *appsv1.ReplicaSet {
+	return &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: deploymentName, Controller: &trueVar},
+			},
+		},
+	}
+}
+
+func TestMaxInformerStaleness(t *testing.T) {
+	f := simpleControllerFetcher()
+	// The informer lags behind the API server, where the ReplicaSet was adopted by another Deployment.
+	addController(f, newReplicaSetOwnedBy("old-deployment"))
+	for _, name := range []string{"old-deployment", "new-deployment"} {
+		addController(f, &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+		})
+	}
+	f.kubeClient = fake.NewSimpleClientset(newReplicaSetOwnedBy("new-deployment"))
+	f.maxInformerStaleness = time.Minute
+	freshness := &informerFreshness{}
+	f.informerFreshness = map[wellKnownController]*informerFreshness{replicaSet: freshness}
+	tracker := newInformerErrors(replicaSet)
+	f.informerErrors = map[wellKnownController]*informerErrors{replicaSet: tracker}
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-rs", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+
+	// A quiet informer which doesn't fail is used.
+	freshness.lastEvent = time.Now().Add(-time.Hour).UnixNano()
+	topLevel, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "old-deployment", topLevel.Name)
+	assert.Equal(t, time.Duration(0), f.InformerStaleness()["ReplicaSet"])
+
+	// One failing since its last event is bypassed once that's long enough ago.
+	tracker.record(fmt.Errorf("Failed to watch *v1.ReplicaSet: watch closed"), time.Now())
+	topLevel, err = f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "new-deployment", topLevel.Name)
+	assert.True(t, f.InformerStaleness()["ReplicaSet"] >= time.Hour)
+
+	// Events after the error, e.g. its relist, make it fresh again.
+	freshness.touch()
+	topLevel, err = f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "old-deployment", topLevel.Name)
+	assert.Equal(t, time.Duration(0), f.InformerStaleness()["ReplicaSet"])
+
+	tracker.record(fmt.Errorf("Failed to watch *v1.ReplicaSet: watch closed"), time.Now())
+	freshness.lastEvent = time.Now().Add(-time.Hour).UnixNano()
+
+	// Without a kube client the informer is the only source.
+	f.kubeClient = nil
+	topLevel, err = f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "old-deployment", topLevel.Name)
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// stepCacheBypassKey is the context key marking resolutions which must read every controller afresh.
+type stepCacheBypassKey struct{}
+
+// withFreshReads returns a copy of ctx making resolveStep bypass the step cache, e.g. for refreshes, which would
+// otherwise be served the entries they're meant to replace.
+func withFreshReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, stepCacheBypassKey{}, true)
+}
+
+func freshReads(ctx context.Context) bool {
+	bypass, _ := ctx.Value(stepCacheBypassKey{}).(bool)
+	return bypass
+}
+
+// maxStepCacheEntries bounds the number of controllers in the step cache. Once it's full, expired entries are
+// dropped, and if that's not enough, arbitrary ones.
+const maxStepCacheEntries = 10000
+
+type stepCacheEntry struct {
+	controller *controllerObject
+	expiresAt  time.Time
+}
+
+// stepCache caches controllers read during resolution, per controller rather than per resolved target, so that
+// all ways of resolving a controller (FindTopLevel, FindAncestors, FindScalableAncestor, ClassifyTarget) and
+// resolutions of controllers sharing owners read each controller once. Cached controllers must not be modified.
+// Expired entries are dropped when they're read, by sweep, or when the cache is full.
+type stepCache struct {
+	mutex      sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[ControllerKeyWithAPIVersion]stepCacheEntry
+}
+
+func newStepCache(ttl time.Duration) *stepCache {
+	return &stepCache{ttl: ttl, maxEntries: maxStepCacheEntries, entries: make(map[ControllerKeyWithAPIVersion]stepCacheEntry)}
+}
+
+func (c *stepCache) get(key ControllerKeyWithAPIVersion, now time.Time) (*controllerObject, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	if !now.Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.controller, true
+}
+
+func (c *stepCache) set(key ControllerKeyWithAPIVersion, controller *controllerObject, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, found := c.entries[key]; !found && len(c.entries) >= c.maxEntries {
+		c.sweepLocked(now)
+		for evicted := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, evicted)
+		}
+	}
+	c.entries[key] = stepCacheEntry{controller: controller, expiresAt: now.Add(c.ttl)}
+}
+
+// sweep drops entries expired at now.
+func (c *stepCache) sweep(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sweepLocked(now)
+}
+
+func (c *stepCache) sweepLocked(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// purge drops all entries.
+func (c *stepCache) purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[ControllerKeyWithAPIVersion]stepCacheEntry)
+}
+
+func (c *stepCache) invalidate(key ControllerKeyWithAPIVersion) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, key)
+}
+
+// resolveStep reads the given controller during resolution, from the step cache if it's enabled. Controllers
+// found missing are dropped from the cache, other errors aren't cached. Only controllers read from the API server
+// are cached: informers are as cheap to read, and see owner changes right away. Controllers read through the
+// scale subresource aren't cached with Options.FreshScaleReads either.
+func (f *controllerFetcher) resolveStep(ctx context.Context, key ControllerKeyWithAPIVersion) (*controllerObject, error) {
+	if f.stepCache == nil {
+		return f.getController(ctx, key)
+	}
+	key.ResourceVersion = ""
+	if !freshReads(ctx) {
+		if controller, found := f.stepCache.get(key, time.Now()); found {
+			return controller, nil
+		}
+	}
+	controller, err := f.getController(ctx, key)
+	if errors.Is(err, ErrControllerNotFound) {
+		f.stepCache.invalidate(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if controller.path == InformerPath || controller.path == TerminalPath {
+		return controller, nil
+	}
+	if f.freshScaleReads && controller.path == ScalePath {
+		return controller, nil
+	}
+	f.stepCache.set(key, controller, time.Now())
+	return controller, nil
+}
+
+func (f *controllerFetcher) FindAncestors(ctx context.Context, key *ControllerKeyWithAPIVersion) ([]ControllerKeyWithAPIVersion, error) {
+	if key == nil {
+		return nil, nil
+	}
+	res, err := f.findTopLevel(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return append([]ControllerKeyWithAPIVersion(nil), res.chain...), nil
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func newStepCacheTestFetcher() (*controllerFetcher, *fakeScalesGetter) {
+	groupVersion := schema.GroupVersion{Group: "example.com", Version: "v1"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{groupVersion})
+	mapper.Add(groupVersion.WithKind("App"), apimeta.RESTScopeNamespace)
+	mapper.Add(groupVersion.WithKind("AppPart"), apimeta.RESTScopeNamespace)
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "apps"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-app", Namespace: "test-namespace"},
+	})
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "appparts"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-part", Namespace: "test-namespace", OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "example.com/v1", Kind: "App", Name: "test-app", Controller: &trueVar},
+		}},
+	})
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.stepCache = newStepCache(time.Minute)
+	return f, scales
+}
+
+func TestFindAncestorsSharesReadsWithFindTopLevel(t *testing.T) {
+	f, scales := newStepCacheTestFetcher()
+	partKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-part", Kind: "AppPart", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	appKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-app", Kind: "App", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+
+	ancestors, err := f.FindAncestors(context.Background(), &partKey)
+	assert.NoError(t, err)
+	assert.Equal(t, []ControllerKeyWithAPIVersion{partKey, appKey}, ancestors)
+	assert.Equal(t, 2, scales.gets)
+
+	// FindTopLevel is served the controllers FindAncestors read, and vice versa.
+	topLevel, err := f.FindTopLevel(&partKey)
+	assert.NoError(t, err)
+	assert.Equal(t, &appKey, topLevel)
+	ancestors, err = f.FindAncestors(context.Background(), &appKey)
+	assert.NoError(t, err)
+	assert.Equal(t, []ControllerKeyWithAPIVersion{appKey}, ancestors)
+	assert.Equal(t, 2, scales.gets)
+
+	// Fresh reads bypass the cache, and refill it.
+	_, err = f.findTopLevel(withFreshReads(context.Background()), &partKey)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, scales.gets)
+	_, err = f.FindTopLevel(&partKey)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, scales.gets)
+}
+
+func TestStepCache(t *testing.T) {
+	c := newStepCache(time.Minute)
+	key := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-app", Kind: "App", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	controller := &controllerObject{resourceVersion: "1"}
+	now := time.Now()
+
+	c.set(key, controller, now)
+	cached, found := c.get(key, now.Add(time.Second))
+	assert.True(t, found)
+	assert.Equal(t, controller, cached)
+
+	_, found = c.get(key, now.Add(time.Minute))
+	assert.False(t, found)
+
+	c.set(key, controller, now)
+	c.invalidate(key)
+	_, found = c.get(key, now)
+	assert.False(t, found)
+}
+
+func TestResolveStepDropsMissingControllers(t *testing.T) {
+	f, scales := newStepCacheTestFetcher()
+	appKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-app", Kind: "App", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	_, err := f.FindTopLevel(&appKey)
+	assert.NoError(t, err)
+
+	delete(scales.scales, scaleKey{schema.GroupResource{Group: "example.com", Resource: "apps"}, "test-namespace", "test-app"})
+	_, err = f.findTopLevel(withFreshReads(context.Background()), &appKey)
+	assert.Error(t, err)
+	_, found := f.stepCache.get(appKey, time.Now())
+	assert.False(t, found)
+}
+
+func TestFreshScaleReads(t *testing.T) {
+	f, scales := newStepCacheTestFetcher()
+	f.freshScaleReads = true
+	partKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-part", Kind: "AppPart", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+
+	for i := 1; i <= 2; i++ {
+		ancestors, err := f.FindAncestors(context.Background(), &partKey)
+		assert.NoError(t, err)
+		assert.Len(t, ancestors, 2)
+		assert.Equal(t, 2*i, scales.gets)
+	}
+}
+
+func TestStepCacheBounded(t *testing.T) {
+	c := newStepCache(time.Minute)
+	c.maxEntries = 2
+	controller := &controllerObject{resourceVersion: "1"}
+	keyFor := func(name string) ControllerKeyWithAPIVersion {
+		return ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+			Name: name, Kind: "App", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	}
+	now := time.Now()
+
+	// Expired entries make room first.
+	c.set(keyFor("expired"), controller, now.Add(-time.Minute))
+	c.set(keyFor("a"), controller, now)
+	c.set(keyFor("b"), controller, now)
+	assert.Len(t, c.entries, 2)
+	_, found := c.entries[keyFor("expired")]
+	assert.False(t, found)
+
+	// Otherwise arbitrary ones do.
+	c.set(keyFor("c"), controller, now)
+	assert.Len(t, c.entries, 2)
+	_, found = c.get(keyFor("c"), now)
+	assert.True(t, found)
+
+	c.sweep(now.Add(time.Minute))
+	assert.Len(t, c.entries, 0)
+}
+
+func TestStepCacheSkipsInformerReads(t *testing.T) {
+	f, _ := newStepCacheTestFetcher()
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"},
+	})
+	key := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}}
+	_, err := f.FindTopLevel(&key)
+	assert.NoError(t, err)
+	assert.Len(t, f.stepCache.entries, 0)
+}
+
+func TestStepCachePurgedWithMapper(t *testing.T) {
+	f, _ := newStepCacheTestFetcher()
+	appKey := ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-app", Kind: "App", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	_, err := f.FindTopLevel(&appKey)
+	assert.NoError(t, err)
+	assert.Len(t, f.stepCache.entries, 1)
+
+	f.resetMapper()
+	assert.Len(t, f.stepCache.entries, 0)
+}
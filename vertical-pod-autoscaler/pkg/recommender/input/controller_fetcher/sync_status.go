@@ -0,0 +1,197 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// InformerSyncStatus describes the state of an informer of the fetcher.
+type InformerSyncStatus struct {
+	// Synced is true once the informer finished its initial list.
+	Synced bool
+	// LastSync is when the informer last received an event, a change or a resync or relist of the objects it
+	// watches, or when it was created if it hasn't received any yet. Resyncs only happen while the informer's
+	// list and watch succeed, so on a healthy informer holding objects it's at most a resync period ago.
+	LastSync time.Time
+	// LastError is the last error listing or watching the objects, nil if there was none. Informers created by
+	// the fetcher, which is the default, report their own errors. Informers another user created in the shared
+	// factory before the fetcher can't, their errors are picked from those every reflector in the process logs, so
+	// errors of reflectors of the same type outside the factory are attributed to them too.
+	LastError error
+	// LastErrorTime is when LastError happened.
+	LastErrorTime time.Time
+}
+
+// informerErrors records the last list or watch error of an informer.
+type informerErrors struct {
+	// typeName is the type of objects of the informer as reflectors print it, e.g. "*v1.ReplicaSet".
+	typeName string
+	mutex    sync.Mutex
+	lastErr  error
+	lastTime time.Time
+}
+
+func newInformerErrors(kind wellKnownController) *informerErrors {
+	obj, err := newWellKnownObject(kind)
+	if err != nil {
+		return &informerErrors{}
+	}
+	return &informerErrors{typeName: reflect.TypeOf(obj).String()}
+}
+
+// matches tells whether the error was reported by a reflector listing or watching objects of the type the
+// informer watches. This client doesn't let informers report errors of their own, reflectors only pass them
+// to utilruntime.HandleError with the type in the message.
+func (e *informerErrors) matches(err error) bool {
+	if e.typeName == "" {
+		return false
+	}
+	message := err.Error()
+	return strings.Contains(message, "Failed to list "+e.typeName+":") ||
+		strings.Contains(message, "Failed to watch "+e.typeName+":")
+}
+
+func (e *informerErrors) record(err error, now time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.lastErr = err
+	e.lastTime = now
+}
+
+func (e *informerErrors) last() (error, time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.lastErr, e.lastTime
+}
+
+// errorRecordingListerWatcher records list and watch errors of an informer of the fetcher's own, so that they
+// needn't be matched among errors of all reflectors.
+type errorRecordingListerWatcher struct {
+	cache.ListerWatcher
+	tracker *informerErrors
+}
+
+func newErrorRecordingListerWatcher(lw cache.ListerWatcher, tracker *informerErrors) cache.ListerWatcher {
+	return &errorRecordingListerWatcher{ListerWatcher: lw, tracker: tracker}
+}
+
+func (lw *errorRecordingListerWatcher) List(options metav1.ListOptions) (runtime.Object, error) {
+	list, err := lw.ListerWatcher.List(options)
+	if err != nil {
+		lw.tracker.record(fmt.Errorf("Failed to list: %w", err), time.Now())
+	}
+	return list, err
+}
+
+func (lw *errorRecordingListerWatcher) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := lw.ListerWatcher.Watch(options)
+	if err != nil {
+		lw.tracker.record(fmt.Errorf("Failed to watch: %w", err), time.Now())
+		return nil, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		if event.Type == watch.Error {
+			lw.tracker.record(fmt.Errorf("Failed to watch: %w", k8serrors.FromObject(event.Object)), time.Now())
+		}
+		return event, true
+	}), nil
+}
+
+var (
+	// informerErrorsSubscribers are the errors trackers of the informers of all running fetchers.
+	informerErrorsMutex       sync.Mutex
+	informerErrorsSubscribers = make(map[*informerErrors]bool)
+)
+
+// The handler dispatching errors to subscribers is added before any goroutine can call utilruntime.HandleError,
+// which reads utilruntime.ErrorHandlers without synchronization.
+func init() {
+	utilruntime.ErrorHandlers = append(utilruntime.ErrorHandlers, dispatchInformerError)
+}
+
+// subscribeInformerErrors makes the given tracker record errors reported by reflectors, until it's
+// unsubscribed. Errors of all reflectors of the tracker's type in the process are attributed to it, also of
+// informers not of the fetcher, so only trackers of informers created by other users of the shared factory
+// are subscribed.
+func subscribeInformerErrors(tracker *informerErrors) {
+	informerErrorsMutex.Lock()
+	defer informerErrorsMutex.Unlock()
+	informerErrorsSubscribers[tracker] = true
+}
+
+func unsubscribeInformerErrors(trackers map[wellKnownController]*informerErrors) {
+	informerErrorsMutex.Lock()
+	defer informerErrorsMutex.Unlock()
+	for _, tracker := range trackers {
+		delete(informerErrorsSubscribers, tracker)
+	}
+}
+
+func dispatchInformerError(err error) {
+	if err == nil {
+		return
+	}
+	now := time.Now()
+	informerErrorsMutex.Lock()
+	defer informerErrorsMutex.Unlock()
+	for tracker := range informerErrorsSubscribers {
+		if tracker.matches(err) {
+			tracker.record(err, now)
+		}
+	}
+}
+
+func (f *controllerFetcher) SyncStatus() map[string]InformerSyncStatus {
+	statuses := make(map[string]InformerSyncStatus, len(f.informersMap))
+	for kind, informer := range f.informersMap {
+		status := InformerSyncStatus{Synced: informer.HasSynced()}
+		if freshness, found := f.informerFreshness[kind]; found {
+			status.LastSync = freshness.lastEventTime()
+		}
+		if tracker, found := f.informerErrors[kind]; found {
+			status.LastError, status.LastErrorTime = tracker.last()
+		}
+		statuses[string(kind)] = status
+	}
+	return statuses
+}
+
+// String describes the status for humans, e.g. "synced 12m0s ago, last error 3s ago: connection refused".
+func (s InformerSyncStatus) String() string {
+	var description string
+	if s.Synced {
+		description = fmt.Sprintf("synced %v ago", time.Since(s.LastSync).Round(time.Second))
+	} else {
+		description = "not synced"
+	}
+	if s.LastError != nil {
+		description += fmt.Sprintf(", last error %v ago: %v", time.Since(s.LastErrorTime).Round(time.Second), s.LastError)
+	}
+	return description
+}
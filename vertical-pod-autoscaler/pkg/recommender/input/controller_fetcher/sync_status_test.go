@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestInformerErrors(t *testing.T) {
+	replicaSetErrors := newInformerErrors(replicaSet)
+	deploymentErrors := newInformerErrors(deployment)
+	assert.Equal(t, "*v1.ReplicaSet", replicaSetErrors.typeName)
+	subscribeInformerErrors(replicaSetErrors)
+	subscribeInformerErrors(deploymentErrors)
+	defer unsubscribeInformerErrors(map[wellKnownController]*informerErrors{replicaSet: replicaSetErrors, deployment: deploymentErrors})
+
+	listErr := fmt.Errorf("reflector.go:99: Failed to list *v1.ReplicaSet: connection refused")
+	dispatchInformerError(listErr)
+	dispatchInformerError(fmt.Errorf("unrelated error mentioning *v1.Deployment"))
+	err, errTime := replicaSetErrors.last()
+	assert.Equal(t, listErr, err)
+	assert.False(t, errTime.IsZero())
+	err, _ = deploymentErrors.last()
+	assert.NoError(t, err)
+}
+
+func TestSyncStatus(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	factory := informers.NewSharedInformerFactory(kubeClient, 0)
+	// The Deployment informer is created by another user of the factory.
+	factory.Apps().V1().Deployments().Informer()
+	f := NewControllerFetcherWithClients(kubeClient.Discovery(), kubeClient, factory, Options{})
+	defer f.Stop()
+
+	statuses := f.SyncStatus()
+	assert.Len(t, statuses, len(wellKnownControllers))
+	for kind, status := range statuses {
+		assert.True(t, status.Synced, kind)
+		assert.False(t, status.LastSync.IsZero(), kind)
+		assert.NoError(t, status.LastError, kind)
+		assert.True(t, strings.HasPrefix(status.String(), "synced "), status.String())
+	}
+
+	utilruntime.HandleError(fmt.Errorf("reflector.go:99: Failed to watch *v1.Deployment: watch closed"))
+	status := f.SyncStatus()["Deployment"]
+	assert.EqualError(t, status.LastError, "reflector.go:99: Failed to watch *v1.Deployment: watch closed")
+	assert.True(t, time.Since(status.LastErrorTime) < time.Minute)
+	assert.Contains(t, status.String(), "last error")
+	// The ReplicaSet informer was created by the fetcher, errors of other reflectors aren't attributed to it.
+	utilruntime.HandleError(fmt.Errorf("reflector.go:99: Failed to watch *v1.ReplicaSet: watch closed"))
+	assert.NoError(t, f.SyncStatus()["ReplicaSet"].LastError)
+}
+
+func TestErrorRecordingListerWatcher(t *testing.T) {
+	tracker := newInformerErrors(replicaSet)
+	fakeWatch := watch.NewFake()
+	lw := newErrorRecordingListerWatcher(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return nil, fmt.Errorf("connection refused")
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) { return fakeWatch, nil },
+	}, tracker)
+
+	_, err := lw.List(metav1.ListOptions{})
+	assert.Error(t, err)
+	err, _ = tracker.last()
+	assert.EqualError(t, err, "Failed to list: connection refused")
+
+	w, err := lw.Watch(metav1.ListOptions{})
+	assert.NoError(t, err)
+	defer w.Stop()
+	go fakeWatch.Error(&metav1.Status{Status: metav1.StatusFailure, Message: "too old resource version", Code: 410})
+	<-w.ResultChan()
+	err, _ = tracker.last()
+	assert.EqualError(t, err, "Failed to watch: too old resource version")
+
+	// Errors of other reflectors of the type aren't attributed to informers reporting their own.
+	dispatchInformerError(fmt.Errorf("reflector.go:99: Failed to list *v1.ReplicaSet: forbidden"))
+	err, _ = tracker.last()
+	assert.EqualError(t, err, "Failed to watch: too old resource version")
+}
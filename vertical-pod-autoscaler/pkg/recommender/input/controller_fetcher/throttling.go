@@ -0,0 +1,94 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"time"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+)
+
+const (
+	// maxThrottledRetries is the number of times a throttled scale subresource GET is retried.
+	maxThrottledRetries = 3
+	// defaultThrottledRetryDelay is used when the API server doesn't send a Retry-After hint.
+	defaultThrottledRetryDelay = time.Second
+	// maxThrottledRetryDelay caps Retry-After hints, so that a single read can't stall resolution for long.
+	maxThrottledRetryDelay = 10 * time.Second
+)
+
+// getScale reads the scale subresource, retrying requests throttled by the API server (e.g. by API Priority
+// and Fairness) after the delay the server asked for. Each request holds the read limiter of the GroupKind,
+// which is released while waiting to retry. Waiting stops when ctx is done or the fetcher is stopped.
+func (f *controllerFetcher) getScale(ctx context.Context, groupKind schema.GroupKind, namespace string, groupResource schema.GroupResource, name string) (*autoscalingv1.Scale, error) {
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := f.readLimiter.acquire(ctx, groupKind); err != nil {
+			return nil, err
+		}
+		scale, err := f.scaleNamespacer.Scales(namespace).Get(groupResource, name)
+		f.readLimiter.release(groupKind)
+		delay, throttled := throttledRetryDelay(err)
+		if !throttled || attempt == maxThrottledRetries {
+			return scale, err
+		}
+		klog.V(4).Infof("Scale of %s %s/%s throttled, retrying in %v", groupResource, namespace, name, delay)
+		if err := f.wait(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// throttledRetryDelay returns how long to wait before retrying a request which failed with the given error,
+// and false if it wasn't throttled.
+func throttledRetryDelay(err error) (time.Duration, bool) {
+	if !k8serrors.IsTooManyRequests(err) {
+		return 0, false
+	}
+	delay := defaultThrottledRetryDelay
+	if seconds, ok := k8serrors.SuggestsClientDelay(err); ok && seconds > 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+	if delay > maxThrottledRetryDelay {
+		delay = maxThrottledRetryDelay
+	}
+	return delay, true
+}
+
+// wait waits for the given delay. It returns early with an error when ctx is done or the fetcher is stopped.
+func (f *controllerFetcher) wait(ctx context.Context, delay time.Duration) error {
+	if f.sleep != nil {
+		f.sleep(delay)
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-f.stopCh:
+		return ErrFetcherStopped
+	}
+}
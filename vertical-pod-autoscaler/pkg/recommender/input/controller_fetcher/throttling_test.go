@@ -0,0 +1,143 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestFindTopLevelThrottled(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	widgets := schema.GroupResource{Group: "example.com", Resource: "widgets"}
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+
+	for _, tc := range []struct {
+		name           string
+		throttled      int
+		retryAfter     int
+		expectedDelays []time.Duration
+		expectedError  bool
+	}{
+		{
+			name:           "honors Retry-After",
+			throttled:      2,
+			retryAfter:     2,
+			expectedDelays: []time.Duration{2 * time.Second, 2 * time.Second},
+		},
+		{
+			name:           "without Retry-After",
+			throttled:      1,
+			expectedDelays: []time.Duration{defaultThrottledRetryDelay},
+		},
+		{
+			name:           "caps Retry-After",
+			throttled:      1,
+			retryAfter:     600,
+			expectedDelays: []time.Duration{maxThrottledRetryDelay},
+		},
+		{
+			name:           "gives up",
+			throttled:      -1,
+			retryAfter:     1,
+			expectedDelays: []time.Duration{time.Second, time.Second, time.Second},
+			expectedError:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			scales := newFakeScalesGetter()
+			scales.add(widgets, &autoscalingv1.Scale{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-widget", Namespace: "test-namespace"},
+			})
+			scales.throttled = map[scaleKey]int{{widgets, "test-namespace", "test-widget"}: tc.throttled}
+			scales.retryAfter = tc.retryAfter
+			var delays []time.Duration
+			f := simpleControllerFetcher()
+			f.mapper = mapper
+			f.scaleNamespacer = scales
+			f.sleep = func(delay time.Duration) { delays = append(delays, delay) }
+
+			topLevel, err := f.FindTopLevel(key)
+			assert.Equal(t, tc.expectedDelays, delays)
+			if tc.expectedError {
+				assert.Contains(t, err.Error(), "throttled")
+				assert.Equal(t, maxThrottledRetries+1, scales.gets)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, key, topLevel)
+		})
+	}
+}
+
+func TestFindTopLevelThrottledWithinContext(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	widgets := schema.GroupResource{Group: "example.com", Resource: "widgets"}
+	scales := newFakeScalesGetter()
+	for _, name := range []string{"throttled-widget", "test-widget"} {
+		scales.add(widgets, &autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"}})
+	}
+	scales.throttled = map[scaleKey]int{{widgets, "test-namespace", "throttled-widget"}: -1}
+	scales.retryAfter = 10
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	f.readLimiter = newGroupKindLimiter(1)
+	throttledKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "throttled-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+	key := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}
+
+	throttledDone := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		_, err := f.FindTopLevelWithContext(ctx, throttledKey)
+		throttledDone <- err
+	}()
+	assert.NoError(t, wait.PollImmediate(time.Millisecond, 10*time.Second, func() (bool, error) {
+		scales.mutex.Lock()
+		defer scales.mutex.Unlock()
+		return scales.gets > 0, nil
+	}))
+
+	// The throttled read doesn't hold the limiter of Widgets while waiting to retry.
+	start := time.Now()
+	topLevel, err := f.FindTopLevel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, topLevel)
+
+	// Waiting stops with the context of the resolution.
+	err = <-throttledDone
+	assert.True(t, errors.Is(err, ErrResolutionTimeout), "unexpected error: %v", err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
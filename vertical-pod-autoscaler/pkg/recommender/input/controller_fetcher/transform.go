@@ -0,0 +1,44 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+// transformKey returns a copy of the given key with Options.NameTransformer, then Options.FinalKindRewrite
+// applied, or the key itself if there's neither.
+func (f *controllerFetcher) transformKey(key *ControllerKeyWithAPIVersion) *ControllerKeyWithAPIVersion {
+	if (f.nameTransformer == nil && f.finalKindRewrite == nil) || key == nil {
+		return key
+	}
+	transformed := *key
+	if f.nameTransformer != nil {
+		transformed.ControllerKey = f.nameTransformer(key.ControllerKey)
+	}
+	if f.finalKindRewrite != nil {
+		transformed = f.finalKindRewrite(transformed)
+	}
+	return &transformed
+}
+
+// transformResult returns a copy of the given result with the transforms of transformKey applied to the top
+// level controller. Results are cached untransformed.
+func (f *controllerFetcher) transformResult(result *FindTopLevelResult) *FindTopLevelResult {
+	if (f.nameTransformer == nil && f.finalKindRewrite == nil) || result == nil {
+		return result
+	}
+	transformed := *result
+	transformed.TopLevel = f.transformKey(result.TopLevel)
+	return &transformed
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNameTransformer(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.resolutionCache = newResolutionCache(time.Minute)
+	f.nameTransformer = func(key ControllerKey) ControllerKey {
+		key.Name = strings.TrimPrefix(key.Name, "tenant-a-")
+		return key
+	}
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant-a-frontend", Namespace: "test-namespace"},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "tenant-a-frontend-1234",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "tenant-a-frontend", Controller: &trueVar},
+			},
+		},
+	})
+	rsKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "tenant-a-frontend-1234", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	expected := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "frontend", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+
+	// Both resolved and cached results are transformed, while the cache keeps the real name.
+	for i := 0; i < 2; i++ {
+		topLevel, err := f.FindTopLevel(rsKey)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, topLevel)
+	}
+	cached, found := f.resolutionCache.get(*rsKey, time.Now())
+	if assert.True(t, found) {
+		assert.Equal(t, "tenant-a-frontend", cached.TopLevel.Name)
+	}
+
+	topLevels, err := f.FindAllTopLevels(context.Background(), rsKey)
+	assert.NoError(t, err)
+	assert.Equal(t, []*ControllerKeyWithAPIVersion{expected}, topLevels)
+}
+
+func TestFinalKindRewrite(t *testing.T) {
+	f := simpleControllerFetcher()
+	f.resolutionCache = newResolutionCache(time.Minute)
+	f.nameTransformer = func(key ControllerKey) ControllerKey {
+		key.Name = strings.TrimPrefix(key.Name, "tenant-a-")
+		return key
+	}
+	f.finalKindRewrite = func(key ControllerKeyWithAPIVersion) ControllerKeyWithAPIVersion {
+		if key.Kind == "Deployment" {
+			key.Kind = "Service"
+			key.ApiVersion = "platform.example.com/v1"
+		}
+		return key
+	}
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant-a-frontend", Namespace: "test-namespace"},
+	})
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "tenant-a-frontend-1234",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "tenant-a-frontend", Controller: &trueVar},
+			},
+		},
+	})
+	rsKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "tenant-a-frontend-1234", Kind: "ReplicaSet", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+	expected := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "frontend", Kind: "Service", Namespace: "test-namespace"}, ApiVersion: "platform.example.com/v1"}
+
+	// The rewrite sees the transformed name and applies to cached results too, which keep the real kind.
+	for i := 0; i < 2; i++ {
+		result, err := f.FindTopLevelDetailed(context.Background(), rsKey)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, result.TopLevel)
+	}
+	cached, found := f.resolutionCache.get(*rsKey, time.Now())
+	if assert.True(t, found) {
+		assert.Equal(t, "Deployment", cached.TopLevel.Kind)
+	}
+
+	// The chain of ancestors is reported as read.
+	ancestors, err := f.FindAncestors(context.Background(), rsKey)
+	assert.NoError(t, err)
+	if assert.Len(t, ancestors, 2) {
+		assert.Equal(t, "Deployment", ancestors[1].Kind)
+		assert.Equal(t, "tenant-a-frontend", ancestors[1].Name)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"fmt"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// uidIndex indexes objects by their UID.
+	uidIndex = "controllerfetcher/uid"
+	// ownerUIDIndex indexes objects by UIDs of their owners.
+	ownerUIDIndex = "controllerfetcher/ownerUID"
+)
+
+// wellKnownControllerGroupVersions are the API versions informers of well-known controllers are built for.
+var wellKnownControllerGroupVersions = map[wellKnownController]string{
+	daemonSet:             "apps/v1",
+	deployment:            "apps/v1",
+	replicaSet:            "apps/v1",
+	statefulSet:           "apps/v1",
+	replicationController: "v1",
+	job:                   "batch/v1",
+}
+
+// addUIDIndexers adds the indexers FindTopLevelByUID needs to the informer, unless another fetcher sharing the
+// informer added them already. It must be called before the informer is started: it fails for informers
+// already started, which then can't be used to look up UIDs.
+func addUIDIndexers(kind string, informer cache.SharedIndexInformer) error {
+	indexers := informer.GetIndexer().GetIndexers()
+	if indexers[uidIndex] != nil && indexers[ownerUIDIndex] != nil {
+		return nil
+	}
+	err := informer.AddIndexers(cache.Indexers{uidIndex: indexByUID, ownerUIDIndex: indexByOwnerUID})
+	if err != nil {
+		return fmt.Errorf("could not add UID indexers to the informer of %s: %v", kind, err)
+	}
+	return nil
+}
+
+func indexByUID(obj interface{}) ([]string, error) {
+	accessor, err := apimeta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return []string{string(accessor.GetUID())}, nil
+}
+
+func indexByOwnerUID(obj interface{}) ([]string, error) {
+	accessor, err := apimeta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	var uids []string
+	for _, owner := range accessor.GetOwnerReferences() {
+		uids = append(uids, string(owner.UID))
+	}
+	return uids, nil
+}
+
+func (f *controllerFetcher) FindTopLevelByUID(ctx context.Context, namespace string, uid types.UID) (*ControllerKeyWithAPIVersion, error) {
+	if pod := f.findPodByUID(namespace, uid); pod != nil {
+		return f.FindTopLevelForPod(ctx, pod)
+	}
+	key, err := f.findByUID(namespace, uid)
+	if err != nil {
+		f.notifyAnswered(ctx, ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{Namespace: namespace}}, nil, err)
+		return nil, err
+	}
+	return f.FindTopLevelWithContext(ctx, key)
+}
+
+// findByUID returns the key of the controller with the given UID in the given namespace, which is ignored
+// if empty.
+func (f *controllerFetcher) findByUID(namespace string, uid types.UID) (*ControllerKeyWithAPIVersion, error) {
+	for kind, informer := range f.informersMap {
+		if key := findInIndex(informer, namespace, uid, string(kind), wellKnownControllerGroupVersions[kind]); key != nil {
+			return key, nil
+		}
+	}
+	customInformers := f.getCustomInformers()
+	for groupKind, informer := range customInformers {
+		if key := findInIndex(informer, namespace, uid, groupKind.Kind, ""); key != nil {
+			return key, nil
+		}
+	}
+	// The controller isn't cached, but controllers it owns may be.
+	informers := make([]cache.SharedIndexInformer, 0, len(f.informersMap)+len(customInformers))
+	for _, informer := range f.informersMap {
+		informers = append(informers, informer)
+	}
+	for _, informer := range customInformers {
+		informers = append(informers, informer)
+	}
+	for _, informer := range informers {
+		if key := findOwnerInIndex(informer, namespace, uid); key != nil {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s in namespace %q", ErrUIDNotFound, uid, namespace)
+}
+
+// findInIndex returns the key of the object with the given UID in the informer. apiVersion is read from the
+// object if it's empty.
+func findInIndex(informer cache.SharedIndexInformer, namespace string, uid types.UID, kind, apiVersion string) *ControllerKeyWithAPIVersion {
+	objs, err := informer.GetIndexer().ByIndex(uidIndex, string(uid))
+	if err != nil {
+		return nil
+	}
+	for _, obj := range objs {
+		accessor, err := apimeta.Accessor(obj)
+		if err != nil || (namespace != "" && accessor.GetNamespace() != namespace) {
+			continue
+		}
+		if apiVersion == "" {
+			if runtimeObj, ok := obj.(runtime.Object); ok {
+				apiVersion = runtimeObj.GetObjectKind().GroupVersionKind().GroupVersion().String()
+			}
+		}
+		return &ControllerKeyWithAPIVersion{
+			ControllerKey: ControllerKey{Namespace: accessor.GetNamespace(), Kind: kind, Name: accessor.GetName()},
+			ApiVersion:    apiVersion,
+		}
+	}
+	return nil
+}
+
+// findOwnerInIndex returns the key of the owner with the given UID of an object in the informer.
+func findOwnerInIndex(informer cache.SharedIndexInformer, namespace string, uid types.UID) *ControllerKeyWithAPIVersion {
+	objs, err := informer.GetIndexer().ByIndex(ownerUIDIndex, string(uid))
+	if err != nil {
+		return nil
+	}
+	for _, obj := range objs {
+		accessor, err := apimeta.Accessor(obj)
+		if err != nil || (namespace != "" && accessor.GetNamespace() != namespace) {
+			continue
+		}
+		for _, owner := range accessor.GetOwnerReferences() {
+			if owner.UID == uid {
+				return &ControllerKeyWithAPIVersion{
+					ControllerKey: ControllerKey{Namespace: accessor.GetNamespace(), Kind: owner.Kind, Name: owner.Name},
+					ApiVersion:    owner.APIVersion,
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestFindTopLevelByUID(t *testing.T) {
+	widgetKind := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{widgetKind.GroupVersion()})
+	mapper.Add(widgetKind, apimeta.RESTScopeNamespace)
+	scales := newFakeScalesGetter()
+	scales.add(schema.GroupResource{Group: "example.com", Resource: "widgets"}, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-widget", Namespace: "test-namespace"},
+	})
+	f := simpleControllerFetcher()
+	f.mapper = mapper
+	f.scaleNamespacer = scales
+	for kind, informer := range f.informersMap {
+		assert.NoError(t, addUIDIndexers(string(kind), informer))
+	}
+	addController(f, &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rs",
+			Namespace: "test-namespace",
+			UID:       "rs-uid",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-deployment", UID: "deployment-uid", Controller: &trueVar},
+			},
+		},
+	})
+	addController(f, &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace", UID: "deployment-uid"},
+	})
+	addController(f, &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{Kind: "StatefulSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-sts",
+			Namespace: "test-namespace",
+			UID:       "sts-uid",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "example.com/v1", Kind: "Widget", Name: "test-widget", UID: "widget-uid", Controller: &trueVar},
+			},
+		},
+	})
+	deploymentKey := &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-deployment", Kind: "Deployment", Namespace: "test-namespace"}, ApiVersion: "apps/v1"}
+
+	topLevel, err := f.FindTopLevelByUID(context.Background(), "test-namespace", "rs-uid")
+	assert.NoError(t, err)
+	assert.Equal(t, deploymentKey, topLevel)
+
+	topLevel, err = f.FindTopLevelByUID(context.Background(), "", "deployment-uid")
+	assert.NoError(t, err)
+	assert.Equal(t, deploymentKey, topLevel)
+
+	// The Widget isn't cached, but it's found through the StatefulSet it owns.
+	topLevel, err = f.FindTopLevelByUID(context.Background(), "test-namespace", "widget-uid")
+	assert.NoError(t, err)
+	assert.Equal(t, &ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{
+		Name: "test-widget", Kind: "Widget", Namespace: "test-namespace"}, ApiVersion: "example.com/v1"}, topLevel)
+
+	_, err = f.FindTopLevelByUID(context.Background(), "other-namespace", "rs-uid")
+	assert.True(t, errors.Is(err, ErrUIDNotFound), "unexpected error: %v", err)
+	_, err = f.FindTopLevelByUID(context.Background(), "test-namespace", "missing-uid")
+	assert.True(t, errors.Is(err, ErrUIDNotFound), "unexpected error: %v", err)
+}
+
+func TestAddUIDIndexers(t *testing.T) {
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	informer := factory.Apps().V1().Deployments().Informer()
+	assert.NoError(t, addUIDIndexers("Deployment", informer))
+	// Fetchers sharing the informer reuse the indexers.
+	assert.NoError(t, addUIDIndexers("Deployment", informer))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	started := factory.Apps().V1().ReplicaSets().Informer()
+	factory.Start(stopCh)
+	assert.True(t, cache.WaitForCacheSync(stopCh, started.HasSynced))
+	assert.Error(t, addUIDIndexers("ReplicaSet", started))
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+)
+
+// OwnerStep returns the owner of the given controller, or nil if it's a top level controller.
+type OwnerStep func(ctx context.Context, controller ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error)
+
+// WalkOwners follows owners from start using step until a controller without an owner is found. It returns
+// the controllers step was called on, starting with start and ending with the top level controller. Walking
+// stops with an error if step fails, an owner is visited twice (ErrOwnershipCycle), or the context is done before a step; the
+// controllers stepped through so far are returned together with the error.
+func WalkOwners(ctx context.Context, start ControllerKeyWithAPIVersion, step OwnerStep) ([]ControllerKeyWithAPIVersion, error) {
+	var chain []ControllerKeyWithAPIVersion
+	visited := make(map[ControllerKeyWithAPIVersion]bool)
+	current := start
+	for {
+		if err := ctx.Err(); err != nil {
+			return chain, err
+		}
+		visited[current] = true
+		chain = append(chain, current)
+		owner, err := step(ctx, current)
+		if err != nil {
+			return chain, err
+		}
+		if owner == nil {
+			return chain, nil
+		}
+		if visited[*owner] {
+			return chain, ErrOwnershipCycle
+		}
+		current = *owner
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerfetcher
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalkOwners(t *testing.T) {
+	key := func(name string) ControllerKeyWithAPIVersion {
+		return ControllerKeyWithAPIVersion{ControllerKey: ControllerKey{Namespace: "test-namespace", Kind: "Widget", Name: name}}
+	}
+	stepFor := func(owners map[string]string) OwnerStep {
+		return func(ctx context.Context, controller ControllerKeyWithAPIVersion) (*ControllerKeyWithAPIVersion, error) {
+			owner, found := owners[controller.Name]
+			if !found {
+				return nil, fmt.Errorf("%s not found", controller.Name)
+			}
+			if owner == "" {
+				return nil, nil
+			}
+			ownerKey := key(owner)
+			return &ownerKey, nil
+		}
+	}
+	for _, tc := range []struct {
+		name          string
+		owners        map[string]string
+		expectedChain []ControllerKeyWithAPIVersion
+		expectedError error
+	}{
+		{
+			name:          "top level",
+			owners:        map[string]string{"a": ""},
+			expectedChain: []ControllerKeyWithAPIVersion{key("a")},
+		},
+		{
+			name:          "chain",
+			owners:        map[string]string{"a": "b", "b": "c", "c": ""},
+			expectedChain: []ControllerKeyWithAPIVersion{key("a"), key("b"), key("c")},
+		},
+		{
+			name:          "cycle",
+			owners:        map[string]string{"a": "b", "b": "c", "c": "b"},
+			expectedChain: []ControllerKeyWithAPIVersion{key("a"), key("b"), key("c")},
+			expectedError: fmt.Errorf("Cycle detected in ownership chain"),
+		},
+		{
+			name:          "step error",
+			owners:        map[string]string{"a": "b"},
+			expectedChain: []ControllerKeyWithAPIVersion{key("a"), key("b")},
+			expectedError: fmt.Errorf("b not found"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chain, err := WalkOwners(context.Background(), key("a"), stepFor(tc.owners))
+			assert.Equal(t, tc.expectedChain, chain)
+			assert.Equal(t, tc.expectedError, err)
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	chain, err := WalkOwners(ctx, key("a"), stepFor(map[string]string{"a": ""}))
+	assert.Empty(t, chain)
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package recommender
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	controllerFetcherScaleLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "controller_fetcher_scale_lookups_total",
+			Help:      "Number of controllers read by the controller fetcher through the scale subresource.",
+		}, []string{"group_kind"},
+	)
+	controllerFetcherOwnershipDepth = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "controller_fetcher_ownership_depth",
+			Help:      "Number of owners followed by the controller fetcher to resolve top level controllers, by their GroupKind.",
+			Buckets:   []float64{0, 1, 2, 3, 4, 5, 8},
+		}, []string{"group_kind"},
+	)
+	controllerFetcherResolutions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "controller_fetcher_resolutions_total",
+			Help:      "Number of resolutions of top level controllers by the controller fetcher, by their outcome.",
+		}, []string{"outcome"},
+	)
+	controllerFetcherCacheLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "controller_fetcher_cache_lookups_total",
+			Help:      "Number of lookups of top level controllers in the resolution cache of the controller fetcher, by their result.",
+		}, []string{"result"},
+	)
+	controllerFetcherDroppedAuditRecords = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "controller_fetcher_dropped_audit_records_total",
+			Help:      "Number of resolutions not recorded by the audit sink of the controller fetcher because it didn't keep up.",
+		},
+	)
+)
+
+// RecordControllerFetcherScaleLookup records a read of a controller of the given GroupKind through the scale subresource
+func RecordControllerFetcherScaleLookup(groupKind string) {
+	controllerFetcherScaleLookups.WithLabelValues(groupKind).Inc()
+}
+
+// RecordControllerFetcherOwnershipDepth records the number of owners followed to resolve a top level controller of the given GroupKind
+func RecordControllerFetcherOwnershipDepth(groupKind string, depth int) {
+	controllerFetcherOwnershipDepth.WithLabelValues(groupKind).Observe(float64(depth))
+}
+
+// RecordControllerFetcherCacheLookup records a lookup of a top level controller in the resolution cache with the given result
+func RecordControllerFetcherCacheLookup(result string) {
+	controllerFetcherCacheLookups.WithLabelValues(result).Inc()
+}
+
+// RecordControllerFetcherDroppedAuditRecord records a resolution not recorded by the audit sink
+func RecordControllerFetcherDroppedAuditRecord() {
+	controllerFetcherDroppedAuditRecords.Inc()
+}
+
+// RecordControllerFetcherResolution records a resolution of a top level controller with the given outcome
+func RecordControllerFetcherResolution(outcome string) {
+	controllerFetcherResolutions.WithLabelValues(outcome).Inc()
+}
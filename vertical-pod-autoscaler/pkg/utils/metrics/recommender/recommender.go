@@ -87,7 +87,9 @@ type ObjectCounter struct {
 
 // Register initializes all metrics for VPA Recommender
 func Register() {
-	prometheus.MustRegister(vpaObjectCount, recommendationLatency, functionLatency, aggregateContainerStatesCount)
+	prometheus.MustRegister(vpaObjectCount, recommendationLatency, functionLatency, aggregateContainerStatesCount,
+		controllerFetcherScaleLookups, controllerFetcherOwnershipDepth, controllerFetcherResolutions,
+		controllerFetcherCacheLookups, controllerFetcherDroppedAuditRecords)
 }
 
 // NewExecutionTimer provides a timer for Recommender's RunOnce execution